@@ -0,0 +1,212 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"delivery-service/frequency"
+	"delivery-service/ranking"
+	"delivery-service/schedule"
+	"delivery-service/storage"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	// PacingASAP delivers a campaign as fast as its limits allow
+	PacingASAP = "asap"
+	// PacingEven spreads the daily impressions of a campaign evenly over the day
+	PacingEven = "even"
+
+	// StoreMemory keeps the delivered impressions in the service memory
+	StoreMemory = "memory"
+	// StoreRedis keeps the delivered impressions in the redis server of the frequency counters
+	StoreRedis = "redis"
+	// StoreOff disables budgets and pacing
+	StoreOff = "off"
+)
+
+var (
+	// Store is the ledger store selected by BUDGET_STORE
+	Store = StoreMemory
+
+	// random draws the throttling of paced campaigns for anonymous requests, replaced in tests
+	random = rand.Float64
+)
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "budget")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	if store := os.Getenv("BUDGET_STORE"); store != "" {
+		Store = store
+	}
+}
+
+// Delivery is the number of impressions of a campaign on a day and over its lifetime
+type Delivery struct {
+	Day   int
+	Total int
+}
+
+// Ledger counts the impressions delivered per campaign
+type Ledger interface {
+	// Delivered returns the delivery of each campaign id of days on its day
+	Delivered(ctx context.Context, days map[string]string) (map[string]Delivery, error)
+	// Record adds an impression of campaignID on day
+	Record(ctx context.Context, campaignID, day string) error
+}
+
+// New returns the ledger of the BUDGET_STORE store, nil when budgets are off
+func New() Ledger {
+	switch Store {
+	case StoreOff:
+		return nil
+	case StoreRedis:
+		level.Info(logger).Log("msg", "counting delivered impressions in redis", "addr", frequency.RedisAddr, "db", frequency.RedisDB)
+		return NewRedisLedger(frequency.NewRedisClient())
+	case StoreMemory:
+	default:
+		level.Error(logger).Log("msg", "unknown BUDGET_STORE, using memory", "store", Store)
+	}
+	return NewMemoryLedger()
+}
+
+// Day returns the day of now in the timezone of the campaign schedule, the day
+// delivered impressions are counted on
+func Day(campaign storage.Campaign, now time.Time) string {
+	return now.In(schedule.Location(campaign.Schedule)).Format(time.DateOnly)
+}
+
+// Validate checks the limits and pacing of a budget, even pacing needs a daily limit
+// or a lifetime limit with an end date
+func Validate(b *storage.Budget, s *storage.Schedule) error {
+	if b == nil {
+		return nil
+	}
+
+	if b.DailyImpressions < 0 || b.LifetimeImpressions < 0 || b.DailySpend < 0 || b.LifetimeSpend < 0 || b.CPM < 0 {
+		return errors.New("budget limits and cpm must not be negative")
+	}
+	if (b.DailySpend > 0 || b.LifetimeSpend > 0) && b.CPM == 0 {
+		return errors.New("budget spend limits need a cpm")
+	}
+
+	daily, lifetime := limits(b)
+	switch b.Pacing {
+	case "", PacingASAP:
+	case PacingEven:
+		if daily == 0 && (lifetime == 0 || s == nil || s.EndAt == nil) {
+			return errors.New("even pacing needs a daily limit or a lifetime limit and a schedule endAt")
+		}
+	default:
+		return errors.New("budget pacing must be asap or even: " + b.Pacing)
+	}
+	return nil
+}
+
+// Filter returns the campaigns whose budget allows delivery to userID at now. Campaigns
+// that exhausted a limit are left out, evenly paced campaigns ahead of their pace are
+// left out with a probability growing with their advance. The draw of a user is seeded
+// by the user, the campaign and the day like the ranking shuffle, so that the pages of
+// a user come from the same campaigns within a day. Anonymous requests draw at random.
+func Filter(ctx context.Context, ledger Ledger, campaigns []storage.Campaign, userID string, now time.Time) ([]storage.Campaign, error) {
+	days := make(map[string]string)
+	for _, campaign := range campaigns {
+		if campaign.Budget != nil {
+			days[campaign.ID] = Day(campaign, now)
+		}
+	}
+	if len(days) == 0 {
+		return campaigns, nil
+	}
+
+	delivered, err := ledger.Delivered(ctx, days)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]storage.Campaign, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		if campaign.Budget != nil {
+			p := Eligibility(campaign, delivered[campaign.ID], now)
+			if p <= 0 || (p < 1 && draw(userID, campaign.ID, days[campaign.ID]) >= p) {
+				continue
+			}
+		}
+		kept = append(kept, campaign)
+	}
+	return kept, nil
+}
+
+// draw returns the pacing draw of a campaign for userID on day, uniform in (0, 1)
+func draw(userID, campaignID, day string) float64 {
+	if userID == "" {
+		return random()
+	}
+	return ranking.Uniform(userID, campaignID, day)
+}
+
+// Eligibility returns the probability of delivering a campaign at now given its
+// delivery so far: 0 once a limit is reached, below 1 when an evenly paced campaign
+// delivered more than the share of its daily target elapsed in the day
+func Eligibility(campaign storage.Campaign, delivery Delivery, now time.Time) float64 {
+	b := campaign.Budget
+	daily, lifetime := limits(b)
+
+	if (daily > 0 && delivery.Day >= daily) || (lifetime > 0 && delivery.Total >= lifetime) {
+		return 0
+	}
+	if b.Pacing != PacingEven || delivery.Day == 0 {
+		return 1
+	}
+
+	local := now.In(schedule.Location(campaign.Schedule))
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	end := start.AddDate(0, 0, 1)
+
+	target := float64(daily)
+	if s := campaign.Schedule; lifetime > 0 && s != nil && s.EndAt != nil {
+		// spread what was left at the start of the day over the remaining days
+		remaining := float64(lifetime - (delivery.Total - delivery.Day))
+		days := math.Max(1, math.Ceil(s.EndAt.Sub(start).Hours()/24))
+		if target == 0 || remaining/days < target {
+			target = remaining / days
+		}
+	}
+	if target <= 0 {
+		return 1
+	}
+
+	elapsed := float64(local.Sub(start)) / float64(end.Sub(start))
+	expected := target * elapsed
+	if float64(delivery.Day) <= expected {
+		return 1
+	}
+	return expected / float64(delivery.Day)
+}
+
+// limits returns the daily and lifetime impression limits of a budget, 0 when not set
+func limits(b *storage.Budget) (int, int) {
+	return limit(b.DailyImpressions, b.DailySpend, b.CPM), limit(b.LifetimeImpressions, b.LifetimeSpend, b.CPM)
+}
+
+func limit(impressions int, spend, cpm float64) int {
+	if spend > 0 && cpm > 0 {
+		bySpend := int(spend / cpm * 1000)
+		if impressions == 0 || bySpend < impressions {
+			return bySpend
+		}
+	}
+	return impressions
+}
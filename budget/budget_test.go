@@ -0,0 +1,145 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func ledgers(t *testing.T) map[string]Ledger {
+	server := miniredis.RunT(t)
+	return map[string]Ledger{
+		"memory": NewMemoryLedger(),
+		"redis":  NewRedisLedger(redis.NewClient(&redis.Options{Addr: server.Addr()})),
+	}
+}
+
+// impressions are counted per campaign on their day and over the lifetime
+func TestLedger1(t *testing.T) {
+	ctx := context.Background()
+
+	for name, ledger := range ledgers(t) {
+		assert.NoError(t, ledger.Record(ctx, "c1", "2026-03-01"), name)
+		assert.NoError(t, ledger.Record(ctx, "c1", "2026-03-01"), name)
+		assert.NoError(t, ledger.Record(ctx, "c1", "2026-03-02"), name)
+		assert.NoError(t, ledger.Record(ctx, "c2", "2026-03-02"), name)
+
+		delivered, err := ledger.Delivered(ctx, map[string]string{"c1": "2026-03-02", "c2": "2026-03-02", "c3": "2026-03-02"})
+		assert.NoError(t, err, name)
+		assert.Equal(t, Delivery{Day: 1, Total: 3}, delivered["c1"], name)
+		assert.Equal(t, Delivery{Day: 1, Total: 1}, delivered["c2"], name)
+		assert.Equal(t, Delivery{}, delivered["c3"], name)
+	}
+}
+
+// campaigns are not delivered once a daily or lifetime limit is reached, spend limits go through the cpm
+func TestEligibility1(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	campaign := storage.Campaign{ID: "c1", Budget: &storage.Budget{DailyImpressions: 100, LifetimeImpressions: 1000}}
+
+	assert.Equal(t, 1.0, Eligibility(campaign, Delivery{Day: 99, Total: 500}, now))
+	assert.Equal(t, 0.0, Eligibility(campaign, Delivery{Day: 100, Total: 500}, now))
+	assert.Equal(t, 0.0, Eligibility(campaign, Delivery{Day: 10, Total: 1000}, now))
+
+	// 2.5 at a cpm of 50 buys 50 impressions
+	campaign.Budget = &storage.Budget{DailySpend: 2.5, CPM: 50}
+	assert.Equal(t, 1.0, Eligibility(campaign, Delivery{Day: 49}, now))
+	assert.Equal(t, 0.0, Eligibility(campaign, Delivery{Day: 50}, now))
+}
+
+// evenly paced campaigns are throttled when ahead of the share of the day elapsed
+func TestEligibility2(t *testing.T) {
+	campaign := storage.Campaign{ID: "c1", Budget: &storage.Budget{DailyImpressions: 240, Pacing: PacingEven}}
+
+	// a quarter of the day, 60 impressions expected
+	now := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	assert.Equal(t, 1.0, Eligibility(campaign, Delivery{Day: 60}, now))
+	assert.InDelta(t, 0.5, Eligibility(campaign, Delivery{Day: 120}, now), 1e-9)
+
+	// the day follows the schedule timezone, 06:00 UTC is 11:30 in Kolkata
+	campaign.Schedule = &storage.Schedule{Timezone: "Asia/Kolkata"}
+	assert.Equal(t, 1.0, Eligibility(campaign, Delivery{Day: 110}, now))
+
+	// a lifetime limit is spread over the days left until endAt
+	end := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+	campaign = storage.Campaign{ID: "c1", Schedule: &storage.Schedule{EndAt: &end}, Budget: &storage.Budget{LifetimeImpressions: 1000, Pacing: PacingEven}}
+	// 800 left on 4 days, 100 expected at 12:00
+	now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 1.0, Eligibility(campaign, Delivery{Day: 100, Total: 300}, now))
+	assert.InDelta(t, 0.5, Eligibility(campaign, Delivery{Day: 200, Total: 400}, now), 1e-9)
+}
+
+// exhausted campaigns are dropped, paced campaigns are dropped by the random draw
+func TestFilter1(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	ledger := NewMemoryLedger()
+
+	campaigns := []storage.Campaign{
+		{ID: "exhausted", Budget: &storage.Budget{DailyImpressions: 1}},
+		{ID: "paced", Budget: &storage.Budget{DailyImpressions: 8, Pacing: PacingEven}},
+		{ID: "unlimited"},
+	}
+	for _, id := range []string{"exhausted", "paced", "paced", "paced", "paced"} {
+		assert.NoError(t, ledger.Record(ctx, id, "2026-03-01"))
+	}
+
+	// paced delivered 4 for 2 expected, eligible half of the time
+	defer func(r func() float64) { random = r }(random)
+
+	random = func() float64 { return 0.4 }
+	kept, err := Filter(ctx, ledger, campaigns, "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"paced", "unlimited"}, []string{kept[0].ID, kept[1].ID})
+
+	random = func() float64 { return 0.6 }
+	kept, err = Filter(ctx, ledger, campaigns, "", now)
+	assert.NoError(t, err)
+	assert.Len(t, kept, 1)
+	assert.Equal(t, "unlimited", kept[0].ID)
+}
+
+// the pacing draw of a user is the same on every request of the day, users are split
+func TestFilter2(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	ledger := NewMemoryLedger()
+
+	campaigns := []storage.Campaign{{ID: "paced", Budget: &storage.Budget{DailyImpressions: 8, Pacing: PacingEven}}}
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, ledger.Record(ctx, "paced", "2026-03-01"))
+	}
+
+	// paced delivered 4 for 2 expected, eligible for half of the users
+	delivered := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprint("user-", i)
+		kept, err := Filter(ctx, ledger, campaigns, user, now)
+		assert.NoError(t, err)
+		again, err := Filter(ctx, ledger, campaigns, user, now)
+		assert.NoError(t, err)
+		assert.Equal(t, len(kept), len(again), user)
+		delivered += len(kept)
+	}
+	assert.InDelta(t, 500, delivered, 60)
+}
+
+// budgets need non negative limits, a cpm for spend limits and a pace target for even pacing
+func TestValidate1(t *testing.T) {
+	end := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, Validate(nil, nil))
+	assert.NoError(t, Validate(&storage.Budget{DailyImpressions: 100, Pacing: PacingEven}, nil))
+	assert.NoError(t, Validate(&storage.Budget{LifetimeSpend: 100, CPM: 2, Pacing: PacingEven}, &storage.Schedule{EndAt: &end}))
+	assert.Error(t, Validate(&storage.Budget{DailyImpressions: -1}, nil))
+	assert.Error(t, Validate(&storage.Budget{DailySpend: 10}, nil))
+	assert.Error(t, Validate(&storage.Budget{LifetimeImpressions: 100, Pacing: PacingEven}, nil))
+	assert.Error(t, Validate(&storage.Budget{DailyImpressions: 100, Pacing: "fast"}, nil))
+}
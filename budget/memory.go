@@ -0,0 +1,63 @@
+package budget
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryLedger is a Ledger keeping the delivered impressions in memory, for single
+// instance deployments and tests
+type MemoryLedger struct {
+	mu         sync.Mutex
+	deliveries map[string]*delivery
+}
+
+type delivery struct {
+	total int
+	// today counts the impressions of day, the last day recorded
+	day   string
+	today int
+}
+
+// NewMemoryLedger creates an empty MemoryLedger
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{deliveries: make(map[string]*delivery)}
+}
+
+// Delivered returns the delivery of each campaign on its day
+func (l *MemoryLedger) Delivered(ctx context.Context, days map[string]string) (map[string]Delivery, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delivered := make(map[string]Delivery, len(days))
+	for campaignID, day := range days {
+		d, ok := l.deliveries[campaignID]
+		if !ok {
+			continue
+		}
+		result := Delivery{Total: d.total}
+		if d.day == day {
+			result.Day = d.today
+		}
+		delivered[campaignID] = result
+	}
+	return delivered, nil
+}
+
+// Record adds an impression of campaignID on day
+func (l *MemoryLedger) Record(ctx context.Context, campaignID, day string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	d, ok := l.deliveries[campaignID]
+	if !ok {
+		d = &delivery{}
+		l.deliveries[campaignID] = d
+	}
+	if d.day != day {
+		d.day, d.today = day, 0
+	}
+	d.today++
+	d.total++
+	return nil
+}
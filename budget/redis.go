@@ -0,0 +1,73 @@
+package budget
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dayRetention keeps the daily counters until every timezone is past their day
+const dayRetention = 72 * time.Hour
+
+// RedisLedger is a Ledger keeping a lifetime and a daily counter per campaign in a redis
+// compatible server, shared by every instance of the service
+type RedisLedger struct {
+	client redis.Cmdable
+}
+
+// NewRedisLedger creates a RedisLedger on client
+func NewRedisLedger(client redis.Cmdable) *RedisLedger {
+	return &RedisLedger{client: client}
+}
+
+// Delivered returns the delivery of each campaign on its day, in a single round trip
+func (l *RedisLedger) Delivered(ctx context.Context, days map[string]string) (map[string]Delivery, error) {
+	cmds := make(map[string]*redis.SliceCmd, len(days))
+	_, err := l.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for campaignID, day := range days {
+			cmds[campaignID] = pipe.MGet(ctx, totalKey(campaignID), dayKey(campaignID, day))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivered := make(map[string]Delivery, len(cmds))
+	for campaignID, cmd := range cmds {
+		values := cmd.Val()
+		delivered[campaignID] = Delivery{Total: toInt(values[0]), Day: toInt(values[1])}
+	}
+	return delivered, nil
+}
+
+// Record adds an impression of campaignID on day
+func (l *RedisLedger) Record(ctx context.Context, campaignID, day string) error {
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, totalKey(campaignID))
+		pipe.Incr(ctx, dayKey(campaignID, day))
+		pipe.Expire(ctx, dayKey(campaignID, day), dayRetention)
+		return nil
+	})
+	return err
+}
+
+// toInt returns the count of a counter value, 0 for missing counters
+func toInt(value interface{}) int {
+	s, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func totalKey(campaignID string) string {
+	return "budget:" + campaignID + ":total"
+}
+
+func dayKey(campaignID, day string) string {
+	return "budget:" + campaignID + ":" + day
+}
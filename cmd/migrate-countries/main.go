@@ -0,0 +1,49 @@
+// Command migrate-countries moves the countries of the campaigns from the per country
+// collections of the collections layout to the countries field of campaigns_details.
+//
+//	migrate-countries [-db campaigns] [-dry-run]
+//
+// It connects to MONGODB_CONN_URI and can run while the service is serving: the country
+// collections are kept for the instances still running with CAMPAIGN_LAYOUT=collections.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"delivery-service/storage/mongodb"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+func main() {
+	dbName := flag.String("db", "campaigns", "database holding the campaign collections")
+	dryRun := flag.Bool("dry-run", false, "report the campaigns to update without writing")
+	timeout := flag.Duration("timeout", 10*time.Minute, "time allowed for the migration")
+	flag.Parse()
+
+	// Set up logger
+	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "main")
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	migration, err := mongodb.MigrateCountries(ctx, mongodb.MongoDB.GetDb(*dbName), *dryRun)
+	if err != nil {
+		level.Error(logger).Log("msg", "migration failed, running it again resumes it", "err", err)
+		os.Exit(1)
+	}
+
+	level.Info(logger).Log("msg", "countries migrated", "dryRun", *dryRun, "campaigns", migration.Campaigns, "countries", len(migration.Countries))
+	if len(migration.Skipped) > 0 {
+		level.Info(logger).Log("msg", "collections not named after a country were left out", "collections", strings.Join(migration.Skipped, ","))
+	}
+	if len(migration.Orphans) > 0 {
+		level.Info(logger).Log("msg", "country collections list campaigns without details", "ids", strings.Join(migration.Orphans, ","))
+	}
+}
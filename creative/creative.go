@@ -0,0 +1,130 @@
+package creative
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"delivery-service/locale"
+	"delivery-service/storage"
+)
+
+// MaxDensity is the highest screen density requests may declare
+const MaxDensity = 10
+
+// Screen is the screen of a request, its size in device independent points
+type Screen struct {
+	Width  int
+	Height int
+	// Density is the number of pixels per point, like 2 or 2.75
+	Density float64
+}
+
+// ParseDensity parses the screen density of a request, in pixels per point
+func ParseDensity(density string) (float64, error) {
+	d, err := strconv.ParseFloat(density, 64)
+	if err != nil || !(d > 0 && d <= MaxDensity) {
+		return 0, errors.New("density must be a number of pixels per point between 0 and " + strconv.Itoa(MaxDensity))
+	}
+	return d, nil
+}
+
+// Pixels returns the width in pixels of width points on the screen
+func (s Screen) Pixels(width int) int {
+	return int(float64(width)*s.Density + 0.5)
+}
+
+// Image returns the image best fitting width pixels: the narrowest at least that wide,
+// the widest when none is. A zero width picks the widest. It returns false without images.
+func Image(images []storage.Image, width int) (storage.Image, bool) {
+	if len(images) == 0 {
+		return storage.Image{}, false
+	}
+
+	widest, best := 0, -1
+	for i, image := range images {
+		if image.Width > images[widest].Width {
+			widest = i
+		}
+		if width > 0 && image.Width >= width && (best < 0 || image.Width < images[best].Width) {
+			best = i
+		}
+	}
+	if best < 0 {
+		best = widest
+	}
+	return images[best], true
+}
+
+// Text returns the texts best matching the preferred languages and the tag they are for,
+// false when none match. See locale.Lookup.
+func Text(texts map[string]storage.Text, preferred []string) (storage.Text, string, bool) {
+	return locale.Lookup(texts, preferred)
+}
+
+// Validate checks the assets of a creative: http(s) urls, positive image sizes, a video
+// mime type and duration and language tags for the texts
+func Validate(c *storage.Creative) error {
+	if c == nil {
+		return nil
+	}
+
+	for _, image := range c.Images {
+		if !isHTTPURL(image.URL) {
+			return errors.New("creative image url must be an http(s) url")
+		}
+		if image.Width <= 0 || image.Height <= 0 {
+			return errors.New("creative image " + image.URL + " needs a positive width and height")
+		}
+	}
+
+	if video := c.Video; video != nil {
+		if !isHTTPURL(video.URL) {
+			return errors.New("creative video url must be an http(s) url")
+		}
+		if !strings.HasPrefix(video.MimeType, "video/") {
+			return errors.New("creative video mimeType must be a video type, like video/mp4")
+		}
+		if video.Duration <= 0 {
+			return errors.New("creative video duration must be positive")
+		}
+		if video.Width < 0 || video.Height < 0 {
+			return errors.New("creative video size must not be negative")
+		}
+	}
+
+	if c.HTML != "" && !isHTTPURL(c.HTML) {
+		return errors.New("creative html must be an http(s) url")
+	}
+
+	seen := make(map[string]struct{}, len(c.Texts))
+	for tag := range c.Texts {
+		if !locale.IsTag(tag) {
+			return errors.New("creative texts language must be a BCP 47 tag, like en or pt-BR: " + tag)
+		}
+		if _, ok := seen[strings.ToLower(tag)]; ok {
+			return errors.New("duplicate creative texts language: " + tag)
+		}
+		seen[strings.ToLower(tag)] = struct{}{}
+	}
+
+	if tracking := c.Tracking; tracking != nil {
+		for _, u := range append(append([]string{}, tracking.Impressions...), tracking.Clicks...) {
+			if !isHTTPURL(u) {
+				return errors.New("creative tracking url must be an http(s) url: " + u)
+			}
+		}
+	}
+	return nil
+}
+
+// HasAsset reports whether a creative has an image, a video or an html asset
+func HasAsset(c *storage.Creative) bool {
+	return c != nil && (len(c.Images) > 0 || c.Video != nil || c.HTML != "")
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,81 @@
+package creative
+
+import (
+	"testing"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// images are picked by the width in pixels they cover
+func TestImage1(t *testing.T) {
+	images := []storage.Image{
+		{URL: "https://img/640.png", Width: 640, Height: 100},
+		{URL: "https://img/320.png", Width: 320, Height: 50},
+		{URL: "https://img/960.png", Width: 960, Height: 150},
+	}
+
+	image, ok := Image(images, Screen{Width: 320, Density: 2}.Pixels(320))
+	assert.True(t, ok)
+	assert.Equal(t, "https://img/640.png", image.URL)
+
+	image, _ = Image(images, 300)
+	assert.Equal(t, "https://img/320.png", image.URL)
+
+	// The widest image when none covers the width, or without a width
+	image, _ = Image(images, 1242)
+	assert.Equal(t, "https://img/960.png", image.URL)
+	image, _ = Image(images, 0)
+	assert.Equal(t, "https://img/960.png", image.URL)
+
+	_, ok = Image(nil, 320)
+	assert.False(t, ok)
+}
+
+// texts fall back on the shorter language tags
+func TestText1(t *testing.T) {
+	texts := map[string]storage.Text{
+		"en":    {Title: "Music for everyone", Cta: "Listen"},
+		"pt":    {Title: "Música para todos", Cta: "Ouvir"},
+		"pt-BR": {Title: "Música pra todo mundo", Cta: "Escutar"},
+	}
+
+	text, tag, ok := Text(texts, []string{"pt-br"})
+	assert.True(t, ok)
+	assert.Equal(t, "pt-BR", tag)
+	assert.Equal(t, "Escutar", text.Cta)
+
+	_, tag, _ = Text(texts, []string{"pt-PT"})
+	assert.Equal(t, "pt", tag)
+
+	_, tag, _ = Text(texts, []string{"en-Latn-GB"})
+	assert.Equal(t, "en", tag)
+
+	_, _, ok = Text(texts, []string{"fr"})
+	assert.False(t, ok)
+	_, _, ok = Text(texts, nil)
+	assert.False(t, ok)
+}
+
+// creatives need http(s) urls, sized images, typed videos and language tags
+func TestValidate1(t *testing.T) {
+	valid := &storage.Creative{
+		Images:   []storage.Image{{URL: "https://img/320.png", Width: 320, Height: 50}},
+		Video:    &storage.Video{URL: "https://video/ad.mp4", MimeType: "video/mp4", Duration: 15},
+		HTML:     "https://play/ad.html",
+		Texts:    map[string]storage.Text{"en": {Title: "Music"}, "pt-BR": {Title: "Música"}},
+		Tracking: &storage.Tracking{Impressions: []string{"https://track/i"}, Clicks: []string{"https://track/c"}},
+	}
+	assert.NoError(t, Validate(valid))
+	assert.NoError(t, Validate(nil))
+
+	assert.Error(t, Validate(&storage.Creative{Images: []storage.Image{{URL: "https://img/320.png"}}}))
+	assert.Error(t, Validate(&storage.Creative{Images: []storage.Image{{URL: "img/320.png", Width: 320, Height: 50}}}))
+	assert.Error(t, Validate(&storage.Creative{Video: &storage.Video{URL: "https://video/ad.mp4", MimeType: "image/gif", Duration: 15}}))
+	assert.Error(t, Validate(&storage.Creative{Video: &storage.Video{URL: "https://video/ad.mp4", MimeType: "video/mp4"}}))
+	assert.Error(t, Validate(&storage.Creative{HTML: "javascript:alert(1)"}))
+	assert.Error(t, Validate(&storage.Creative{Texts: map[string]storage.Text{"english": {Title: "Music"}}}))
+	assert.Error(t, Validate(&storage.Creative{Texts: map[string]storage.Text{"en": {}, "EN": {}}}))
+	assert.Error(t, Validate(&storage.Creative{Tracking: &storage.Tracking{Clicks: []string{"track/c"}}}))
+}
@@ -0,0 +1,78 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strconv"
+
+	"delivery-service/ranking"
+	"delivery-service/storage"
+)
+
+// ErrInvalid is returned by Decode for tokens it did not encode
+var ErrInvalid = errors.New("not a delivery cursor")
+
+// Cursor is the position of the last campaign of a page in the ranking of a user, with
+// the version of the campaigns it was ranked among
+type Cursor struct {
+	After   ranking.Position
+	Version string
+}
+
+// token is the encoded form of a cursor, with short names to keep tokens short
+type token struct {
+	Priority int     `json:"p,omitempty"`
+	Key      float64 `json:"k,omitempty"`
+	ID       string  `json:"id"`
+	Version  string  `json:"v"`
+}
+
+// Encode returns the opaque token of c, safe in query strings
+func Encode(c Cursor) string {
+	data, _ := json.Marshal(token{Priority: c.After.Priority, Key: c.After.Key, ID: c.After.ID, Version: c.Version})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode returns the cursor of a token returned by Encode
+func Decode(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalid
+	}
+
+	var t token
+	if err := json.Unmarshal(data, &t); err != nil || t.ID == "" || math.IsNaN(t.Key) {
+		return Cursor{}, ErrInvalid
+	}
+	return Cursor{After: ranking.Position{Priority: t.Priority, Key: t.Key, ID: t.ID}, Version: t.Version}, nil
+}
+
+// Version returns the snapshot version of ranked campaigns: it changes when a campaign
+// is added or removed or when the priority or weight of one changes, which moves it in
+// the ranking
+func Version(campaigns []storage.Campaign) string {
+	h := fnv.New64a()
+	for _, campaign := range campaigns {
+		h.Write([]byte(campaign.ID))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.Itoa(campaign.Priority)))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatFloat(campaign.Weight, 'g', -1, 64)))
+		h.Write([]byte{0})
+	}
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// After returns the ranked campaigns after the position of c, whose positions are given
+// by position
+func After(campaigns []storage.Campaign, c Cursor, position func(storage.Campaign) ranking.Position) []storage.Campaign {
+	for i, campaign := range campaigns {
+		if c.After.Before(position(campaign)) {
+			return campaigns[i:]
+		}
+	}
+	return nil
+}
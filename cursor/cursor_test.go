@@ -0,0 +1,50 @@
+package cursor
+
+import (
+	"testing"
+
+	"delivery-service/ranking"
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokens decode to the cursor they encode, other strings are rejected
+func TestCursor1(t *testing.T) {
+	campaign := storage.Campaign{ID: "c1", Priority: 2, Weight: 3}
+	c := Cursor{After: ranking.PositionOf(campaign, "user-1"), Version: Version([]storage.Campaign{campaign})}
+
+	decoded, err := Decode(Encode(c))
+	assert.NoError(t, err)
+	assert.Equal(t, c, decoded)
+
+	for _, token := range []string{"", "not a cursor", Encode(Cursor{})} {
+		_, err = Decode(token)
+		assert.ErrorIs(t, err, ErrInvalid)
+	}
+}
+
+// the version changes with the campaigns and their priority and weight
+func TestVersion1(t *testing.T) {
+	campaigns := []storage.Campaign{{ID: "c1"}, {ID: "c2", Weight: 2}}
+	version := Version(campaigns)
+	assert.Equal(t, version, Version([]storage.Campaign{{ID: "c1"}, {ID: "c2", Weight: 2}}))
+
+	assert.NotEqual(t, version, Version(campaigns[:1]))
+	assert.NotEqual(t, version, Version([]storage.Campaign{{ID: "c1"}, {ID: "c2", Weight: 3}}))
+	assert.NotEqual(t, version, Version([]storage.Campaign{{ID: "c1", Priority: 1}, {ID: "c2", Weight: 2}}))
+}
+
+// the campaigns after a cursor are those ranked after its position, wherever it was
+func TestAfter1(t *testing.T) {
+	campaigns := []storage.Campaign{{ID: "c4", Priority: 1}, {ID: "c1"}, {ID: "c3"}}
+	position := func(c storage.Campaign) ranking.Position { return ranking.PositionOf(c, "") }
+
+	after := After(campaigns, Cursor{After: ranking.Position{ID: "c2"}}, position)
+	assert.Equal(t, []storage.Campaign{{ID: "c3"}}, after)
+
+	after = After(campaigns, Cursor{After: ranking.Position{Priority: 1, ID: "c4"}}, position)
+	assert.Equal(t, campaigns[1:], after)
+
+	assert.Empty(t, After(campaigns, Cursor{After: ranking.Position{ID: "c3"}}, position))
+}
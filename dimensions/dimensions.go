@@ -0,0 +1,497 @@
+package dimensions
+
+import (
+	"errors"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"delivery-service/locale"
+	"delivery-service/storage"
+	"delivery-service/utils"
+)
+
+const (
+	includePrefix = "include"
+	excludePrefix = "exclude"
+
+	// UserID is the parameter of the user or device id of a request, campaigns target it
+	// through segments only
+	UserID = "user_id"
+)
+
+var (
+	// reverse domain bundle ids (com.company.game) or numeric store ids (123456, id123456)
+	appIDPattern = `^(([A-Za-z][A-Za-z0-9_-]*)(\.[A-Za-z0-9_-]+)+|(id)?[0-9]+)$`
+
+	patternDescriptions = map[string]string{
+		appIDPattern: "not an app id, expected a bundle id like com.company.app or a numeric store id",
+	}
+
+	knownOS = []string{"android", "ios", "ipados", "tvos", "watchos", "macos", "windows", "linux", "chromeos", "fireos", "harmonyos", "tizen", "webos"}
+
+	// builtins are the defaults of the dimensions registered without a type
+	builtins = map[string]storage.Dimension{
+		"app":     {Name: "app", Type: storage.TypeString, Required: true, Pattern: appIDPattern},
+		"country": {Name: "country", Type: storage.TypeGeo, Required: true},
+		"os":      {Name: "os", Type: storage.TypeEnum, Required: true, Values: knownOS},
+
+		"os_version":  {Name: "os_version", Type: storage.TypeVersion},
+		"app_version": {Name: "app_version", Type: storage.TypeVersion},
+
+		"region":   {Name: "region", Type: storage.TypeRegion},
+		"city":     {Name: "city", Type: storage.TypeCity},
+		"location": {Name: "location", Type: storage.TypePoint},
+
+		"lang": {Name: "lang", Type: storage.TypeLanguage},
+	}
+
+	normalizers = map[string]func(string) string{
+		"":      func(value string) string { return value },
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"trim":  strings.TrimSpace,
+	}
+)
+
+// RuleKey splits an include<param> or exclude<param> rule key into its dimension
+func RuleKey(key string) (dimension string, include bool, ok bool) {
+	if dimension, ok := strings.CutPrefix(key, includePrefix); ok && dimension != "" {
+		return dimension, true, true
+	}
+	if dimension, ok := strings.CutPrefix(key, excludePrefix); ok && dimension != "" {
+		return dimension, false, true
+	}
+	return "", false, false
+}
+
+// Dimension is a registered dimension with its comparison semantics
+type Dimension struct {
+	storage.Dimension
+
+	normalize func(string) string
+	pattern   *regexp.Regexp
+}
+
+// Registry holds the dimensions accepted in requests
+type Registry struct {
+	names      []string
+	dimensions map[string]*Dimension
+}
+
+// New creates a Registry of dimensions. Dimensions without a type get the built-in
+// defaults of their name, or are exact string dimensions when there is none.
+// Unknown types and normalizers fall back to exact strings.
+func New(dimensions []storage.Dimension) *Registry {
+	r := &Registry{dimensions: make(map[string]*Dimension, len(dimensions))}
+	for _, d := range dimensions {
+		if _, ok := r.dimensions[d.Name]; ok {
+			continue
+		}
+		r.names = append(r.names, d.Name)
+		r.dimensions[d.Name] = newDimension(d)
+	}
+	return r
+}
+
+func newDimension(d storage.Dimension) *Dimension {
+	if d.Type == "" {
+		if builtin, ok := builtins[d.Name]; ok {
+			d = builtin
+		} else {
+			d.Type = storage.TypeString
+		}
+	}
+
+	switch d.Type {
+	case storage.TypeString, storage.TypeEnum, storage.TypeVersion, storage.TypeInt, storage.TypeCIDR, storage.TypeGeo,
+		storage.TypeRegion, storage.TypeCity, storage.TypePoint, storage.TypeLanguage:
+	default:
+		d.Type = storage.TypeString
+	}
+
+	normalize, ok := normalizers[d.Normalizer]
+	if !ok {
+		normalize = normalizers[""]
+	}
+	switch base := normalize; d.Type {
+	case storage.TypeEnum, storage.TypeGeo:
+		normalize = func(value string) string { return strings.ToLower(base(value)) }
+	case storage.TypeRegion, storage.TypeLanguage:
+		normalize = func(value string) string { return strings.ToLower(strings.TrimSpace(base(value))) }
+	case storage.TypeCity:
+		normalize = func(value string) string { return normalizeCity(base(value)) }
+	}
+
+	dimension := &Dimension{Dimension: d, normalize: normalize}
+	if d.Pattern != "" {
+		dimension.pattern, _ = regexp.Compile(d.Pattern)
+	}
+	return dimension
+}
+
+// Names returns the names of the dimensions in registration order
+func (r *Registry) Names() []string {
+	return r.names
+}
+
+// Get returns a registered dimension
+func (r *Registry) Get(name string) (*Dimension, bool) {
+	d, ok := r.dimensions[name]
+	return d, ok
+}
+
+// Lookup returns a registered dimension, or an exact string dimension for other names
+func (r *Registry) Lookup(name string) *Dimension {
+	if d, ok := r.dimensions[name]; ok {
+		return d
+	}
+	return newDimension(storage.Dimension{Name: name, Type: storage.TypeString})
+}
+
+// Required returns the names of the required dimensions
+func (r *Registry) Required() []string {
+	var required []string
+	for _, name := range r.names {
+		if r.dimensions[name].Required {
+			required = append(required, name)
+		}
+	}
+	return required
+}
+
+// Accepts reports whether rules accept every parameter, params being normalized.
+// A campaign accepts a value when it has no include rule for the dimension or the
+// include rule matches the value, and its exclude rule (if any) does not match it.
+// Include rules of strict dimensions also reject requests without a value.
+func (r *Registry) Accepts(rules map[string][]string, params map[string]string) bool {
+	for key, values := range rules {
+		name, include, ok := RuleKey(key)
+		if !ok {
+			continue
+		}
+		value, ok := params[name]
+		if !ok {
+			if include && r.Lookup(name).Strict() {
+				return false
+			}
+			continue
+		}
+		if r.Lookup(name).Matcher(values)(value) != include {
+			return false
+		}
+	}
+	return true
+}
+
+// Indexed reports whether the dimension compares normalized values for equality,
+// its rules can then be looked up by value
+func (d *Dimension) Indexed() bool {
+	switch d.Type {
+	case storage.TypeVersion, storage.TypeInt, storage.TypeCIDR, storage.TypePoint, storage.TypeLanguage:
+		return false
+	}
+	return true
+}
+
+// Strict reports whether include rules of the dimension reject requests without a value
+// for it. Sub-country locations are strict, so that a campaign targeting a region, city
+// or area is not delivered to the whole country when the location is unknown.
+func (d *Dimension) Strict() bool {
+	switch d.Type {
+	case storage.TypeRegion, storage.TypeCity, storage.TypePoint:
+		return true
+	}
+	return false
+}
+
+// CaseInsensitive reports whether values of the dimension are compared regardless of case
+func (d *Dimension) CaseInsensitive() bool {
+	switch d.Type {
+	case storage.TypeEnum, storage.TypeGeo, storage.TypeRegion, storage.TypeCity, storage.TypeLanguage:
+		return true
+	}
+	return d.Normalizer == "lower" || d.Normalizer == "upper"
+}
+
+// Verbatim reports whether rule values are compared as they are written, regardless of
+// case for case-insensitive dimensions, so that stores can match them unnormalized.
+// Trimmed values are not.
+func (d *Dimension) Verbatim() bool {
+	switch d.Type {
+	case storage.TypeRegion, storage.TypeCity, storage.TypeLanguage:
+		return false
+	}
+	return d.Normalizer != "trim"
+}
+
+// Normalize returns the canonical form of a request value, or an error when the
+// value is not of the dimension type
+func (d *Dimension) Normalize(value string) (string, error) {
+	value = d.normalize(value)
+
+	switch d.Type {
+	case storage.TypeVersion:
+		version, err := ParseVersion(value)
+		if err != nil {
+			return "", err
+		}
+		return version.String(), nil
+
+	case storage.TypeInt:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "", errors.New("not an integer")
+		}
+		return strconv.Itoa(n), nil
+
+	case storage.TypeCIDR:
+		addr, err := netip.ParseAddr(strings.TrimSpace(value))
+		if err != nil {
+			return "", errors.New("not an ip address")
+		}
+		return addr.Unmap().String(), nil
+
+	case storage.TypeGeo:
+		if !IsCountryCode(value) {
+			return "", errors.New("not an ISO 3166-1 alpha-2 country code")
+		}
+
+	case storage.TypeRegion:
+		if !IsRegionCode(value) {
+			return "", errors.New("not an ISO 3166-2 region code")
+		}
+
+	case storage.TypeCity:
+		if value == "" {
+			return "", errors.New("not a city name")
+		}
+
+	case storage.TypeLanguage:
+		if !locale.IsTag(value) {
+			return "", errors.New("not a BCP 47 language tag")
+		}
+
+	case storage.TypePoint:
+		point, err := ParsePoint(value)
+		if err != nil {
+			return "", err
+		}
+		return point.String(), nil
+	}
+
+	return value, nil
+}
+
+// IndexValue returns the form of a rule value compared to normalized request values
+// of an indexed dimension
+func (d *Dimension) IndexValue(value string) string {
+	return d.normalize(value)
+}
+
+// Matcher compiles rule values into a function reporting whether a normalized request
+// value matches one of them. Rule values that are not of the dimension type never match.
+func (d *Dimension) Matcher(values []string) func(string) bool {
+	switch d.Type {
+	case storage.TypeVersion:
+		var ranges []VersionRange
+		for _, value := range values {
+			if r, err := ParseVersionRange(d.normalize(value)); err == nil {
+				ranges = append(ranges, r)
+			}
+		}
+		return func(value string) bool {
+			version, err := ParseVersion(value)
+			if err != nil {
+				return false
+			}
+			for _, r := range ranges {
+				if r.Contains(version) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case storage.TypeInt:
+		var ranges [][2]int
+		for _, value := range values {
+			if min, max, err := parseIntRange(d.normalize(value)); err == nil {
+				ranges = append(ranges, [2]int{min, max})
+			}
+		}
+		return func(value string) bool {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return false
+			}
+			for _, r := range ranges {
+				if n >= r[0] && n <= r[1] {
+					return true
+				}
+			}
+			return false
+		}
+
+	case storage.TypeCIDR:
+		var prefixes []netip.Prefix
+		for _, value := range values {
+			if prefix, err := parsePrefix(d.normalize(value)); err == nil {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+		return func(value string) bool {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return false
+			}
+			for _, prefix := range prefixes {
+				if prefix.Contains(addr.Unmap()) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case storage.TypePoint:
+		var circles []Circle
+		for _, value := range values {
+			if circle, err := ParseCircle(d.normalize(value)); err == nil {
+				circles = append(circles, circle)
+			}
+		}
+		return func(value string) bool {
+			point, err := ParsePoint(value)
+			if err != nil {
+				return false
+			}
+			for _, circle := range circles {
+				if circle.Contains(point) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case storage.TypeLanguage:
+		// a tag matches its own rules and those of its prefixes
+		set := make(map[string]struct{}, len(values))
+		for _, value := range values {
+			set[d.normalize(value)] = struct{}{}
+		}
+		return func(value string) bool {
+			for _, tag := range locale.Fallbacks(value) {
+				if _, ok := set[tag]; ok {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[d.IndexValue(value)] = struct{}{}
+	}
+	return func(value string) bool {
+		_, ok := set[value]
+		return ok
+	}
+}
+
+// Check returns why a rule value is not valid for the dimension, empty when it is
+func (d *Dimension) Check(value string) string {
+	if d.pattern != nil && !d.pattern.MatchString(value) {
+		if description, ok := patternDescriptions[d.Pattern]; ok {
+			return description
+		}
+		return "does not match " + d.Pattern
+	}
+
+	if d.Type == storage.TypeCity {
+		if canonical := strings.Join(strings.Fields(value), " "); canonical != value {
+			return "extra spaces, expected " + canonical
+		}
+	}
+
+	value = d.normalize(value)
+	switch d.Type {
+	case storage.TypeEnum:
+		if len(d.Values) > 0 && !utils.ContainsFold(d.Values, value) {
+			return "unknown " + d.Name + ", expected one of " + strings.Join(d.Values, ", ")
+		}
+	case storage.TypeGeo:
+		if !IsCountryCode(value) {
+			return "not an ISO 3166-1 alpha-2 country code"
+		}
+	case storage.TypeRegion:
+		if !IsRegionCode(value) {
+			return "not an ISO 3166-2 region code, like us-ca"
+		}
+	case storage.TypeCity:
+		if value == "" {
+			return "not a city name"
+		}
+	case storage.TypeLanguage:
+		if !locale.IsTag(value) {
+			return "not a BCP 47 language tag, like pt or pt-BR"
+		}
+	case storage.TypePoint:
+		if _, err := ParseCircle(value); err != nil {
+			return err.Error()
+		}
+	case storage.TypeVersion:
+		if _, err := ParseVersionRange(value); err != nil {
+			return "not a version or a version range"
+		}
+	case storage.TypeInt:
+		if _, _, err := parseIntRange(value); err != nil {
+			return err.Error()
+		}
+	case storage.TypeCIDR:
+		if _, err := parsePrefix(value); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// parseIntRange parses an integer or a min-max range of integers, like -5, -10--5 or -5-5
+func parseIntRange(value string) (int, int, error) {
+	errRange := errors.New("not an integer or a min-max range")
+
+	// the range separator is the first hyphen after the sign of min
+	value = strings.TrimSpace(value)
+	sign := 0
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		sign = 1
+	}
+	minValue, maxValue, isRange := strings.Cut(value[sign:], "-")
+	minValue = value[:sign] + minValue
+	if !isRange {
+		maxValue = minValue
+	}
+
+	min, err := strconv.Atoi(strings.TrimSpace(minValue))
+	if err != nil {
+		return 0, 0, errRange
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(maxValue))
+	if err != nil || max < min {
+		return 0, 0, errRange
+	}
+	return min, max, nil
+}
+
+// parsePrefix parses a CIDR block, a single address is a block of one address
+func parsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked(), nil
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+	return netip.Prefix{}, errors.New("not a CIDR block")
+}
@@ -0,0 +1,259 @@
+package dimensions
+
+import (
+	"testing"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flat rules lists get the built-in defaults of app, country and os
+func TestNew1(t *testing.T) {
+	registry := New(storage.DimensionsFromNames([]string{"app", "country", "os", "state"}))
+
+	assert.Equal(t, []string{"app", "country", "os", "state"}, registry.Names())
+	assert.Equal(t, []string{"app", "country", "os"}, registry.Required())
+
+	country, _ := registry.Get("country")
+	assert.Equal(t, storage.TypeGeo, country.Type)
+	state, _ := registry.Get("state")
+	assert.Equal(t, storage.TypeString, state.Type)
+	_, ok := registry.Get("unknown")
+	assert.False(t, ok)
+}
+
+// request values are normalized by type
+func TestNormalize1(t *testing.T) {
+	registry := New([]storage.Dimension{
+		{Name: "os", Type: storage.TypeEnum},
+		{Name: "os_version", Type: storage.TypeVersion},
+		{Name: "age", Type: storage.TypeInt},
+		{Name: "ip", Type: storage.TypeCIDR},
+		{Name: "app", Type: storage.TypeString, Normalizer: "trim"},
+	})
+
+	for name, values := range map[string][2]string{
+		"os":         {"Android", "android"},
+		"os_version": {"v14.2", "14.2.0"},
+		"age":        {" 21", "21"},
+		"ip":         {"::ffff:10.0.0.1", "10.0.0.1"},
+		"app":        {" com.spotify.music ", "com.spotify.music"},
+	} {
+		value, err := registry.Lookup(name).Normalize(values[0])
+		assert.NoError(t, err)
+		assert.Equal(t, values[1], value)
+	}
+
+	for name, value := range map[string]string{"os_version": "latest", "age": "old", "ip": "localhost"} {
+		_, err := registry.Lookup(name).Normalize(value)
+		assert.Error(t, err)
+	}
+}
+
+// rule values are matched by type
+func TestMatcher1(t *testing.T) {
+	registry := New([]storage.Dimension{
+		{Name: "os_version", Type: storage.TypeVersion},
+		{Name: "age", Type: storage.TypeInt},
+		{Name: "ip", Type: storage.TypeCIDR},
+	})
+
+	assert.True(t, registry.Lookup("os_version").Matcher([]string{"14.2"})("14.2.0"))
+	assert.False(t, registry.Lookup("os_version").Matcher([]string{"14.2"})("14.2.1"))
+	assert.True(t, registry.Lookup("age").Matcher([]string{"18-24"})("24"))
+	assert.False(t, registry.Lookup("age").Matcher([]string{"18-24", "not a range"})("25"))
+	assert.True(t, registry.Lookup("ip").Matcher([]string{"10.0.0.0/8", "192.168.1.1"})("192.168.1.1"))
+	assert.False(t, registry.Lookup("ip").Matcher([]string{"10.0.0.0/8"})("11.0.0.1"))
+
+	assert.True(t, registry.Accepts(map[string][]string{"includeage": {"18-24"}, "excludeip": {"10.0.0.0/8"}}, map[string]string{"age": "20", "ip": "11.0.0.1"}))
+	assert.False(t, registry.Accepts(map[string][]string{"includeage": {"18-24"}, "excludeip": {"10.0.0.0/8"}}, map[string]string{"age": "20", "ip": "10.0.0.1"}))
+}
+
+// negative integers and ranges with negative bounds are matched and checked
+func TestMatcher2(t *testing.T) {
+	registry := New([]storage.Dimension{{Name: "offset", Type: storage.TypeInt}})
+	offset := registry.Lookup("offset")
+
+	assert.True(t, offset.Matcher([]string{"-5"})("-5"))
+	assert.False(t, offset.Matcher([]string{"-5"})("5"))
+	assert.True(t, offset.Matcher([]string{"-10--5"})("-7"))
+	assert.False(t, offset.Matcher([]string{"-10--5"})("-4"))
+	assert.True(t, offset.Matcher([]string{"-5-5"})("0"))
+	assert.True(t, offset.Matcher([]string{" -5 - 5 "})("5"))
+	assert.False(t, offset.Matcher([]string{"-5-5"})("6"))
+
+	assert.Empty(t, offset.Check("-10--5"))
+	assert.Empty(t, offset.Check("+3"))
+	assert.NotEmpty(t, offset.Check("-5--10"))
+	assert.NotEmpty(t, offset.Check("--5"))
+	assert.NotEmpty(t, offset.Check("-"))
+}
+
+// rule values are checked by type
+func TestCheck1(t *testing.T) {
+	registry := New(storage.DimensionsFromNames([]string{"app", "country", "os"}))
+
+	assert.Empty(t, registry.Lookup("app").Check("com.spotify.music"))
+	assert.NotEmpty(t, registry.Lookup("app").Check("spotify music"))
+	assert.Empty(t, registry.Lookup("os").Check("iOS"))
+	assert.NotEmpty(t, registry.Lookup("os").Check("symbian"))
+	assert.Empty(t, registry.Lookup("country").Check("GB"))
+	assert.NotEmpty(t, registry.Lookup("country").Check("uk"))
+}
+
+// regions, cities and areas are normalized, matched and checked, their include rules need a value
+func TestGeo1(t *testing.T) {
+	registry := New(storage.DimensionsFromNames([]string{"country", "region", "city", "location"}))
+
+	for name, values := range map[string][2]string{
+		"region":   {" US-CA", "us-ca"},
+		"city":     {"  San   Francisco ", "san francisco"},
+		"location": {"48.85660, 2.3522", "48.8566,2.3522"},
+	} {
+		normalized, err := registry.Lookup(name).Normalize(values[0])
+		assert.NoError(t, err)
+		assert.Equal(t, values[1], normalized, name)
+	}
+	_, err := registry.Lookup("region").Normalize("california")
+	assert.Error(t, err)
+	_, err = registry.Lookup("location").Normalize("91,0")
+	assert.Error(t, err)
+
+	assert.True(t, registry.Lookup("region").Matcher([]string{"US-CA"})("us-ca"))
+	assert.True(t, registry.Lookup("city").Matcher([]string{"San Francisco"})("san francisco"))
+	paris := registry.Lookup("location").Matcher([]string{"48.8566,2.3522,25km", "not an area"})
+	assert.True(t, paris("48.8049,2.1204"))  // Versailles, 17km
+	assert.False(t, paris("49.4431,1.0993")) // Rouen, 112km
+	assert.True(t, registry.Lookup("location").Matcher([]string{"51.5007,-0.1246,500m"})("51.4994,-0.1273"))
+	assert.False(t, registry.Lookup("location").Matcher([]string{"51.5007,-0.1246,500m"})("51.5014,-0.1419"))
+
+	assert.Empty(t, registry.Lookup("region").Check("GB-ENG"))
+	assert.NotEmpty(t, registry.Lookup("region").Check("XX-ENG"))
+	assert.Empty(t, registry.Lookup("city").Check("San Francisco"))
+	assert.Equal(t, "extra spaces, expected San Francisco", registry.Lookup("city").Check("San  Francisco"))
+	assert.Empty(t, registry.Lookup("location").Check("48.8566,2.3522,25"))
+	assert.NotEmpty(t, registry.Lookup("location").Check("48.8566,2.3522,-1km"))
+
+	rules := map[string][]string{"includeregion": {"us-ca"}, "excludecity": {"fresno"}}
+	assert.True(t, registry.Accepts(rules, map[string]string{"country": "us", "region": "us-ca"}))
+	assert.False(t, registry.Accepts(rules, map[string]string{"country": "us", "region": "us-ca", "city": "fresno"}))
+	assert.False(t, registry.Accepts(rules, map[string]string{"country": "us"}))
+	assert.True(t, registry.Accepts(map[string][]string{"excludecity": {"fresno"}}, map[string]string{"country": "us"}))
+}
+
+// versions compare numerically, pre-releases before releases
+func TestVersionCompare1(t *testing.T) {
+	parse := func(value string) Version {
+		version, err := ParseVersion(value)
+		assert.NoError(t, err)
+		return version
+	}
+
+	assert.Equal(t, -1, parse("3.9").Compare(parse("3.10")))
+	assert.Equal(t, 0, parse("v14").Compare(parse("14.0.0")))
+	assert.Equal(t, -1, parse("3.1.0-beta").Compare(parse("3.1.0")))
+	assert.Equal(t, 1, parse("3.1.0+build.5").Compare(parse("3.1.0-rc.1")))
+
+	_, err := ParseVersion("1.2.3.4")
+	assert.Error(t, err)
+}
+
+// pre-release identifiers compare in order, numeric ones as numbers (SemVer 2.0.0 §11)
+func TestVersionCompare2(t *testing.T) {
+	for _, test := range []struct {
+		v, o string
+		want int
+	}{
+		{"3.1.0-beta.2", "3.1.0-beta.10", -1},
+		{"3.1.0-beta.10", "3.1.0-beta.2", 1},
+		{"3.1.0-alpha", "3.1.0-alpha.1", -1},
+		{"3.1.0-alpha.1", "3.1.0-alpha", 1},
+		{"3.1.0-alpha.1", "3.1.0-alpha.beta", -1},
+		{"3.1.0-alpha.beta", "3.1.0-beta", -1},
+		{"3.1.0-beta.11", "3.1.0-rc.1", -1},
+		{"3.1.0-1", "3.1.0-alpha", -1},
+		{"3.1.0-rc.1", "3.1.0-rc.1", 0},
+	} {
+		v, err := ParseVersion(test.v)
+		assert.NoError(t, err)
+		o, err := ParseVersion(test.o)
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, v.Compare(o), test.v+" vs "+test.o)
+	}
+
+	versionRange, err := ParseVersionRange(">=3.1.0-beta.2 <3.1.0")
+	assert.NoError(t, err)
+	assert.True(t, versionRange.Contains(Version{Major: 3, Minor: 1, Pre: "beta.10"}))
+}
+
+// version ranges: comparators, wildcards, hyphen ranges, caret, tilde and alternatives
+func TestVersionRange1(t *testing.T) {
+	contains := func(r, v string) bool {
+		versionRange, err := ParseVersionRange(r)
+		assert.NoError(t, err)
+		version, err := ParseVersion(v)
+		assert.NoError(t, err)
+		return versionRange.Contains(version)
+	}
+
+	assert.True(t, contains(">=14.2", "14.2.0"))
+	assert.True(t, contains(">=14.2", "17"))
+	assert.False(t, contains(">=14.2", "14.1.9"))
+	assert.True(t, contains(">=14.2 <15", "14.9"))
+	assert.False(t, contains(">=14.2 <15", "15.0.0"))
+	assert.True(t, contains("3.1.0 - 3.4.x", "3.4.12"))
+	assert.False(t, contains("3.1.0 - 3.4.x", "3.5.0"))
+	assert.False(t, contains("3.1.0 - 3.4.x", "3.0.9"))
+	assert.True(t, contains("3.4.x", "3.4.1"))
+	assert.True(t, contains("3.*", "3.9.0"))
+	assert.False(t, contains("3.*", "4.0.0"))
+	assert.True(t, contains("^3.1", "3.9.9"))
+	assert.False(t, contains("^3.1", "4.0.0"))
+	assert.True(t, contains("~3.1.2", "3.1.5"))
+	assert.False(t, contains("~3.1.2", "3.2.0"))
+	assert.True(t, contains(">15", "16.0.0"))
+	assert.False(t, contains(">15", "15.3.0"))
+	assert.True(t, contains("<=15", "15.3.0"))
+	assert.True(t, contains("<13 || >=16", "16.1"))
+	assert.False(t, contains("<13 || >=16", "14"))
+	assert.True(t, contains("14.2", "14.2.0"))
+	assert.False(t, contains("14.2", "14.2.1"))
+	assert.True(t, contains("*", "1.0.0"))
+
+	for _, r := range []string{"", ">=latest", "1.2.3.4", "1.x - "} {
+		_, err := ParseVersionRange(r)
+		assert.Error(t, err, r)
+	}
+}
+
+// country codes are checked in any case
+func TestIsCountryCode1(t *testing.T) {
+	assert.True(t, IsCountryCode("us"))
+	assert.True(t, IsCountryCode("GB"))
+	assert.False(t, IsCountryCode("uk"))
+	assert.False(t, IsCountryCode("campaigns_details"))
+}
+
+// languages are normalized and checked as BCP 47 tags, rules match their longer tags
+func TestLanguage1(t *testing.T) {
+	registry := New(storage.DimensionsFromNames([]string{"app", "country", "os", "lang"}))
+
+	lang, _ := registry.Get("lang")
+	assert.Equal(t, storage.TypeLanguage, lang.Type)
+	assert.False(t, lang.Indexed())
+
+	value, err := lang.Normalize(" pt-BR")
+	assert.NoError(t, err)
+	assert.Equal(t, "pt-br", value)
+	_, err = lang.Normalize("portuguese")
+	assert.Error(t, err)
+
+	assert.True(t, lang.Matcher([]string{"pt"})("pt-br"))
+	assert.True(t, lang.Matcher([]string{"pt-BR"})("pt-br"))
+	assert.False(t, lang.Matcher([]string{"pt-BR"})("pt"))
+	assert.False(t, lang.Matcher([]string{"pt"})("en"))
+
+	assert.Empty(t, lang.Check("zh-Hant"))
+	assert.NotEmpty(t, lang.Check("pt_BR"))
+}
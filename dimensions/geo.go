@@ -0,0 +1,120 @@
+package dimensions
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// earthRadius is the mean radius of the earth in kilometers
+const earthRadius = 6371.0088
+
+// regionPattern matches ISO 3166-2 subdivision codes, lower case
+var regionPattern = regexp.MustCompile(`^([a-z]{2})-[a-z0-9]{1,3}$`)
+
+// Point is a position in decimal degrees
+type Point struct {
+	Lat, Long float64
+}
+
+// Circle is the area within Radius kilometers of Center
+type Circle struct {
+	Center Point
+	Radius float64
+}
+
+// IsRegionCode reports whether code is an ISO 3166-2 subdivision code of an ISO 3166-1
+// country, like US-CA or GB-ENG, in any case
+func IsRegionCode(code string) bool {
+	_, ok := RegionCountry(code)
+	return ok
+}
+
+// RegionCountry returns the lower case country code of an ISO 3166-2 subdivision code
+func RegionCountry(code string) (string, bool) {
+	match := regionPattern.FindStringSubmatch(strings.ToLower(code))
+	if match == nil || !IsCountryCode(match[1]) {
+		return "", false
+	}
+	return match[1], true
+}
+
+// normalizeCity returns the canonical form of a city name: lower case, single spaced
+func normalizeCity(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// ParsePoint parses a lat,long position in decimal degrees
+func ParsePoint(value string) (Point, error) {
+	errPoint := errors.New("not a lat,long position")
+
+	lat, long, ok := strings.Cut(value, ",")
+	if !ok {
+		return Point{}, errPoint
+	}
+	p, err := parsePoint(lat, long)
+	if err != nil {
+		return Point{}, errPoint
+	}
+	return p, nil
+}
+
+// ParseCircle parses a lat,long,radius area, the radius in kilometers with an optional
+// km suffix, or in meters with an m suffix
+func ParseCircle(value string) (Circle, error) {
+	errCircle := errors.New("not a lat,long,radius area, like 48.8566,2.3522,25km")
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return Circle{}, errCircle
+	}
+	center, err := parsePoint(parts[0], parts[1])
+	if err != nil {
+		return Circle{}, errCircle
+	}
+
+	radius, scale := strings.TrimSpace(parts[2]), 1.0
+	if r, ok := strings.CutSuffix(radius, "km"); ok {
+		radius = r
+	} else if r, ok := strings.CutSuffix(radius, "m"); ok {
+		radius, scale = r, 0.001
+	}
+	km, err := strconv.ParseFloat(strings.TrimSpace(radius), 64)
+	if err != nil || km <= 0 || math.IsInf(km, 0) {
+		return Circle{}, errCircle
+	}
+	return Circle{Center: center, Radius: km * scale}, nil
+}
+
+func parsePoint(lat, long string) (Point, error) {
+	var p Point
+	var err error
+	if p.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil || p.Lat < -90 || p.Lat > 90 {
+		return Point{}, errors.New("latitude out of range")
+	}
+	if p.Long, err = strconv.ParseFloat(strings.TrimSpace(long), 64); err != nil || p.Long < -180 || p.Long > 180 {
+		return Point{}, errors.New("longitude out of range")
+	}
+	return p, nil
+}
+
+// String formats p as lat,long
+func (p Point) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Long, 'f', -1, 64)
+}
+
+// Distance returns the great circle distance between p and q in kilometers
+func (p Point) Distance(q Point) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, q.Lat*math.Pi/180
+	dLat, dLong := lat2-lat1, (q.Long-p.Long)*math.Pi/180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Contains reports whether p is within the circle
+func (c Circle) Contains(p Point) bool {
+	return c.Center.Distance(p) <= c.Radius
+}
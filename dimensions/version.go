@@ -0,0 +1,295 @@
+package dimensions
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidVersion = errors.New("not a semantic version")
+
+// Version is a semantic version, missing minor and patch numbers are 0
+type Version struct {
+	Major, Minor, Patch int
+	// Pre is the pre-release part, a version with one sorts before the release
+	Pre string
+}
+
+// ParseVersion parses versions like 14, 14.2, v3.1.0 or 3.1.0-beta.1, build metadata is ignored
+func ParseVersion(value string) (Version, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	value, _, _ = strings.Cut(value, "+")
+	value, pre, _ := strings.Cut(value, "-")
+
+	parts := strings.Split(value, ".")
+	if len(parts) > 3 {
+		return Version{}, errInvalidVersion
+	}
+
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, errInvalidVersion
+		}
+		numbers[i] = n
+	}
+
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Pre: pre}, nil
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or greater than o
+func (v Version) Compare(o Version) int {
+	for _, d := range [3]int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(strings.Split(v.Pre, "."), strings.Split(o.Pre, "."))
+}
+
+// comparePre compares dot separated pre-release identifiers in order: numeric ones as
+// numbers and before alphanumeric ones, the shorter list first when one is a prefix of
+// the other (SemVer 2.0.0 §11)
+func comparePre(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, errX := strconv.ParseUint(a[i], 10, 64)
+		y, errY := strconv.ParseUint(b[i], 10, 64)
+		switch {
+		case errX == nil && errY == nil:
+			if x != y {
+				return compareInts(x, y)
+			}
+		case errX == nil:
+			return -1
+		case errY == nil:
+			return 1
+		case a[i] != b[i]:
+			return strings.Compare(a[i], b[i])
+		}
+	}
+	return compareInts(uint64(len(a)), uint64(len(b)))
+}
+
+func compareInts(x, y uint64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// String returns the version in major.minor.patch form
+func (v Version) String() string {
+	s := strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// VersionRange is a set of version constraints: comparators separated by spaces must
+// all hold, alternatives are separated by ||
+type VersionRange [][]versionConstraint
+
+type versionConstraint struct {
+	op      string
+	version Version
+}
+
+// ParseVersionRange parses version ranges:
+//
+//	14.2            exactly 14.2.0
+//	>=14.2 <15      comparators, also >, <=, < and =, >15 and <=15 stand for any 15.x
+//	3.4.x  3.*      any version of 3.4 or 3
+//	3.1.0 - 3.4.x   inclusive bounds, a partial upper bound covers all its versions
+//	^3.1  ~3.1.2    compatible with 3.1 (<4.0.0) and with 3.1.2 (<3.2.0)
+func ParseVersionRange(value string) (VersionRange, error) {
+	var r VersionRange
+	for _, alternative := range strings.Split(value, "||") {
+		constraints, err := parseConstraints(strings.TrimSpace(alternative))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, constraints)
+	}
+	return r, nil
+}
+
+// Contains reports whether v satisfies one of the alternatives of the range
+func (r VersionRange) Contains(v Version) bool {
+	for _, constraints := range r {
+		satisfied := true
+		for _, c := range constraints {
+			if !c.holds(v) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+func (c versionConstraint) holds(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp == 0
+	}
+}
+
+func parseConstraints(value string) ([]versionConstraint, error) {
+	if value == "" {
+		return nil, errInvalidVersion
+	}
+
+	if lower, upper, ok := strings.Cut(value, " - "); ok {
+		from, _, _, err := parsePartialVersion(strings.TrimSpace(lower))
+		if err != nil {
+			return nil, err
+		}
+		to, parts, wildcard, err := parsePartialVersion(strings.TrimSpace(upper))
+		if err != nil {
+			return nil, err
+		}
+		constraints := []versionConstraint{{op: ">=", version: from}}
+		if wildcard || parts < 3 {
+			if parts > 0 {
+				constraints = append(constraints, versionConstraint{op: "<", version: bump(to, parts)})
+			}
+		} else {
+			constraints = append(constraints, versionConstraint{op: "<=", version: to})
+		}
+		return constraints, nil
+	}
+
+	var constraints []versionConstraint
+	for _, field := range strings.Fields(value) {
+		op := ""
+		for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			if rest, ok := strings.CutPrefix(field, prefix); ok {
+				op, field = prefix, rest
+				break
+			}
+		}
+
+		v, parts, wildcard, err := parsePartialVersion(field)
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, expand(op, v, parts, wildcard)...)
+	}
+	return constraints, nil
+}
+
+// expand turns a comparator on a partial version into constraints on full versions
+func expand(op string, v Version, parts int, wildcard bool) []versionConstraint {
+	if wildcard && parts == 0 {
+		// * matches any version
+		return nil
+	}
+
+	switch op {
+	case "", "=":
+		if !wildcard {
+			return []versionConstraint{{op: "=", version: v}}
+		}
+		return []versionConstraint{{op: ">=", version: v}, {op: "<", version: bump(v, parts)}}
+	case ">":
+		if wildcard || parts < 3 {
+			return []versionConstraint{{op: ">=", version: bump(v, parts)}}
+		}
+		return []versionConstraint{{op: ">", version: v}}
+	case "<=":
+		if wildcard || parts < 3 {
+			return []versionConstraint{{op: "<", version: bump(v, parts)}}
+		}
+		return []versionConstraint{{op: "<=", version: v}}
+	case "^":
+		switch {
+		case v.Major > 0 || parts == 1:
+			return []versionConstraint{{op: ">=", version: v}, {op: "<", version: bump(v, 1)}}
+		case v.Minor > 0 || parts == 2:
+			return []versionConstraint{{op: ">=", version: v}, {op: "<", version: bump(v, 2)}}
+		default:
+			return []versionConstraint{{op: ">=", version: v}, {op: "<", version: bump(v, 3)}}
+		}
+	case "~":
+		if parts == 1 {
+			return []versionConstraint{{op: ">=", version: v}, {op: "<", version: bump(v, 1)}}
+		}
+		return []versionConstraint{{op: ">=", version: v}, {op: "<", version: bump(v, 2)}}
+	default:
+		return []versionConstraint{{op: op, version: v}}
+	}
+}
+
+// bump returns the first version after every version sharing the first parts numbers of v
+func bump(v Version, parts int) Version {
+	switch parts {
+	case 1:
+		return Version{Major: v.Major + 1}
+	case 2:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+}
+
+// parsePartialVersion parses a version whose trailing numbers may be missing or x/*
+// wildcards, it returns the number of numbers given before the first wildcard
+func parsePartialVersion(value string) (Version, int, bool, error) {
+	core := strings.TrimPrefix(value, "v")
+	core, _, _ = strings.Cut(core, "+")
+	core, _, _ = strings.Cut(core, "-")
+
+	fields := strings.Split(core, ".")
+	if len(fields) > 3 {
+		return Version{}, 0, false, errInvalidVersion
+	}
+
+	for i, field := range fields {
+		if field != "x" && field != "X" && field != "*" {
+			continue
+		}
+		if i == 0 {
+			return Version{}, 0, true, nil
+		}
+		v, err := ParseVersion(strings.Join(fields[:i], "."))
+		if err != nil {
+			return Version{}, 0, false, err
+		}
+		return v, i, true, nil
+	}
+
+	v, err := ParseVersion(value)
+	if err != nil {
+		return Version{}, 0, false, err
+	}
+	return v, len(fields), false, nil
+}
@@ -0,0 +1,269 @@
+package endpoints
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"strings"
+	"time"
+
+	local_error "delivery-service/errors"
+	"delivery-service/service"
+	"delivery-service/storage"
+	"delivery-service/validation"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/log/level"
+)
+
+// CampaignIDRequest addresses a single campaign
+type CampaignIDRequest struct {
+	ID string
+}
+
+// CampaignRequest carries a campaign payload
+type CampaignRequest struct {
+	Campaign service.CampaignDetails
+}
+
+// RulesRequest carries the include/exclude rules of a campaign
+type RulesRequest struct {
+	ID    string
+	Rules map[string][]string
+}
+
+// SegmentRequest addresses a single segment
+type SegmentRequest struct {
+	Name string
+}
+
+// UploadSegmentRequest carries the members of a segment, one value of Dimension per line
+type UploadSegmentRequest struct {
+	Name      string
+	Dimension string
+	Members   io.Reader
+}
+
+// PlacementRequest addresses a single placement
+type PlacementRequest struct {
+	ID string
+}
+
+// SavePlacementRequest carries a placement payload
+type SavePlacementRequest struct {
+	Placement storage.Placement
+}
+
+// CampaignResponse represents the response for the single campaign admin APIs
+type CampaignResponse struct {
+	Campaign service.CampaignDetails `json:"campaign"`
+}
+
+// CampaignsResponse represents the response for the campaign listing admin API
+type CampaignsResponse struct {
+	Campaigns []service.CampaignDetails `json:"campaigns"`
+}
+
+// ValidateResponse represents the response for the rules validation admin API
+type ValidateResponse struct {
+	Valid  bool               `json:"valid"`
+	Issues []validation.Issue `json:"issues"`
+}
+
+// SegmentsResponse represents the response for the segment listing admin API
+type SegmentsResponse struct {
+	Segments []storage.Segment `json:"segments"`
+}
+
+// PlacementsResponse represents the response for the placement listing admin API
+type PlacementsResponse struct {
+	Placements []storage.Placement `json:"placements"`
+}
+
+// PlacementResponse represents the response for the placement saving admin API
+type PlacementResponse struct {
+	Placement storage.Placement `json:"placement"`
+}
+
+// CreatedResponse wraps the response of a request that created a resource
+type CreatedResponse struct {
+	Response interface{}
+}
+
+// EmptyResponse represents the response of admin APIs without content
+type EmptyResponse struct{}
+
+// AdminEndpoints collects the campaign management endpoints
+type AdminEndpoints struct {
+	ListCampaigns      endpoint.Endpoint
+	GetCampaign        endpoint.Endpoint
+	CreateCampaign     endpoint.Endpoint
+	UpdateCampaign     endpoint.Endpoint
+	UpdateRules        endpoint.Endpoint
+	ActivateCampaign   endpoint.Endpoint
+	DeactivateCampaign endpoint.Endpoint
+	DeleteCampaign     endpoint.Endpoint
+	Validate           endpoint.Endpoint
+	ListSegments       endpoint.Endpoint
+	UploadSegment      endpoint.Endpoint
+	DeleteSegment      endpoint.Endpoint
+	ListPlacements     endpoint.Endpoint
+	SavePlacement      endpoint.Endpoint
+	DeletePlacement    endpoint.Endpoint
+}
+
+// MakeAdminEndpoints creates the campaign management endpoints, each requiring the bearer token
+func MakeAdminEndpoints(svc service.AdminService, token string) AdminEndpoints {
+	auth := MakeAuthMiddleware(token)
+
+	return AdminEndpoints{
+		ListCampaigns: auth(logged("ListCampaignsEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			campaigns, err := svc.ListCampaigns(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return CampaignsResponse{Campaigns: campaigns}, nil
+		})),
+		GetCampaign: auth(logged("GetCampaignEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(CampaignIDRequest)
+			campaign, err := svc.GetCampaign(ctx, req.ID)
+			if err != nil {
+				return nil, err
+			}
+			return CampaignResponse{Campaign: campaign}, nil
+		})),
+		CreateCampaign: auth(logged("CreateCampaignEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(CampaignRequest)
+			campaign, err := svc.CreateCampaign(ctx, req.Campaign)
+			if err != nil {
+				return nil, err
+			}
+			return CreatedResponse{Response: CampaignResponse{Campaign: campaign}}, nil
+		})),
+		UpdateCampaign: auth(logged("UpdateCampaignEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(CampaignRequest)
+			campaign, err := svc.UpdateCampaign(ctx, req.Campaign)
+			if err != nil {
+				return nil, err
+			}
+			return CampaignResponse{Campaign: campaign}, nil
+		})),
+		UpdateRules: auth(logged("UpdateRulesEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(RulesRequest)
+			campaign, err := svc.UpdateRules(ctx, req.ID, req.Rules)
+			if err != nil {
+				return nil, err
+			}
+			return CampaignResponse{Campaign: campaign}, nil
+		})),
+		ActivateCampaign:   auth(logged("ActivateCampaignEndpoint", makeSetActiveEndpoint(svc, true))),
+		DeactivateCampaign: auth(logged("DeactivateCampaignEndpoint", makeSetActiveEndpoint(svc, false))),
+		DeleteCampaign: auth(logged("DeleteCampaignEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(CampaignIDRequest)
+			if err := svc.DeleteCampaign(ctx, req.ID); err != nil {
+				return nil, err
+			}
+			return EmptyResponse{}, nil
+		})),
+		Validate: auth(logged("ValidateEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			issues, err := svc.Validate(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if issues == nil {
+				issues = []validation.Issue{}
+			}
+			return ValidateResponse{Valid: len(issues) == 0, Issues: issues}, nil
+		})),
+		ListSegments: auth(logged("ListSegmentsEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			segments, err := svc.ListSegments(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if segments == nil {
+				segments = []storage.Segment{}
+			}
+			return SegmentsResponse{Segments: segments}, nil
+		})),
+		UploadSegment: auth(logged("UploadSegmentEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(UploadSegmentRequest)
+			return svc.UploadSegment(ctx, req.Name, req.Dimension, req.Members)
+		})),
+		DeleteSegment: auth(logged("DeleteSegmentEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(SegmentRequest)
+			if err := svc.DeleteSegment(ctx, req.Name); err != nil {
+				return nil, err
+			}
+			return EmptyResponse{}, nil
+		})),
+		ListPlacements: auth(logged("ListPlacementsEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			placements, err := svc.ListPlacements(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if placements == nil {
+				placements = []storage.Placement{}
+			}
+			return PlacementsResponse{Placements: placements}, nil
+		})),
+		SavePlacement: auth(logged("SavePlacementEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(SavePlacementRequest)
+			placement, err := svc.SavePlacement(ctx, req.Placement)
+			if err != nil {
+				return nil, err
+			}
+			return PlacementResponse{Placement: placement}, nil
+		})),
+		DeletePlacement: auth(logged("DeletePlacementEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(PlacementRequest)
+			if err := svc.DeletePlacement(ctx, req.ID); err != nil {
+				return nil, err
+			}
+			return EmptyResponse{}, nil
+		})),
+	}
+}
+
+// MakeAuthMiddleware rejects requests whose Authorization header is not "Bearer <token>".
+// Every request is rejected when token is empty.
+func MakeAuthMiddleware(token string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			method, _ := ctx.Value(httptransport.ContextKeyRequestMethod).(string)
+			header, _ := ctx.Value(httptransport.ContextKeyRequestAuthorization).(string)
+
+			provided, ok := strings.CutPrefix(header, "Bearer ")
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				level.Error(logger).Log("method", "AuthMiddleware", "err", "unauthorized request")
+				return nil, &local_error.ErrUnauthorized{Method: method}
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+func makeSetActiveEndpoint(svc service.AdminService, active bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(CampaignIDRequest)
+		campaign, err := svc.SetActive(ctx, req.ID, active)
+		if err != nil {
+			return nil, err
+		}
+		return CampaignResponse{Campaign: campaign}, nil
+	}
+}
+
+// logged logs the outcome and duration of an endpoint call
+func logged(name string, next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		start := time.Now()
+		response, err := next(ctx, request)
+		if err != nil {
+			level.Error(logger).Log("method", name, "err", err, "took", time.Since(start))
+			return nil, err
+		}
+		level.Info(logger).Log("method", name, "took", time.Since(start))
+		return response, nil
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"time"
 
+	"delivery-service/geo"
 	"delivery-service/metrics"
 
 	"github.com/go-kit/kit/endpoint"
@@ -27,13 +28,28 @@ func init() {
 // GetCampaignsRequest is the struct for incoming request parameters
 type GetCampaignsRequest struct {
 	Params map[string]string
+	// UserID is the user_id or device_id query parameter
+	UserID string
 	Limit  int
 	Page   int
+	// Cursor is the next_cursor of a previous response, it takes precedence over Page
+	Cursor string
 }
 
 // GetCampaignsResponse represents the response for the GetCampaigns API
 type GetCampaignsResponse struct {
 	Campaigns []service.Campaign
+	// Country is the country campaigns were targeted on
+	Country *Country `json:"country,omitempty"`
+	// NextCursor fetches the next page, it is left out on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Country is the country of a request and whether the client supplied it or it was
+// inferred from the client ip
+type Country struct {
+	Code   string `json:"code"`
+	Source string `json:"source"`
 }
 
 // MakeGetCampaignsEndpoint creates an endpoint for the GetCampaigns service
@@ -43,7 +59,7 @@ func MakeGetCampaignsEndpoint(svc service.Service) endpoint.Endpoint {
 		req := request.(GetCampaignsRequest)
 		start := time.Now()
 
-		campaigns, err := svc.GetCampaigns(ctx, req.Params, req.Limit, req.Page)
+		campaigns, next, err := svc.GetCampaignsPage(ctx, req.Params, req.UserID, service.Page{Limit: req.Limit, Offset: req.Page, Cursor: req.Cursor})
 		if err != nil {
 			level.Error(logger).Log("method", "GetCampaignsEndpoint", "err", err, "took", time.Since(start))
 			return nil, err
@@ -51,6 +67,77 @@ func MakeGetCampaignsEndpoint(svc service.Service) endpoint.Endpoint {
 
 		level.Info(logger).Log("method", "GetCampaignsEndpoint", "took", time.Since(start))
 		metrics.HttpRequestLatency.Observe(time.Since(start).Seconds())
-		return GetCampaignsResponse{Campaigns: campaigns}, nil
+		return GetCampaignsResponse{Campaigns: campaigns, Country: requestCountry(ctx, req.Params), NextCursor: next}, nil
+	}
+}
+
+// BatchRequest requests campaigns for several placements of the same targeting context
+type BatchRequest struct {
+	// Context holds the targeting parameters shared by the placements
+	Context  map[string]string `json:"context"`
+	UserID   string            `json:"userId"`
+	DeviceID string            `json:"deviceId"`
+	// Placements are filled in order, each with up to Limit campaigns
+	Placements []BatchPlacement `json:"placements"`
+	// AllowDuplicates lets a campaign be returned in several placements
+	AllowDuplicates bool `json:"allowDuplicates"`
+}
+
+// BatchPlacement is a placement of a BatchRequest
+type BatchPlacement struct {
+	ID    string `json:"id"`
+	Limit int    `json:"limit"`
+}
+
+// BatchResponse represents the response for the batch delivery API
+type BatchResponse struct {
+	Placements []PlacementCampaigns `json:"placements"`
+	// Country is the country campaigns were targeted on
+	Country *Country `json:"country,omitempty"`
+}
+
+// PlacementCampaigns are the campaigns of a placement of a batch, in the order of the request
+type PlacementCampaigns struct {
+	ID        string             `json:"id"`
+	Campaigns []service.Campaign `json:"campaigns"`
+}
+
+// MakeGetCampaignsBatchEndpoint creates an endpoint for the GetCampaignsBatch service,
+// the user id wins over the device id
+func MakeGetCampaignsBatchEndpoint(svc service.Service) endpoint.Endpoint {
+	return logged("GetCampaignsBatchEndpoint", func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BatchRequest)
+		userID := req.UserID
+		if userID == "" {
+			userID = req.DeviceID
+		}
+
+		placements := make([]service.BatchPlacement, 0, len(req.Placements))
+		for _, placement := range req.Placements {
+			placements = append(placements, service.BatchPlacement{ID: placement.ID, Limit: placement.Limit})
+		}
+
+		batch, err := svc.GetCampaignsBatch(ctx, req.Context, userID, placements, req.AllowDuplicates)
+		if err != nil {
+			return nil, err
+		}
+
+		response := BatchResponse{Placements: make([]PlacementCampaigns, 0, len(batch)), Country: requestCountry(ctx, req.Context)}
+		for i, campaigns := range batch {
+			response.Placements = append(response.Placements, PlacementCampaigns{ID: placements[i].ID, Campaigns: campaigns})
+		}
+		return response, nil
+	})
+}
+
+// requestCountry returns the country of the request params, or the country inferred from
+// the client ip when they have none
+func requestCountry(ctx context.Context, params map[string]string) *Country {
+	if country, ok := params["country"]; ok {
+		return &Country{Code: country, Source: geo.SourceClient}
+	}
+	if location, ok := geo.FromContext(ctx); ok && location.Country != "" {
+		return &Country{Code: location.Country, Source: geo.SourceInferred}
 	}
+	return nil
 }
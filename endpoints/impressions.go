@@ -0,0 +1,41 @@
+package endpoints
+
+import (
+	"context"
+
+	"delivery-service/service"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ImpressionRequest reports an impression of a campaign for a user or a device
+type ImpressionRequest struct {
+	CampaignID string `json:"campaignId"`
+	UserID     string `json:"userId"`
+	DeviceID   string `json:"deviceId"`
+}
+
+// ImpressionResponse represents the response for the impression recording API
+type ImpressionResponse struct {
+	// Recorded is false when the campaign has no frequency cap
+	Recorded bool `json:"recorded"`
+}
+
+// MakeRecordImpressionEndpoint creates an endpoint counting the impressions of capped campaigns,
+// the user id wins over the device id. Impressions use up budgets, so requests need the
+// bearer token like the admin endpoints.
+func MakeRecordImpressionEndpoint(svc service.Service, token string) endpoint.Endpoint {
+	return logged("RecordImpressionEndpoint", MakeAuthMiddleware(token)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ImpressionRequest)
+		userID := req.UserID
+		if userID == "" {
+			userID = req.DeviceID
+		}
+
+		recorded, err := svc.RecordImpression(ctx, req.CampaignID, userID)
+		if err != nil {
+			return nil, err
+		}
+		return ImpressionResponse{Recorded: recorded}, nil
+	}))
+}
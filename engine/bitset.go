@@ -0,0 +1,60 @@
+package engine
+
+import "math/bits"
+
+// bitset is a fixed size set of campaign positions in an Index
+type bitset []uint64
+
+func newBitset(size int) bitset {
+	return make(bitset, (size+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (b bitset) clear(i int) {
+	b[i/64] &^= 1 << (uint(i) % 64)
+}
+
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+func (b bitset) clone() bitset {
+	c := make(bitset, len(b))
+	copy(c, b)
+	return c
+}
+
+// and keeps only the positions also present in o
+func (b bitset) and(o bitset) {
+	for i := range b {
+		b[i] &= o[i]
+	}
+}
+
+// andNot removes the positions present in o
+func (b bitset) andNot(o bitset) {
+	for i := range b {
+		b[i] &^= o[i]
+	}
+}
+
+// or adds the positions present in o
+func (b bitset) or(o bitset) {
+	for i := range b {
+		b[i] |= o[i]
+	}
+}
+
+// each calls fn for every position in ascending order
+func (b bitset) each(fn func(i int)) {
+	for w, word := range b {
+		for word != 0 {
+			tz := bits.TrailingZeros64(word)
+			fn(w*64 + tz)
+			word &= word - 1
+		}
+	}
+}
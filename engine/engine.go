@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"delivery-service/dimensions"
+	"delivery-service/storage"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "engine")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+}
+
+// CheckFunc reports whether a campaign may be delivered under the registered dimensions
+type CheckFunc func(registry *dimensions.Registry, campaign storage.Campaign) bool
+
+// Engine answers campaign lookups from an in-memory index of the active campaigns.
+// The campaigns are loaded on first use and kept up to date through Reload and
+// ApplyChange, which makes Engine a storage.ChangeHandler.
+type Engine struct {
+	store storage.CampaignStore
+	check CheckFunc
+
+	mu               sync.RWMutex
+	parametersLoaded bool
+	campaignsLoaded  bool
+	registry         *dimensions.Registry
+	campaigns        map[string]storage.Campaign
+	refused          map[string]struct{}
+	index            *Index
+}
+
+// New creates an Engine reading campaigns from store
+func New(store storage.CampaignStore) *Engine {
+	return &Engine{
+		store:     store,
+		campaigns: make(map[string]storage.Campaign),
+		refused:   make(map[string]struct{}),
+		registry:  dimensions.New(nil),
+		index:     NewIndex(nil, dimensions.New(nil)),
+	}
+}
+
+// SetCheck makes the engine leave out of the index the campaigns refused by check.
+// Campaigns are checked when loaded or changed and all again when the dimensions change.
+func (e *Engine) SetCheck(check CheckFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.check = check
+	e.checkAll()
+	e.rebuild()
+}
+
+// Dimensions returns the registry of the dimensions accepted in requests
+func (e *Engine) Dimensions(ctx context.Context) (*dimensions.Registry, error) {
+	e.mu.RLock()
+	registry, loaded := e.registry, e.parametersLoaded
+	e.mu.RUnlock()
+
+	if loaded {
+		return registry, nil
+	}
+
+	params, err := e.store.GetParameters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.parametersLoaded {
+		e.registry = dimensions.New(params)
+		e.parametersLoaded = true
+	}
+	return e.registry, nil
+}
+
+// GetCampaigns returns the active campaigns delivered in the requested country whose
+// rules accept every normalized parameter, ranked for userID and paginated by limit and offset
+func (e *Engine) GetCampaigns(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]storage.Campaign, error) {
+	if err := e.ensureCampaigns(ctx); err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	index := e.index
+	e.mu.RUnlock()
+
+	var segments storage.Segments
+	if index.UsesSegments() {
+		segments = e.segments(ctx)
+	}
+	return index.Query(params, userID, segments, limit, offset), nil
+}
+
+// segments returns the segment memberships of the store, nil when it has none. Segments
+// that cannot be loaded have no members.
+func (e *Engine) segments(ctx context.Context) storage.Segments {
+	source, ok := e.store.(storage.SegmentSource)
+	if !ok {
+		return nil
+	}
+	segments, err := source.Segments(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "GetCampaigns", "msg", "loading segments failed", "err", err)
+	}
+	return segments
+}
+
+// Campaign returns a delivered campaign, false when the campaign is unknown, inactive
+// or refused by the check
+func (e *Engine) Campaign(ctx context.Context, id string) (storage.Campaign, bool, error) {
+	if err := e.ensureCampaigns(ctx); err != nil {
+		return storage.Campaign{}, false, err
+	}
+
+	e.mu.RLock()
+	index := e.index
+	e.mu.RUnlock()
+
+	campaign, ok := index.Get(id)
+	return campaign, ok, nil
+}
+
+// Reload replaces the cached dimensions and campaigns with the store content
+func (e *Engine) Reload(ctx context.Context) error {
+	params, err := e.store.GetParameters(ctx)
+	if err != nil {
+		return err
+	}
+
+	campaigns, err := e.store.ListCampaigns(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.registry = dimensions.New(params)
+	e.parametersLoaded = true
+	e.campaigns = make(map[string]storage.Campaign, len(campaigns))
+	for _, campaign := range campaigns {
+		if campaign.IsActive {
+			e.campaigns[campaign.ID] = campaign
+		}
+	}
+	e.checkAll()
+	e.rebuild()
+	e.campaignsLoaded = true
+
+	level.Info(logger).Log("method", "Reload", "msg", "campaign index loaded", "campaigns", e.index.Len())
+	return nil
+}
+
+// ApplyChange applies a campaign or dimensions change
+func (e *Engine) ApplyChange(change storage.Change) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch change.Kind {
+	case storage.ChangeCampaign:
+		delete(e.campaigns, change.CampaignID)
+		delete(e.refused, change.CampaignID)
+		if change.Operation == storage.OperationUpsert && change.Campaign.IsActive {
+			e.campaigns[change.Campaign.ID] = *change.Campaign
+			e.checkCampaign(*change.Campaign)
+		}
+		e.rebuild()
+
+	case storage.ChangeParameters:
+		// the matching semantics of the rules may have changed
+		e.registry = dimensions.New(change.Parameters)
+		e.parametersLoaded = true
+		e.checkAll()
+		e.rebuild()
+	}
+
+	return nil
+}
+
+func (e *Engine) ensureCampaigns(ctx context.Context) error {
+	e.mu.RLock()
+	loaded := e.campaignsLoaded
+	e.mu.RUnlock()
+
+	if loaded {
+		return nil
+	}
+	return e.Reload(ctx)
+}
+
+// checkAll checks every cached campaign again, the caller holds the lock
+func (e *Engine) checkAll() {
+	e.refused = make(map[string]struct{})
+	for _, campaign := range e.campaigns {
+		e.checkCampaign(campaign)
+	}
+}
+
+// checkCampaign records whether check refuses campaign, the caller holds the lock
+func (e *Engine) checkCampaign(campaign storage.Campaign) {
+	if e.check == nil || e.check(e.registry, campaign) {
+		return
+	}
+	e.refused[campaign.ID] = struct{}{}
+	level.Warn(logger).Log("method", "checkCampaign", "msg", "campaign refused by rules check", "id", campaign.ID)
+}
+
+// rebuild recompiles the index after a change of the campaign set, the caller holds the lock
+func (e *Engine) rebuild() {
+	campaigns := make([]storage.Campaign, 0, len(e.campaigns))
+	for _, campaign := range e.campaigns {
+		if _, ok := e.refused[campaign.ID]; !ok {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	e.index = NewIndex(campaigns, e.registry)
+}
+
+// Paginate returns the page of campaigns at offset for pages of size limit
+func Paginate(campaigns []storage.Campaign, limit, offset int) []storage.Campaign {
+	if limit <= 0 || offset < 0 {
+		return nil
+	}
+
+	start := limit * offset
+	if start >= len(campaigns) {
+		return nil
+	}
+
+	end := start + limit
+	if end > len(campaigns) {
+		end = len(campaigns)
+	}
+	return campaigns[start:end]
+}
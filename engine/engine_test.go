@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"delivery-service/dimensions"
+	"delivery-service/mocks"
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEngine() *Engine {
+	return New(mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", Image: "img1", Cta: "cta1", IsActive: true, Countries: []string{"us"}},
+				{ID: "c2", Image: "img2", Cta: "cta2", IsActive: true, Countries: []string{"us"}},
+			}, nil
+		},
+	})
+}
+
+// campaign changes are applied to the loaded campaigns
+func TestApplyChange1(t *testing.T) {
+	e := newTestEngine()
+	params := map[string]string{"app": "a", "country": "us", "os": "ios"}
+
+	campaigns, err := e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c2"}, ids(campaigns))
+
+	updated := storage.Campaign{ID: "c1", Image: "img1", IsActive: true, Rules: map[string][]string{"excludeos": {"ios"}}, Countries: []string{"us"}}
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationUpsert, CampaignID: "c1", Campaign: &updated}))
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationDelete, CampaignID: "c2"}))
+
+	campaigns, err = e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, campaigns)
+
+	params["os"] = "android"
+	campaigns, err = e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1"}, ids(campaigns))
+}
+
+// deactivated campaigns are dropped and country changes are applied
+func TestApplyChange2(t *testing.T) {
+	e := newTestEngine()
+	params := map[string]string{"app": "a", "country": "us", "os": "ios"}
+
+	_, err := e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+
+	inserted := storage.Campaign{ID: "c3", Image: "img3", IsActive: true, Countries: []string{"us"}}
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationUpsert, CampaignID: "c3", Campaign: &inserted}))
+	moved := storage.Campaign{ID: "c1", Image: "img1", IsActive: true, Countries: []string{"in"}}
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationUpsert, CampaignID: "c1", Campaign: &moved}))
+	deactivated := storage.Campaign{ID: "c2", Image: "img2", IsActive: false, Countries: []string{"us"}}
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationUpsert, CampaignID: "c2", Campaign: &deactivated}))
+
+	campaigns, err := e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c3"}, ids(campaigns))
+}
+
+// rule parameters changes replace the accepted dimensions
+func TestApplyChange3(t *testing.T) {
+	e := newTestEngine()
+
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeParameters, Operation: storage.OperationUpsert, Parameters: storage.DimensionsFromNames([]string{"app", "country", "os", "state"})}))
+
+	registry, err := e.Dimensions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app", "country", "os", "state"}, registry.Names())
+}
+
+// campaigns refused by the check are left out until the rule parameters accept them
+func TestSetCheck1(t *testing.T) {
+	e := newTestEngine()
+	e.SetCheck(func(registry *dimensions.Registry, campaign storage.Campaign) bool {
+		if _, ok := campaign.Rules["includedevice"]; ok {
+			_, registered := registry.Get("device")
+			return registered
+		}
+		return true
+	})
+	params := map[string]string{"app": "a", "country": "us", "os": "ios"}
+
+	updated := storage.Campaign{ID: "c1", Image: "img1", IsActive: true, Rules: map[string][]string{"includedevice": {"tv"}}, Countries: []string{"us"}}
+	campaigns, err := e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationUpsert, CampaignID: "c1", Campaign: &updated}))
+
+	campaigns, err = e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c2"}, ids(campaigns))
+
+	assert.NoError(t, e.ApplyChange(storage.Change{Kind: storage.ChangeParameters, Operation: storage.OperationUpsert, Parameters: storage.DimensionsFromNames([]string{"app", "country", "device", "os"})}))
+
+	params["device"] = "tv"
+	campaigns, err = e.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c2"}, ids(campaigns))
+}
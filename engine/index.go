@@ -0,0 +1,287 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"delivery-service/dimensions"
+	"delivery-service/expression"
+	"delivery-service/ranking"
+	"delivery-service/schedule"
+	"delivery-service/segment"
+	"delivery-service/storage"
+)
+
+// Index is an immutable inverted index over the include/exclude rules of a campaign set.
+// Rules of dimensions comparing values for equality are looked up by value, the other
+// rules (versions, ranges, CIDR blocks) are evaluated against the requested value.
+type Index struct {
+	campaigns []storage.Campaign
+	// countries holds, per country, the campaigns delivered in that country
+	countries map[string]bitset
+
+	// include holds, per dimension and value, the campaigns listing the value in their include rule
+	include map[string]map[string]bitset
+	// restricted holds, per dimension, the campaigns that have an include rule at all
+	restricted map[string]bitset
+	// strict holds the dimensions whose include rules reject requests without a value
+	strict map[string]struct{}
+	// exclude holds, per dimension and value, the campaigns listing the value in their exclude rule
+	exclude map[string]map[string]bitset
+
+	// includeScan and excludeScan hold, per dimension, the rules that are not looked up by value
+	includeScan map[string][]scanRule
+	excludeScan map[string][]scanRule
+
+	// scheduled holds the positions of the campaigns with a schedule
+	scheduled []int
+	// expressions holds the compiled targeting expressions of the campaigns having one
+	expressions []expressionRule
+	// segmented holds the segment targeting of the campaigns having one
+	segmented []segmentRule
+	// usesSegments is set when a campaign may target segments
+	usesSegments bool
+}
+
+// segmentRule is the segment targeting of the campaign at pos
+type segmentRule struct {
+	pos       int
+	targeting *storage.SegmentTargeting
+}
+
+// expressionRule is the compiled targeting expression of the campaign at pos
+type expressionRule struct {
+	pos     int
+	program expression.Program
+}
+
+// scanRule is a compiled rule of the campaign at pos
+type scanRule struct {
+	pos   int
+	match func(string) bool
+}
+
+// NewIndex compiles the rules of the given campaigns, ordered by campaign id, with the
+// matching semantics of the registry dimensions
+func NewIndex(campaigns []storage.Campaign, registry *dimensions.Registry) *Index {
+	sorted := make([]storage.Campaign, len(campaigns))
+	copy(sorted, campaigns)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	ix := &Index{
+		campaigns:   sorted,
+		countries:   make(map[string]bitset),
+		include:     make(map[string]map[string]bitset),
+		restricted:  make(map[string]bitset),
+		strict:      make(map[string]struct{}),
+		exclude:     make(map[string]map[string]bitset),
+		includeScan: make(map[string][]scanRule),
+		excludeScan: make(map[string][]scanRule),
+	}
+
+	for pos, campaign := range sorted {
+		if campaign.Schedule != nil {
+			ix.scheduled = append(ix.scheduled, pos)
+		}
+		if campaign.Segments != nil {
+			ix.segmented = append(ix.segmented, segmentRule{pos: pos, targeting: campaign.Segments})
+		}
+		ix.usesSegments = ix.usesSegments || segment.Targeted(campaign)
+		if campaign.Expression != "" {
+			ix.expressions = append(ix.expressions, expressionRule{pos: pos, program: compileExpression(campaign.Expression, registry)})
+		}
+		for _, country := range campaign.Countries {
+			ix.bitsetFor(ix.countries, strings.ToLower(country)).set(pos)
+		}
+		for key, values := range campaign.Rules {
+			name, include, ok := dimensions.RuleKey(key)
+			if !ok {
+				continue
+			}
+			dimension := registry.Lookup(name)
+
+			if include {
+				ix.bitsetFor(ix.restricted, name).set(pos)
+				if dimension.Strict() {
+					ix.strict[name] = struct{}{}
+				}
+			}
+
+			if !dimension.Indexed() {
+				rule := scanRule{pos: pos, match: dimension.Matcher(values)}
+				if include {
+					ix.includeScan[name] = append(ix.includeScan[name], rule)
+				} else {
+					ix.excludeScan[name] = append(ix.excludeScan[name], rule)
+				}
+				continue
+			}
+
+			sets := ix.exclude
+			if include {
+				sets = ix.include
+			}
+			for _, value := range values {
+				ix.valueBitset(sets, name, dimension.IndexValue(value)).set(pos)
+			}
+		}
+	}
+
+	return ix
+}
+
+// Len returns the number of campaigns in the index
+func (ix *Index) Len() int {
+	return len(ix.campaigns)
+}
+
+// Get returns the campaign with the given id
+func (ix *Index) Get(id string) (storage.Campaign, bool) {
+	pos := sort.Search(len(ix.campaigns), func(i int) bool { return ix.campaigns[i].ID >= id })
+	if pos < len(ix.campaigns) && ix.campaigns[pos].ID == id {
+		return ix.campaigns[pos], true
+	}
+	return storage.Campaign{}, false
+}
+
+// UsesSegments reports whether a campaign of the index may target segments
+func (ix *Index) UsesSegments() bool {
+	return ix.usesSegments
+}
+
+// Query returns the campaigns delivered in the requested country whose rules accept
+// every normalized parameter, whose segments userID or the parameters belong to and
+// whose schedule is live, ranked for userID and paginated by limit and offset.
+// Segments may be nil when no campaign uses them.
+func (ix *Index) Query(params map[string]string, userID string, segments storage.Segments, limit, offset int) []storage.Campaign {
+	return ix.QueryAt(params, userID, segments, time.Now(), limit, offset)
+}
+
+// QueryAt is Query with the schedules evaluated at now
+func (ix *Index) QueryAt(params map[string]string, userID string, segments storage.Segments, now time.Time, limit, offset int) []storage.Campaign {
+	request := params
+	if ix.usesSegments {
+		request = segment.RequestParams(params, userID)
+	}
+	campaigns := ix.collect(ix.live(ix.match(request, segments, ix.country(params["country"])), now))
+	ranking.Rank(campaigns, userID)
+	return Paginate(campaigns, limit, offset)
+}
+
+// all returns a set containing every campaign of the index
+func (ix *Index) all() bitset {
+	all := newBitset(len(ix.campaigns))
+	for i := range ix.campaigns {
+		all.set(i)
+	}
+	return all
+}
+
+// country returns the set of campaigns delivered in country
+func (ix *Index) country(country string) bitset {
+	if set, ok := ix.countries[country]; ok {
+		return set
+	}
+	return newBitset(len(ix.campaigns))
+}
+
+// match narrows candidates down to the campaigns whose rules accept every parameter,
+// whose segment targeting and expression (if any) hold. A campaign accepts a value when
+// it has no include rule for the dimension or the include rule lists the value, and its
+// exclude rule (if any) does not list it. Include rules of strict dimensions reject
+// requests without a value.
+func (ix *Index) match(params map[string]string, segments storage.Segments, candidates bitset) bitset {
+	matched := candidates.clone()
+
+	for dimension := range ix.strict {
+		if _, ok := params[dimension]; !ok {
+			matched.andNot(ix.restricted[dimension])
+		}
+	}
+
+	for dimension, value := range params {
+		if restricted, ok := ix.restricted[dimension]; ok {
+			allowed := ix.all()
+			allowed.andNot(restricted)
+			if included, ok := ix.include[dimension][value]; ok {
+				allowed.or(included)
+			}
+			for _, rule := range ix.includeScan[dimension] {
+				if rule.match(value) {
+					allowed.set(rule.pos)
+				}
+			}
+			matched.and(allowed)
+		}
+
+		if excluded, ok := ix.exclude[dimension][value]; ok {
+			matched.andNot(excluded)
+		}
+		for _, rule := range ix.excludeScan[dimension] {
+			if rule.match(value) {
+				matched.clear(rule.pos)
+			}
+		}
+	}
+
+	for _, rule := range ix.segmented {
+		if matched.has(rule.pos) && !segment.Match(rule.targeting, segments, params) {
+			matched.clear(rule.pos)
+		}
+	}
+
+	for _, rule := range ix.expressions {
+		if matched.has(rule.pos) && !rule.program(params, segments) {
+			matched.clear(rule.pos)
+		}
+	}
+
+	return matched
+}
+
+// compileExpression compiles a targeting expression, an expression that does not parse never holds
+func compileExpression(source string, registry *dimensions.Registry) expression.Program {
+	expr, err := expression.Parse(source)
+	if err != nil {
+		return func(map[string]string, expression.Segments) bool { return false }
+	}
+	return expr.Compile(registry)
+}
+
+// live removes from set the campaigns whose schedule does not allow delivery at now
+func (ix *Index) live(set bitset, now time.Time) bitset {
+	for _, pos := range ix.scheduled {
+		if set.has(pos) && !schedule.Live(ix.campaigns[pos].Schedule, now) {
+			set.clear(pos)
+		}
+	}
+	return set
+}
+
+// collect returns the campaigns of the set in id order
+func (ix *Index) collect(set bitset) []storage.Campaign {
+	var campaigns []storage.Campaign
+	set.each(func(i int) {
+		campaigns = append(campaigns, ix.campaigns[i])
+	})
+	return campaigns
+}
+
+func (ix *Index) bitsetFor(sets map[string]bitset, dimension string) bitset {
+	set, ok := sets[dimension]
+	if !ok {
+		set = newBitset(len(ix.campaigns))
+		sets[dimension] = set
+	}
+	return set
+}
+
+func (ix *Index) valueBitset(sets map[string]map[string]bitset, dimension, value string) bitset {
+	values, ok := sets[dimension]
+	if !ok {
+		values = make(map[string]bitset)
+		sets[dimension] = values
+	}
+	return ix.bitsetFor(values, value)
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"delivery-service/dimensions"
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testCampaigns = []storage.Campaign{
+	{ID: "c3", Image: "img3", Cta: "cta3", Rules: map[string][]string{"excludecountry": {"us"}}, Countries: []string{"us", "in"}},
+	{ID: "c1", Image: "img1", Cta: "cta1", Rules: map[string][]string{"includeapp": {"a1", "a2"}, "includeos": {"android"}}, Countries: []string{"us"}},
+	{ID: "c2", Image: "img2", Cta: "cta2", Countries: []string{"in"}},
+	{ID: "c4", Image: "img4", Cta: "cta4", Rules: map[string][]string{"includeos": {}}},
+}
+
+var testRegistry = dimensions.New(storage.DimensionsFromNames([]string{"app", "country", "os"}))
+
+func ids(campaigns []storage.Campaign) []string {
+	var result []string
+	for _, c := range campaigns {
+		result = append(result, c.ID)
+	}
+	return result
+}
+
+// match campaigns with include rules, exclude rules and no rules
+func TestIndexMatch1(t *testing.T) {
+	ix := NewIndex(testCampaigns, testRegistry)
+
+	matched := ix.collect(ix.match(map[string]string{"app": "a1", "country": "in", "os": "android"}, nil, ix.all()))
+	assert.Equal(t, []string{"c1", "c2", "c3"}, ids(matched))
+
+	matched = ix.collect(ix.match(map[string]string{"app": "a3", "country": "us", "os": "android"}, nil, ix.all()))
+	assert.Equal(t, []string{"c2"}, ids(matched))
+}
+
+// an empty include rule accepts no value
+func TestIndexMatch2(t *testing.T) {
+	ix := NewIndex(testCampaigns, testRegistry)
+
+	matched := ix.collect(ix.match(map[string]string{"os": "ios"}, nil, ix.all()))
+	assert.Equal(t, []string{"c2", "c3"}, ids(matched))
+}
+
+// candidates restrict the matched campaigns
+func TestIndexMatch3(t *testing.T) {
+	ix := NewIndex(testCampaigns, testRegistry)
+
+	matched := ix.collect(ix.match(map[string]string{"app": "a1"}, nil, ix.country("us")))
+	assert.Equal(t, []string{"c1", "c3"}, ids(matched))
+
+	assert.Empty(t, ix.collect(ix.match(map[string]string{"app": "a1"}, nil, ix.country("unknown"))))
+}
+
+// pages are taken after skipping the previous pages
+func TestPaginate1(t *testing.T) {
+	assert.Equal(t, []string{"c1", "c2"}, ids(Paginate(NewIndex(testCampaigns, testRegistry).campaigns, 2, 0)))
+	assert.Equal(t, []string{"c3", "c4"}, ids(Paginate(NewIndex(testCampaigns, testRegistry).campaigns, 2, 1)))
+	assert.Empty(t, Paginate(NewIndex(testCampaigns, testRegistry).campaigns, 2, 2))
+	assert.Empty(t, Paginate(NewIndex(testCampaigns, testRegistry).campaigns, 0, 0))
+}
+
+// match typed dimensions: case-insensitive enums, versions, integer ranges and CIDR blocks
+func TestIndexMatch4(t *testing.T) {
+	registry := dimensions.New([]storage.Dimension{
+		{Name: "os", Type: storage.TypeEnum},
+		{Name: "os_version", Type: storage.TypeVersion},
+		{Name: "age", Type: storage.TypeInt},
+		{Name: "ip", Type: storage.TypeCIDR},
+	})
+	ix := NewIndex([]storage.Campaign{
+		{ID: "c1", Rules: map[string][]string{"includeos": {"Android"}, "includeos_version": {"14.2"}}},
+		{ID: "c2", Rules: map[string][]string{"includeage": {"18-24", "65"}}},
+		{ID: "c3", Rules: map[string][]string{"excludeip": {"10.0.0.0/8"}}},
+	}, registry)
+
+	matched := ix.collect(ix.match(map[string]string{"os": "android", "os_version": "14.2.0", "age": "20", "ip": "10.1.2.3"}, nil, ix.all()))
+	assert.Equal(t, []string{"c1", "c2"}, ids(matched))
+
+	matched = ix.collect(ix.match(map[string]string{"os": "ios", "os_version": "14.2.0", "age": "30", "ip": "192.168.1.1"}, nil, ix.all()))
+	assert.Equal(t, []string{"c3"}, ids(matched))
+}
+
+// geo include rules need the location of the request, geo exclude rules do not
+func TestIndexMatch6(t *testing.T) {
+	registry := dimensions.New(storage.DimensionsFromNames([]string{"country", "region", "city", "location"}))
+	ix := NewIndex([]storage.Campaign{
+		{ID: "c1", Countries: []string{"us"}, Rules: map[string][]string{"includeregion": {"US-CA"}}},
+		{ID: "c2", Countries: []string{"us"}, Rules: map[string][]string{"excludecity": {"Los Angeles"}}},
+		{ID: "c3", Countries: []string{"us"}, Rules: map[string][]string{"includelocation": {"37.7749,-122.4194,50km"}}},
+	}, registry)
+
+	matched := ix.collect(ix.match(map[string]string{"country": "us", "region": "us-ca", "city": "san francisco", "location": "37.8044,-122.2712"}, nil, ix.country("us")))
+	assert.Equal(t, []string{"c1", "c2", "c3"}, ids(matched))
+
+	matched = ix.collect(ix.match(map[string]string{"country": "us", "region": "us-ca", "city": "los angeles"}, nil, ix.country("us")))
+	assert.Equal(t, []string{"c1"}, ids(matched))
+
+	matched = ix.collect(ix.match(map[string]string{"country": "us"}, nil, ix.country("us")))
+	assert.Equal(t, []string{"c2"}, ids(matched))
+}
+
+// campaigns are matched on their expression on top of their rules, invalid expressions never match
+func TestIndexMatch5(t *testing.T) {
+	ix := NewIndex([]storage.Campaign{
+		{ID: "c1", Expression: `(country in ["US", "CA"] and os == "ios") or app == "com.a.b"`},
+		{ID: "c2", Rules: map[string][]string{"includeos": {"ios"}}, Expression: `country != "us"`},
+		{ID: "c3", Expression: `country in [`},
+	}, testRegistry)
+
+	matched := ix.collect(ix.match(map[string]string{"country": "us", "os": "ios"}, nil, ix.all()))
+	assert.Equal(t, []string{"c1"}, ids(matched))
+
+	matched = ix.collect(ix.match(map[string]string{"country": "de", "os": "ios", "app": "com.a.b"}, nil, ix.all()))
+	assert.Equal(t, []string{"c1", "c2"}, ids(matched))
+}
+
+// memberships is a storage.Segments of user_id segments
+type memberships map[string][]string
+
+func (m memberships) Contains(name, value string) bool {
+	for _, member := range m[name] {
+		if member == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m memberships) Dimension(name string) (string, bool) {
+	_, ok := m[name]
+	return "user_id", ok
+}
+
+// campaigns targeting segments are matched on the user id of the request
+func TestIndexQueryAt3(t *testing.T) {
+	ix := NewIndex([]storage.Campaign{
+		{ID: "c1", Countries: []string{"us"}, Segments: &storage.SegmentTargeting{Include: []string{"whales"}}},
+		{ID: "c2", Countries: []string{"us"}, Segments: &storage.SegmentTargeting{Exclude: []string{"whales"}}},
+		{ID: "c3", Countries: []string{"us"}, Expression: `user_id in segment("churned") or os == "ios"`},
+	}, testRegistry)
+	segments := memberships{"whales": {"u1"}, "churned": {"u2"}}
+	params := map[string]string{"country": "us", "os": "android"}
+	now := time.Now()
+
+	assert.True(t, ix.UsesSegments())
+	assert.ElementsMatch(t, []string{"c1"}, ids(ix.QueryAt(params, "U1", segments, now, 10, 0)))
+	assert.ElementsMatch(t, []string{"c2", "c3"}, ids(ix.QueryAt(params, "u2", segments, now, 10, 0)))
+	assert.ElementsMatch(t, []string{"c2"}, ids(ix.QueryAt(params, "", segments, now, 10, 0)))
+	assert.ElementsMatch(t, []string{"c2"}, ids(ix.QueryAt(params, "u1", nil, now, 10, 0)))
+}
+
+// campaigns outside their schedule are left out of the results
+func TestIndexQueryAt1(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	ix := NewIndex([]storage.Campaign{
+		{ID: "c1", Countries: []string{"us"}, Schedule: &storage.Schedule{StartAt: &start}},
+		{ID: "c2", Countries: []string{"us"}},
+	}, testRegistry)
+
+	assert.Equal(t, []string{"c2"}, ids(ix.QueryAt(map[string]string{"country": "us"}, "", nil, start.Add(-time.Second), 10, 0)))
+	assert.Equal(t, []string{"c1", "c2"}, ids(ix.QueryAt(map[string]string{"country": "us"}, "", nil, start, 10, 0)))
+}
+
+// pages of a user come from the same ranking, so no campaign is repeated or skipped
+func TestIndexQueryAt2(t *testing.T) {
+	var campaigns []storage.Campaign
+	for _, id := range []string{"c1", "c2", "c3", "c4", "c5", "c6"} {
+		campaigns = append(campaigns, storage.Campaign{ID: id, Countries: []string{"us"}})
+	}
+	campaigns[5].Priority = 1
+	ix := NewIndex(campaigns, testRegistry)
+	params := map[string]string{"country": "us"}
+	now := time.Now()
+
+	all := ids(ix.QueryAt(params, "user-1", nil, now, 6, 0))
+	assert.Equal(t, "c6", all[0])
+	assert.ElementsMatch(t, []string{"c1", "c2", "c3", "c4", "c5", "c6"}, all)
+
+	var paged []string
+	for page := 0; page < 3; page++ {
+		paged = append(paged, ids(ix.QueryAt(params, "user-1", nil, now, 2, page))...)
+	}
+	assert.Equal(t, all, paged)
+}
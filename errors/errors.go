@@ -68,3 +68,185 @@ func (e *ErrMethodNotAllowed) GetMethod() string {
 	}
 	return "GET"
 }
+
+type ErrInvalidPayload struct {
+	Reason string
+	Method string
+}
+
+type ErrUnauthorized struct {
+	Method string
+}
+
+type ErrCampaignNotFound struct {
+	ID     string
+	Method string
+}
+
+type ErrCampaignExists struct {
+	ID     string
+	Method string
+}
+
+func (e *ErrInvalidPayload) Error() string {
+	return "invalid payload: " + e.Reason
+}
+
+func (e *ErrUnauthorized) Error() string {
+	return "unauthorized"
+}
+
+func (e *ErrCampaignNotFound) Error() string {
+	return "campaign not found: " + e.ID
+}
+
+func (e *ErrCampaignExists) Error() string {
+	return "campaign already exists: " + e.ID
+}
+
+func (e *ErrInvalidPayload) GetCode() int {
+	return http.StatusBadRequest
+}
+
+func (e *ErrUnauthorized) GetCode() int {
+	return http.StatusUnauthorized
+}
+
+func (e *ErrCampaignNotFound) GetCode() int {
+	return http.StatusNotFound
+}
+
+func (e *ErrCampaignExists) GetCode() int {
+	return http.StatusConflict
+}
+
+func (e *ErrInvalidPayload) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+func (e *ErrUnauthorized) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+func (e *ErrCampaignNotFound) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+func (e *ErrCampaignExists) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+type ErrInvalidParams struct {
+	Param  string
+	Reason string
+	Method string
+}
+
+func (e *ErrInvalidParams) Error() string {
+	return "invalid parameter " + e.Param + ": " + e.Reason
+}
+
+func (e *ErrInvalidParams) GetCode() int {
+	return http.StatusBadRequest
+}
+
+func (e *ErrInvalidParams) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+type ErrSegmentNotFound struct {
+	Name   string
+	Method string
+}
+
+type ErrSegmentInUse struct {
+	Name     string
+	Campaign string
+	Method   string
+}
+
+func (e *ErrSegmentNotFound) Error() string {
+	return "segment not found: " + e.Name
+}
+
+func (e *ErrSegmentInUse) Error() string {
+	return "segment " + e.Name + " is targeted by campaign " + e.Campaign
+}
+
+func (e *ErrSegmentNotFound) GetCode() int {
+	return http.StatusNotFound
+}
+
+func (e *ErrSegmentInUse) GetCode() int {
+	return http.StatusConflict
+}
+
+func (e *ErrSegmentNotFound) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+func (e *ErrSegmentInUse) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+type ErrPlacementNotFound struct {
+	ID     string
+	Method string
+}
+
+type ErrPlacementInUse struct {
+	ID       string
+	Campaign string
+	Method   string
+}
+
+func (e *ErrPlacementNotFound) Error() string {
+	return "placement not found: " + e.ID
+}
+
+func (e *ErrPlacementInUse) Error() string {
+	return "placement " + e.ID + " is targeted by campaign " + e.Campaign
+}
+
+func (e *ErrPlacementNotFound) GetCode() int {
+	return http.StatusNotFound
+}
+
+func (e *ErrPlacementInUse) GetCode() int {
+	return http.StatusConflict
+}
+
+func (e *ErrPlacementNotFound) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
+
+func (e *ErrPlacementInUse) GetMethod() string {
+	if e.Method != "" {
+		return e.Method
+	}
+	return "GET"
+}
@@ -0,0 +1,95 @@
+package experiment
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"delivery-service/storage"
+)
+
+// buckets is the number of buckets users are hashed into, percents have a 0.01 resolution
+const buckets = 10000
+
+var (
+	variantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// random buckets the requests without a user, replaced in tests
+	random = func() int { return rand.IntN(buckets) }
+)
+
+// Assign returns the variant of a campaign shown to userID, the same variant on every
+// request of the user. Requests without a user get a random variant. It returns false
+// when the campaign has no variants.
+func Assign(campaign storage.Campaign, userID string) (storage.Variant, bool) {
+	if len(campaign.Variants) == 0 {
+		return storage.Variant{}, false
+	}
+
+	bucket := random()
+	if userID != "" {
+		bucket = Bucket(userID, campaign.ID)
+	}
+
+	// percents of the variants are laid out one after the other over the buckets
+	upper := 0.0
+	for _, variant := range campaign.Variants {
+		upper += variant.Percent * buckets / 100
+		if float64(bucket) < math.Round(upper) {
+			return variant, true
+		}
+	}
+	return campaign.Variants[len(campaign.Variants)-1], true
+}
+
+// Bucket hashes a user of a campaign into [0, 10000). It is salted so that the variants
+// are independent of the ranking of the campaign for the user.
+func Bucket(userID, campaignID string) int {
+	h := fnv.New64a()
+	h.Write([]byte("experiment"))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	h.Write([]byte{0})
+	h.Write([]byte(campaignID))
+	return int(h.Sum64() % buckets)
+}
+
+// Validate checks the variants of a campaign: unique ids, a creative each and percents
+// adding up to 100
+func Validate(variants []storage.Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(variants))
+	total := 0.0
+	for _, variant := range variants {
+		if !variantIDPattern.MatchString(variant.ID) {
+			return errors.New("variant id must be made of letters, digits, '_', '.' or '-': " + variant.ID)
+		}
+		if _, ok := seen[variant.ID]; ok {
+			return errors.New("duplicate variant: " + variant.ID)
+		}
+		seen[variant.ID] = struct{}{}
+
+		if u, err := url.Parse(variant.Image); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("variant " + variant.ID + " image must be an http(s) url")
+		}
+		if strings.TrimSpace(variant.Cta) == "" {
+			return errors.New("variant " + variant.ID + " needs a cta")
+		}
+		if variant.Percent <= 0 {
+			return errors.New("variant " + variant.ID + " percent must be positive")
+		}
+		total += variant.Percent
+	}
+
+	if math.Abs(total-100) > 1e-6 {
+		return errors.New("variant percents must add up to 100")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package experiment
+
+import (
+	"fmt"
+	"testing"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var campaign = storage.Campaign{ID: "c1", Variants: []storage.Variant{
+	{ID: "control", Image: "https://img/a.png", Cta: "Play", Percent: 70},
+	{ID: "green", Image: "https://img/b.png", Cta: "Play now", Percent: 30},
+}}
+
+// a user always gets the same variant, users are split by the variant percents
+func TestAssign1(t *testing.T) {
+	first, ok := Assign(campaign, "user-1")
+	assert.True(t, ok)
+	for i := 0; i < 10; i++ {
+		variant, _ := Assign(campaign, "user-1")
+		assert.Equal(t, first, variant)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		variant, _ := Assign(campaign, fmt.Sprintf("user-%d", i))
+		counts[variant.ID]++
+	}
+	assert.InDelta(t, 7000, counts["control"], 300)
+	assert.InDelta(t, 3000, counts["green"], 300)
+}
+
+// requests without a user get a random variant, campaigns without variants get none
+func TestAssign2(t *testing.T) {
+	defer func(r func() int) { random = r }(random)
+
+	random = func() int { return 6999 }
+	variant, ok := Assign(campaign, "")
+	assert.True(t, ok)
+	assert.Equal(t, "control", variant.ID)
+
+	random = func() int { return 7000 }
+	variant, _ = Assign(campaign, "")
+	assert.Equal(t, "green", variant.ID)
+
+	_, ok = Assign(storage.Campaign{ID: "c2"}, "user-1")
+	assert.False(t, ok)
+}
+
+// variants need unique ids, a creative and percents adding up to 100
+func TestValidate1(t *testing.T) {
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate(campaign.Variants))
+
+	assert.Error(t, Validate([]storage.Variant{{ID: "a", Image: "https://img/a.png", Cta: "Play", Percent: 60}}))
+	assert.Error(t, Validate([]storage.Variant{
+		{ID: "a", Image: "https://img/a.png", Cta: "Play", Percent: 50},
+		{ID: "a", Image: "https://img/b.png", Cta: "Play", Percent: 50},
+	}))
+	assert.Error(t, Validate([]storage.Variant{{ID: "a", Image: "img/a.png", Cta: "Play", Percent: 100}}))
+	assert.Error(t, Validate([]storage.Variant{{ID: "a", Image: "https://img/a.png", Percent: 100}}))
+}
@@ -0,0 +1,359 @@
+package expression
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"delivery-service/dimensions"
+	"delivery-service/storage"
+)
+
+const (
+	opAnd = "and"
+	opOr  = "or"
+
+	opEq    = "=="
+	opNe    = "!="
+	opLt    = "<"
+	opLe    = "<="
+	opGt    = ">"
+	opGe    = ">="
+	opIn    = "in"
+	opNotIn = "not in"
+
+	// maxClauses bounds the clauses of the disjunctive normal form of an expression
+	maxClauses = 32
+)
+
+// Segments resolves the audience segments referenced by expressions
+type Segments interface {
+	// Contains reports whether value belongs to the segment name
+	Contains(name, value string) bool
+}
+
+// Expr is a parsed targeting expression
+type Expr struct {
+	source string
+	root   node
+}
+
+type node interface{}
+
+// logical is a conjunction or a disjunction
+type logical struct {
+	op          string
+	left, right node
+}
+
+type negation struct {
+	x node
+}
+
+// comparison compares the request value of a dimension with literal values or a segment
+type comparison struct {
+	pos       int
+	dimension string
+	op        string
+	values    []string
+	segment   string
+}
+
+// Parse parses a targeting expression like
+//
+//	(country in ["US", "CA"] and os == "ios") or app in segment("whales")
+func Parse(source string) (*Expr, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &Error{Pos: t.pos, Msg: "unexpected " + t.describe()}
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Check type checks the expression against the registered dimensions: every dimension
+// must be registered, values must be of the dimension type and ordering comparisons
+// are only allowed on version and int dimensions
+func (e *Expr) Check(registry *dimensions.Registry) error {
+	var err error
+	walk(e.root, func(c *comparison) {
+		if err == nil {
+			err = check(registry, c)
+		}
+	})
+	return err
+}
+
+func check(registry *dimensions.Registry, c *comparison) error {
+	if c.dimension == dimensions.UserID {
+		if c.segment == "" {
+			return &Error{Pos: c.pos, Msg: dimensions.UserID + " is only compared to segments"}
+		}
+		return nil
+	}
+
+	dimension, ok := registry.Get(c.dimension)
+	if !ok {
+		return &Error{Pos: c.pos, Msg: "unknown dimension " + c.dimension}
+	}
+
+	switch c.op {
+	case opLt, opLe, opGt, opGe:
+		switch dimension.Type {
+		case storage.TypeVersion:
+			if _, err := dimensions.ParseVersion(c.values[0]); err != nil {
+				return &Error{Pos: c.pos, Msg: c.dimension + " " + c.op + " needs a version, not " + strconv.Quote(c.values[0])}
+			}
+		case storage.TypeInt:
+			if _, err := strconv.Atoi(c.values[0]); err != nil {
+				return &Error{Pos: c.pos, Msg: c.dimension + " " + c.op + " needs an integer, not " + strconv.Quote(c.values[0])}
+			}
+		default:
+			return &Error{Pos: c.pos, Msg: c.op + " compares version and int dimensions, " + c.dimension + " is " + dimension.Type}
+		}
+		return nil
+	}
+
+	for _, value := range c.values {
+		if reason := dimension.Check(value); reason != "" {
+			return &Error{Pos: c.pos, Msg: c.dimension + " " + strconv.Quote(value) + ": " + reason}
+		}
+	}
+	return nil
+}
+
+// Reference is a comparison of a request dimension with a segment
+type Reference struct {
+	Segment   string
+	Dimension string
+}
+
+// SegmentReferences returns the segments the expression compares dimensions with,
+// sorted and without duplicates
+func (e *Expr) SegmentReferences() []Reference {
+	set := make(map[Reference]struct{})
+	walk(e.root, func(c *comparison) {
+		if c.segment != "" {
+			set[Reference{Segment: c.segment, Dimension: c.dimension}] = struct{}{}
+		}
+	})
+
+	references := make([]Reference, 0, len(set))
+	for reference := range set {
+		references = append(references, reference)
+	}
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Segment != references[j].Segment {
+			return references[i].Segment < references[j].Segment
+		}
+		return references[i].Dimension < references[j].Dimension
+	})
+	return references
+}
+
+// Program evaluates a compiled expression against normalized request parameters.
+// A comparison on a dimension missing from the request is false, its negation true.
+type Program func(params map[string]string, segments Segments) bool
+
+// Compile turns the expression into a Program comparing values with the semantics of
+// the registry dimensions. Values that are not of the dimension type never match.
+func (e *Expr) Compile(registry *dimensions.Registry) Program {
+	return compile(registry, e.root)
+}
+
+func compile(registry *dimensions.Registry, n node) Program {
+	switch n := n.(type) {
+	case *logical:
+		left, right := compile(registry, n.left), compile(registry, n.right)
+		if n.op == opAnd {
+			return func(params map[string]string, segments Segments) bool {
+				return left(params, segments) && right(params, segments)
+			}
+		}
+		return func(params map[string]string, segments Segments) bool {
+			return left(params, segments) || right(params, segments)
+		}
+
+	case *negation:
+		x := compile(registry, n.x)
+		return func(params map[string]string, segments Segments) bool {
+			return !x(params, segments)
+		}
+
+	case *comparison:
+		match := matcher(registry.Lookup(n.dimension), n)
+		negated := n.op == opNe || n.op == opNotIn
+		return func(params map[string]string, segments Segments) bool {
+			value, ok := params[n.dimension]
+			if !ok {
+				return negated
+			}
+			return match(value, segments) != negated
+		}
+	}
+	return func(map[string]string, Segments) bool { return false }
+}
+
+// matcher returns the positive match of a comparison, the negated operators use the
+// matcher of their positive form
+func matcher(dimension *dimensions.Dimension, c *comparison) func(string, Segments) bool {
+	if c.segment != "" {
+		return func(value string, segments Segments) bool {
+			return segments != nil && segments.Contains(c.segment, value)
+		}
+	}
+
+	switch c.op {
+	case opLt, opLe, opGt, opGe:
+		if dimension.Type == storage.TypeInt {
+			bound, err := strconv.Atoi(c.values[0])
+			if err != nil {
+				return func(string, Segments) bool { return false }
+			}
+			return func(value string, _ Segments) bool {
+				n, err := strconv.Atoi(value)
+				return err == nil && compareInts(n, c.op, bound)
+			}
+		}
+		// version ranges take the comparators
+		match := dimension.Matcher([]string{c.op + c.values[0]})
+		return func(value string, _ Segments) bool { return match(value) }
+	}
+
+	match := dimension.Matcher(c.values)
+	return func(value string, _ Segments) bool { return match(value) }
+}
+
+func compareInts(n int, op string, bound int) bool {
+	switch op {
+	case opLt:
+		return n < bound
+	case opLe:
+		return n <= bound
+	case opGt:
+		return n > bound
+	default:
+		return n >= bound
+	}
+}
+
+// Clauses over-approximates the expression by a disjunction of include/exclude rule
+// sets, for stores filtering campaigns on the equality comparisons before evaluating
+// the expression. Ordering comparisons and segments are left out of the clauses. It
+// returns false when the expression cannot be narrowed down by clauses.
+func (e *Expr) Clauses() ([]map[string][]string, bool) {
+	dnf, ok := clauses(e.root, false)
+	if !ok {
+		return nil, false
+	}
+
+	rules := make([]map[string][]string, 0, len(dnf))
+	for _, clause := range dnf {
+		if len(clause) == 0 {
+			// a clause without rules accepts every request
+			return nil, false
+		}
+		rules = append(rules, clause)
+	}
+	return rules, true
+}
+
+// clauses returns the disjunctive normal form of n, negated when negate is set, as
+// rule sets. It returns false when the form has more than maxClauses clauses.
+func clauses(n node, negate bool) ([]map[string][]string, bool) {
+	switch n := n.(type) {
+	case *negation:
+		return clauses(n.x, !negate)
+
+	case *logical:
+		left, ok := clauses(n.left, negate)
+		if !ok {
+			return nil, false
+		}
+		right, ok := clauses(n.right, negate)
+		if !ok {
+			return nil, false
+		}
+
+		// De Morgan: a negated conjunction is a disjunction and the other way around
+		if (n.op == opOr) != negate {
+			if len(left)+len(right) > maxClauses {
+				return nil, false
+			}
+			return append(left, right...), true
+		}
+
+		if len(left)*len(right) > maxClauses {
+			return nil, false
+		}
+		var product []map[string][]string
+		for _, l := range left {
+			for _, r := range right {
+				product = append(product, merge(l, r))
+			}
+		}
+		return product, true
+
+	case *comparison:
+		include := n.op == opEq || n.op == opIn
+		exclude := n.op == opNe || n.op == opNotIn
+		if n.segment != "" || (!include && !exclude) {
+			// not narrowed down, any request may match
+			return []map[string][]string{{}}, true
+		}
+		if negate {
+			include, exclude = exclude, include
+		}
+		key := "exclude" + n.dimension
+		if include {
+			key = "include" + n.dimension
+		}
+		return []map[string][]string{{key: n.values}}, true
+	}
+	return []map[string][]string{{}}, true
+}
+
+// merge returns the conjunction of two rule sets. Excluded values add up, of two include
+// lists only the first is kept, which over-approximates their intersection.
+func merge(a, b map[string][]string) map[string][]string {
+	merged := make(map[string][]string, len(a)+len(b))
+	for key, values := range a {
+		merged[key] = values
+	}
+	for key, values := range b {
+		existing, ok := merged[key]
+		switch {
+		case !ok:
+			merged[key] = values
+		case strings.HasPrefix(key, "exclude"):
+			merged[key] = append(append([]string{}, existing...), values...)
+		}
+	}
+	return merged
+}
+
+// walk calls fn on every comparison of n, in source order
+func walk(n node, fn func(*comparison)) {
+	switch n := n.(type) {
+	case *logical:
+		walk(n.left, fn)
+		walk(n.right, fn)
+	case *negation:
+		walk(n.x, fn)
+	case *comparison:
+		fn(n)
+	}
+}
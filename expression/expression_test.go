@@ -0,0 +1,129 @@
+package expression
+
+import (
+	"testing"
+
+	"delivery-service/dimensions"
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var registry = dimensions.New([]storage.Dimension{
+	{Name: "app"}, {Name: "country"}, {Name: "os"}, {Name: "os_version"},
+	{Name: "age", Type: storage.TypeInt},
+})
+
+type segments map[string][]string
+
+func (s segments) Contains(name, value string) bool {
+	for _, v := range s[name] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func eval(t *testing.T, source string, params map[string]string) bool {
+	expr, err := Parse(source)
+	assert.NoError(t, err)
+	assert.NoError(t, expr.Check(registry))
+	return expr.Compile(registry)(params, segments{"whales": {"com.big.spender"}})
+}
+
+// and binds tighter than or, comparisons follow the dimension types
+func TestCompile1(t *testing.T) {
+	source := `(country in ["US", "CA"] and os == "ios") or app in segment("whales")`
+
+	assert.True(t, eval(t, source, map[string]string{"country": "us", "os": "ios", "app": "com.a.b"}))
+	assert.False(t, eval(t, source, map[string]string{"country": "de", "os": "ios", "app": "com.a.b"}))
+	assert.True(t, eval(t, source, map[string]string{"country": "de", "os": "android", "app": "com.big.spender"}))
+
+	assert.True(t, eval(t, `country == "us" or os == "ios" and app == "com.a.b"`, map[string]string{"country": "us", "os": "android"}))
+	assert.True(t, eval(t, `os_version >= 14.2 && age < 30`, map[string]string{"os_version": "15.0.0", "age": "20"}))
+	assert.False(t, eval(t, `os_version >= "14.2" and age < 30`, map[string]string{"os_version": "14.1.0", "age": "20"}))
+	assert.True(t, eval(t, `not (os in ["android"]) and country not in ["de"]`, map[string]string{"os": "ios", "country": "us"}))
+	assert.True(t, eval(t, `user_id in segment("whales")`, map[string]string{"user_id": "com.big.spender"}))
+}
+
+// comparisons on a dimension missing from the request are false, their negations true
+func TestCompile2(t *testing.T) {
+	assert.False(t, eval(t, `os == "ios"`, map[string]string{}))
+	assert.True(t, eval(t, `os != "ios"`, map[string]string{}))
+	assert.True(t, eval(t, `!(os == "ios")`, map[string]string{}))
+}
+
+// parse errors point at the offending token
+func TestParse1(t *testing.T) {
+	for source, message := range map[string]string{
+		`country in ["us", "ca"`:            `at 23: expected "," or "]", found end of expression`,
+		`country = "us"`:                    `at 9: unexpected character '='`,
+		`country == "us" and`:               `at 20: expected a dimension, found end of expression`,
+		`(os == "ios"`:                      `at 13: expected ")", found end of expression`,
+		`os == "ios" os == "android"`:       `at 13: unexpected "os"`,
+		`app in segment(whales)`:            `at 16: expected a segment name string, found "whales"`,
+		`os "ios"`:                          `at 4: expected an operator after "os", found string "ios"`,
+		`country == "us`:                    `at 12: unterminated string`,
+		`app not ["com.a.b"]`:               `at 9: expected "in" after "not", found "["`,
+		`os == ios`:                         `at 7: expected a string or a number, found "ios"`,
+		`country in ["us"] or and os == ""`: `at 22: expected a dimension, found "and"`,
+	} {
+		_, err := Parse(source)
+		if assert.Error(t, err, source) {
+			assert.Equal(t, message, err.Error(), source)
+		}
+	}
+}
+
+// type errors name the dimension and the value
+func TestCheck1(t *testing.T) {
+	for source, message := range map[string]string{
+		`OS == "ios"`:                      `at 1: unknown dimension OS`,
+		`os == "symbian"`:                  `at 1: os "symbian": unknown os, expected one of android, ios, ipados, tvos, watchos, macos, windows, linux, chromeos, fireos, harmonyos, tizen, webos`,
+		`country in ["usa"]`:               `at 1: country "usa": not an ISO 3166-1 alpha-2 country code`,
+		`os > "ios"`:                       `at 1: > compares version and int dimensions, os is enum`,
+		`age >= "twenty"`:                  `at 1: age >= needs an integer, not "twenty"`,
+		`os_version < "latest"`:            `at 1: os_version < needs a version, not "latest"`,
+		`os == "ios" and user_id == "abc"`: `at 17: user_id is only compared to segments`,
+	} {
+		expr, err := Parse(source)
+		assert.NoError(t, err, source)
+		err = expr.Check(registry)
+		if assert.Error(t, err, source) {
+			assert.Equal(t, message, err.Error(), source)
+		}
+	}
+}
+
+// clauses over-approximate the expression with include/exclude rule sets
+func TestClauses1(t *testing.T) {
+	expr, _ := Parse(`(country in ["US", "CA"] and os == "ios") or (app in segment("whales") and country != "de")`)
+	clauses, ok := expr.Clauses()
+	assert.True(t, ok)
+	assert.Equal(t, []map[string][]string{
+		{"includecountry": {"US", "CA"}, "includeos": {"ios"}},
+		{"excludecountry": {"de"}},
+	}, clauses)
+
+	expr, _ = Parse(`not (os == "ios" or os == "android")`)
+	clauses, ok = expr.Clauses()
+	assert.True(t, ok)
+	assert.Equal(t, []map[string][]string{{"excludeos": {"ios", "android"}}}, clauses)
+
+	// a clause accepting every request leaves nothing to narrow down
+	expr, _ = Parse(`os == "ios" or age > 20`)
+	_, ok = expr.Clauses()
+	assert.False(t, ok)
+
+	assert.Equal(t, []Reference{{Segment: "churned", Dimension: "user_id"}, {Segment: "whales", Dimension: "app"}},
+		mustParse(`app in segment("whales") or user_id not in segment("churned") or app not in segment("whales")`).SegmentReferences())
+}
+
+func mustParse(source string) *Expr {
+	expr, err := Parse(source)
+	if err != nil {
+		panic(err)
+	}
+	return expr
+}
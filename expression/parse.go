@@ -0,0 +1,305 @@
+package expression
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Error is a parse or type error of an expression, Pos is the 1-based position of the
+// offending token in the expression
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return "at " + strconv.Itoa(e.Pos) + ": " + e.Msg
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return "string " + strconv.Quote(t.text)
+	}
+	return strconv.Quote(t.text)
+}
+
+// lex splits an expression into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, &Error{Pos: pos, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: b.String(), pos: pos})
+			i = j + 1
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[i:j]), pos: pos})
+			i = j
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			// numbers take versions like 14.2.1 as well
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[i:j]), pos: pos})
+			i = j
+
+		case strings.ContainsRune("()[],", r):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r), pos: pos})
+			i++
+
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &Error{Pos: pos, Msg: "unexpected character " + strconv.QuoteRune(r)}
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: pos})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes) + 1}), nil
+}
+
+// parser is a recursive descent parser of the grammar:
+//
+//	expr       = and { ("or" | "||") and }
+//	and        = unary { ("and" | "&&") unary }
+//	unary      = ("not" | "!") unary | "(" expr ")" | comparison
+//	comparison = dimension ("==" | "!=" | "<" | "<=" | ">" | ">=") value
+//	           | dimension ["not"] "in" ( "[" value { "," value } "]" | "segment" "(" string ")" )
+//	value      = string | number
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether the next token is one of the given keywords or operators,
+// and consumes it when it is
+func (p *parser) keyword(words ...string) bool {
+	t := p.peek()
+	if t.kind != tokenIdent && t.kind != tokenOp {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) && (t.kind == tokenOp || isKeyword(word)) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) error {
+	t := p.next()
+	if t.kind != tokenPunct || t.text != punct {
+		return &Error{Pos: t.pos, Msg: "expected " + strconv.Quote(punct) + ", found " + t.describe()}
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: opOr, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and", "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: opAnd, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.keyword("not", "!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{x: x}, nil
+	}
+
+	if t := p.peek(); t.kind == tokenPunct && t.text == "(" {
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	t := p.next()
+	if t.kind != tokenIdent || isKeyword(t.text) {
+		return nil, &Error{Pos: t.pos, Msg: "expected a dimension, found " + t.describe()}
+	}
+	c := &comparison{pos: t.pos, dimension: t.text}
+
+	opToken := p.peek()
+	switch {
+	case p.keyword("in"):
+		c.op = opIn
+	case p.keyword("not"):
+		if !p.keyword("in") {
+			return nil, &Error{Pos: p.peek().pos, Msg: "expected \"in\" after \"not\", found " + p.peek().describe()}
+		}
+		c.op = opNotIn
+	case opToken.kind == tokenOp && isComparator(opToken.text):
+		p.next()
+		c.op = opToken.text
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c.values = []string{value}
+		return c, nil
+	default:
+		return nil, &Error{Pos: opToken.pos, Msg: "expected an operator after " + strconv.Quote(c.dimension) + ", found " + opToken.describe()}
+	}
+
+	if t := p.peek(); t.kind == tokenIdent && t.text == "segment" {
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		name := p.next()
+		if name.kind != tokenString || name.text == "" {
+			return nil, &Error{Pos: name.pos, Msg: "expected a segment name string, found " + name.describe()}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		c.segment = name.text
+		return c, nil
+	}
+
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c.values = append(c.values, value)
+
+		t := p.next()
+		if t.kind == tokenPunct && t.text == "]" {
+			return c, nil
+		}
+		if t.kind != tokenPunct || t.text != "," {
+			return nil, &Error{Pos: t.pos, Msg: "expected \",\" or \"]\", found " + t.describe()}
+		}
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.next()
+	if t.kind != tokenString && t.kind != tokenNumber {
+		return "", &Error{Pos: t.pos, Msg: "expected a string or a number, found " + t.describe()}
+	}
+	return t.text, nil
+}
+
+func isKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not", "in":
+		return true
+	}
+	return false
+}
+
+func isComparator(op string) bool {
+	switch op {
+	case opEq, opNe, opLt, opLe, opGt, opGe:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package frequency
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// StoreMemory keeps the impression counters in the service memory
+	StoreMemory = "memory"
+	// StoreRedis keeps the impression counters in a redis compatible server
+	StoreRedis = "redis"
+	// StoreOff disables frequency capping
+	StoreOff = "off"
+)
+
+var (
+	// Store is the counter store selected by FREQUENCY_STORE
+	Store = StoreMemory
+	// RedisAddr, RedisPassword and RedisDB locate the redis server of the redis store
+	RedisAddr     = "localhost:6379"
+	RedisPassword = ""
+	RedisDB       = 0
+)
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "frequency")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	if store := os.Getenv("FREQUENCY_STORE"); store != "" {
+		Store = store
+	}
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		RedisAddr = addr
+	}
+	RedisPassword = os.Getenv("REDIS_PASSWORD")
+	if db := os.Getenv("REDIS_DB"); db != "" {
+		if n, err := strconv.Atoi(db); err == nil {
+			RedisDB = n
+		} else {
+			level.Error(logger).Log("msg", "invalid REDIS_DB, using 0", "db", db)
+		}
+	}
+}
+
+// Counter counts the impressions of campaigns per user
+type Counter interface {
+	// Counts returns, per campaign id of windows, the impressions of userID within the
+	// window of the campaign ending at now
+	Counts(ctx context.Context, userID string, windows map[string]time.Duration, now time.Time) (map[string]int, error)
+	// Record adds an impression of campaignID for userID at now, kept for window
+	Record(ctx context.Context, userID, campaignID string, window time.Duration, now time.Time) error
+}
+
+// New returns the counter of the FREQUENCY_STORE store, nil when frequency capping is off
+func New() Counter {
+	switch Store {
+	case StoreOff:
+		return nil
+	case StoreRedis:
+		level.Info(logger).Log("msg", "counting impressions in redis", "addr", RedisAddr, "db", RedisDB)
+		return NewRedisCounter(NewRedisClient())
+	case StoreMemory:
+	default:
+		level.Error(logger).Log("msg", "unknown FREQUENCY_STORE, using memory", "store", Store)
+	}
+	return NewMemoryCounter()
+}
+
+// NewRedisClient returns a client of the redis server of REDIS_ADDR, REDIS_PASSWORD and REDIS_DB
+func NewRedisClient() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: RedisAddr, Password: RedisPassword, DB: RedisDB})
+}
+
+// Window returns the window of a frequency cap
+func Window(c *storage.FrequencyCap) (time.Duration, error) {
+	window, err := time.ParseDuration(c.Window)
+	if err != nil || window <= 0 {
+		return 0, errors.New("frequencyCap window must be a positive duration like 24h: " + c.Window)
+	}
+	return window, nil
+}
+
+// Validate checks the impressions and window of a frequency cap
+func Validate(c *storage.FrequencyCap) error {
+	if c == nil {
+		return nil
+	}
+	if c.Impressions < 1 {
+		return errors.New("frequencyCap impressions must be at least 1")
+	}
+	_, err := Window(c)
+	return err
+}
+
+// Capped returns the ids of the campaigns whose frequency cap userID reached at now
+func Capped(ctx context.Context, counter Counter, userID string, campaigns []storage.Campaign, now time.Time) (map[string]struct{}, error) {
+	windows := make(map[string]time.Duration)
+	for _, campaign := range campaigns {
+		if campaign.FrequencyCap == nil {
+			continue
+		}
+		if window, err := Window(campaign.FrequencyCap); err == nil {
+			windows[campaign.ID] = window
+		}
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+
+	counts, err := counter.Counts(ctx, userID, windows, now)
+	if err != nil {
+		return nil, err
+	}
+
+	capped := make(map[string]struct{})
+	for _, campaign := range campaigns {
+		if _, ok := windows[campaign.ID]; ok && counts[campaign.ID] >= campaign.FrequencyCap.Impressions {
+			capped[campaign.ID] = struct{}{}
+		}
+	}
+	return capped, nil
+}
@@ -0,0 +1,77 @@
+package frequency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func counters(t *testing.T) map[string]Counter {
+	server := miniredis.RunT(t)
+	return map[string]Counter{
+		"memory": NewMemoryCounter(),
+		"redis":  NewRedisCounter(redis.NewClient(&redis.Options{Addr: server.Addr()})),
+	}
+}
+
+// impressions are counted per user and campaign within a sliding window
+func TestCounter1(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, counter := range counters(t) {
+		assert.NoError(t, counter.Record(ctx, "u1", "c1", time.Hour, start), name)
+		assert.NoError(t, counter.Record(ctx, "u1", "c1", time.Hour, start.Add(30*time.Minute)), name)
+		assert.NoError(t, counter.Record(ctx, "u1", "c2", time.Hour, start), name)
+		assert.NoError(t, counter.Record(ctx, "u2", "c1", time.Hour, start), name)
+
+		windows := map[string]time.Duration{"c1": time.Hour, "c2": time.Hour, "c3": time.Hour}
+
+		counts, err := counter.Counts(ctx, "u1", windows, start.Add(45*time.Minute))
+		assert.NoError(t, err, name)
+		assert.Equal(t, 2, counts["c1"], name)
+		assert.Equal(t, 1, counts["c2"], name)
+		assert.Equal(t, 0, counts["c3"], name)
+
+		// the first impression left the window
+		counts, err = counter.Counts(ctx, "u1", windows, start.Add(time.Hour))
+		assert.NoError(t, err, name)
+		assert.Equal(t, 1, counts["c1"], name)
+		assert.Equal(t, 0, counts["c2"], name)
+	}
+}
+
+// capped campaigns are the ones whose impressions reached the cap
+func TestCapped1(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	counter := NewMemoryCounter()
+
+	campaigns := []storage.Campaign{
+		{ID: "c1", FrequencyCap: &storage.FrequencyCap{Impressions: 1, Window: "24h"}},
+		{ID: "c2", FrequencyCap: &storage.FrequencyCap{Impressions: 2, Window: "24h"}},
+		{ID: "c3"},
+	}
+	for _, id := range []string{"c1", "c2", "c3"} {
+		assert.NoError(t, counter.Record(ctx, "u1", id, 24*time.Hour, now))
+	}
+
+	capped, err := Capped(ctx, counter, "u1", campaigns, now)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"c1": {}}, capped)
+}
+
+// frequency caps need a positive number of impressions and window
+func TestValidate1(t *testing.T) {
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate(&storage.FrequencyCap{Impressions: 3, Window: "24h"}))
+	assert.Error(t, Validate(&storage.FrequencyCap{Impressions: 0, Window: "24h"}))
+	assert.Error(t, Validate(&storage.FrequencyCap{Impressions: 3, Window: "1d"}))
+	assert.Error(t, Validate(&storage.FrequencyCap{Impressions: 3, Window: "-1h"}))
+}
@@ -0,0 +1,94 @@
+package frequency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum time between two removals of the expired counters
+const sweepInterval = time.Minute
+
+// MemoryCounter is a Counter keeping the impression times in memory, for single
+// instance deployments and tests
+type MemoryCounter struct {
+	mu        sync.Mutex
+	counters  map[string]*impressions
+	nextSweep time.Time
+}
+
+type impressions struct {
+	times []time.Time
+	// expires is the time the last impression leaves its window
+	expires time.Time
+}
+
+// NewMemoryCounter creates an empty MemoryCounter
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{counters: make(map[string]*impressions)}
+}
+
+// Counts returns the impressions of userID within the window of each campaign
+func (c *MemoryCounter) Counts(ctx context.Context, userID string, windows map[string]time.Duration, now time.Time) (map[string]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int, len(windows))
+	for campaignID, window := range windows {
+		counter, ok := c.counters[key(userID, campaignID)]
+		if !ok {
+			continue
+		}
+		since := now.Add(-window)
+		for _, t := range counter.times {
+			if t.After(since) {
+				counts[campaignID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// Record adds an impression of campaignID for userID at now
+func (c *MemoryCounter) Record(ctx context.Context, userID, campaignID string, window time.Duration, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(userID, campaignID)
+	counter, ok := c.counters[k]
+	if !ok {
+		counter = &impressions{}
+		c.counters[k] = counter
+	}
+
+	since := now.Add(-window)
+	kept := counter.times[:0]
+	for _, t := range counter.times {
+		if t.After(since) {
+			kept = append(kept, t)
+		}
+	}
+	counter.times = append(kept, now)
+	counter.expires = now.Add(window)
+
+	c.sweep(now)
+	return nil
+}
+
+// sweep removes the counters whose impressions all left their window
+func (c *MemoryCounter) sweep(now time.Time) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+	c.nextSweep = now.Add(sweepInterval)
+
+	for k, counter := range c.counters {
+		if !now.Before(counter.expires) {
+			delete(c.counters, k)
+		}
+	}
+}
+
+func key(userID, campaignID string) string {
+	return "freq:" + campaignID + ":" + userID
+}
@@ -0,0 +1,60 @@
+package frequency
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCounter is a Counter keeping a sorted set of impression times per user and
+// campaign in a redis compatible server, shared by every instance of the service
+type RedisCounter struct {
+	client redis.Cmdable
+}
+
+// NewRedisCounter creates a RedisCounter on client
+func NewRedisCounter(client redis.Cmdable) *RedisCounter {
+	return &RedisCounter{client: client}
+}
+
+// Counts returns the impressions of userID within the window of each campaign, in a
+// single round trip
+func (c *RedisCounter) Counts(ctx context.Context, userID string, windows map[string]time.Duration, now time.Time) (map[string]int, error) {
+	cmds := make(map[string]*redis.IntCmd, len(windows))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for campaignID, window := range windows {
+			since := "(" + strconv.FormatInt(now.Add(-window).UnixNano(), 10)
+			cmds[campaignID] = pipe.ZCount(ctx, key(userID, campaignID), since, "+inf")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(cmds))
+	for campaignID, cmd := range cmds {
+		counts[campaignID] = int(cmd.Val())
+	}
+	return counts, nil
+}
+
+// Record adds an impression of campaignID for userID at now, drops the impressions out
+// of the window and lets the set expire with its last impression
+func (c *RedisCounter) Record(ctx context.Context, userID, campaignID string, window time.Duration, now time.Time) error {
+	k := key(userID, campaignID)
+	score := now.UnixNano()
+	// impressions recorded at the same time by different instances are distinct members
+	member := strconv.FormatInt(score, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, k, redis.Z{Score: float64(score), Member: member})
+		pipe.ZRemRangeByScore(ctx, k, "-inf", strconv.FormatInt(now.Add(-window).UnixNano(), 10))
+		pipe.PExpire(ctx, k, window)
+		return nil
+	})
+	return err
+}
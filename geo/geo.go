@@ -0,0 +1,250 @@
+package geo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const (
+	// SourceClient marks a country supplied by the client
+	SourceClient = "client"
+	// SourceInferred marks a country inferred from the client ip
+	SourceInferred = "inferred"
+)
+
+// Database is the path of the MaxMind format database of GEOIP_DB, geolocation is off when empty
+var Database = ""
+
+// TrustedProxies are the networks of the proxies whose X-Forwarded-For entries are
+// trusted, set by TRUSTED_PROXIES. Loopback and private networks by default.
+var TrustedProxies = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "geo")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	Database = os.Getenv("GEOIP_DB")
+	if proxies, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		prefixes, err := ParsePrefixes(proxies)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid TRUSTED_PROXIES, using the default", "value", proxies, "err", err)
+		} else {
+			TrustedProxies = prefixes
+		}
+	}
+}
+
+// ParsePrefixes parses a comma separated list of CIDR blocks and addresses, an address
+// is a block of one address
+func ParsePrefixes(list string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Location is where an ip address is located, empty fields are unknown
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country, lower case
+	Country string
+	// Region is the ISO 3166-2 code of the first level subdivision, like GB-ENG
+	Region string
+	// City is the English name of the city
+	City string
+}
+
+// Resolver locates ip addresses
+type Resolver interface {
+	// Lookup returns the location of addr, false when it is unknown
+	Lookup(addr netip.Addr) (Location, bool)
+}
+
+// New returns the resolver of the GEOIP_DB database, nil when it is not set or cannot be opened
+func New() Resolver {
+	if Database == "" {
+		return nil
+	}
+	resolver, err := Open(Database)
+	if err != nil {
+		level.Error(logger).Log("msg", "opening GEOIP_DB failed, countries are not inferred", "path", Database, "err", err)
+		return nil
+	}
+	level.Info(logger).Log("msg", "inferring countries from client ips", "path", Database)
+	return resolver
+}
+
+// MaxMindResolver is a Resolver reading a MaxMind format country or city database,
+// like GeoLite2-City.mmdb
+type MaxMindResolver struct {
+	reader *maxminddb.Reader
+}
+
+// record holds the fields of the GeoIP2 and GeoLite2 country and city records a Location is made of
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Open memory maps the MaxMind format database at path
+func Open(path string) (*MaxMindResolver, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindResolver{reader: reader}, nil
+}
+
+// FromBytes reads a MaxMind format database from memory
+func FromBytes(database []byte) (*MaxMindResolver, error) {
+	reader, err := maxminddb.FromBytes(database)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindResolver{reader: reader}, nil
+}
+
+// Lookup returns the location of addr, the registered country of the network stands
+// for the country when the database has no better one
+func (r *MaxMindResolver) Lookup(addr netip.Addr) (Location, bool) {
+	var rec record
+	if err := r.reader.Lookup(net.IP(addr.Unmap().AsSlice()), &rec); err != nil {
+		level.Error(logger).Log("method", "Lookup", "msg", "geoip lookup failed", "ip", addr, "err", err)
+		return Location{}, false
+	}
+
+	location := Location{Country: strings.ToLower(rec.Country.ISOCode), City: rec.City.Names["en"]}
+	if location.Country == "" {
+		location.Country = strings.ToLower(rec.RegisteredCountry.ISOCode)
+	}
+	if len(rec.Subdivisions) > 0 && rec.Subdivisions[0].ISOCode != "" && location.Country != "" {
+		location.Region = strings.ToUpper(location.Country) + "-" + rec.Subdivisions[0].ISOCode
+	}
+	return location, location.Country != ""
+}
+
+// Close unmaps the database
+func (r *MaxMindResolver) Close() error {
+	return r.reader.Close()
+}
+
+// ClientIP returns the address of the client of r, see ParseClientIP
+func ClientIP(r *http.Request) (netip.Addr, bool) {
+	return ParseClientIP(r.Header.Values("X-Forwarded-For"), r.RemoteAddr, TrustedProxies)
+}
+
+// ParseClientIP returns the address of the client of a request from remote, a host and
+// port or a bare host, and its X-Forwarded-For headers. The hops are walked from remote
+// back through the forwarded addresses while they are trusted proxies, the client is the
+// right-most untrusted hop: the entries left of it are set by the client and ignored. A
+// remote that is not an ip address, like a unix socket, is a local proxy.
+func ParseClientIP(forwarded []string, remote string, trusted []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	addr, err := netip.ParseAddr(host)
+	if err == nil && !isTrusted(addr.Unmap(), trusted) {
+		return addr.Unmap(), true
+	}
+	client, ok := addr.Unmap(), err == nil
+
+	var hops []string
+	for _, header := range forwarded {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client, ok = hop.Unmap(), true
+		if !isTrusted(client, trusted) {
+			break
+		}
+	}
+	return client, ok
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// lookup is the location of a request, looked up on first use
+type lookup struct {
+	once     sync.Once
+	find     func() (Location, bool)
+	location Location
+	ok       bool
+}
+
+// NewContext returns a copy of ctx carrying the location inferred from the client ip
+func NewContext(ctx context.Context, location Location) context.Context {
+	return WithLookup(ctx, func() (Location, bool) { return location, true })
+}
+
+// WithLookup returns a copy of ctx carrying the location find returns, only called by the
+// first FromContext so that requests that do not need their location skip the lookup
+func WithLookup(ctx context.Context, find func() (Location, bool)) context.Context {
+	return context.WithValue(ctx, contextKey{}, &lookup{find: find})
+}
+
+// FromContext returns the location inferred from the client ip of the request of ctx
+func FromContext(ctx context.Context) (Location, bool) {
+	l, ok := ctx.Value(contextKey{}).(*lookup)
+	if !ok {
+		return Location{}, false
+	}
+	l.once.Do(func() { l.location, l.ok = l.find() })
+	return l.location, l.ok
+}
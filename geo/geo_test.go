@@ -0,0 +1,243 @@
+package geo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http/httptest"
+	"net/netip"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// node is a node of the search tree of a test database, children are nodes or data offsets
+type node struct {
+	children [2]any
+}
+
+// encode appends v in the MaxMind data section format to buf
+func encode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		buf.WriteByte(2<<5 | byte(len(v)))
+		buf.WriteString(v)
+	case uint16:
+		buf.WriteByte(5<<5 | 2)
+		buf.Write(binary.BigEndian.AppendUint16(nil, v))
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		buf.Write(binary.BigEndian.AppendUint32(nil, v))
+	case []any:
+		buf.Write([]byte{byte(len(v)), 11 - 7})
+		for _, item := range v {
+			encode(buf, item)
+		}
+	case map[string]any:
+		buf.WriteByte(7<<5 | byte(len(v)))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			encode(buf, key)
+			encode(buf, v[key])
+		}
+	}
+}
+
+// database builds an IPv4 MaxMind database with 24 bit records mapping networks to records
+func database(networks map[string]map[string]any) []byte {
+	var data bytes.Buffer
+	root := &node{}
+	for prefix, rec := range networks {
+		network := netip.MustParsePrefix(prefix)
+		offset := data.Len()
+		encode(&data, rec)
+
+		ip, current := network.Addr().As4(), root
+		for i := 0; i < network.Bits(); i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == network.Bits()-1 {
+				current.children[bit] = offset
+				break
+			}
+			if current.children[bit] == nil {
+				current.children[bit] = &node{}
+			}
+			current = current.children[bit].(*node)
+		}
+	}
+
+	// Number the nodes breadth first, the root first
+	nodes := []*node{root}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if child, ok := child.(*node); ok {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	numbers := make(map[*node]int, len(nodes))
+	for i, n := range nodes {
+		numbers[n] = i
+	}
+
+	var db bytes.Buffer
+	for _, n := range nodes {
+		for _, child := range n.children {
+			record := len(nodes)
+			switch child := child.(type) {
+			case *node:
+				record = numbers[child]
+			case int:
+				record = len(nodes) + 16 + child
+			}
+			db.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	db.Write(make([]byte, 16))
+	db.Write(data.Bytes())
+	db.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(&db, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint32(1700000000),
+		"database_type":               "Test-City",
+		"description":                 map[string]any{"en": "test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})
+	return db.Bytes()
+}
+
+// test the lookup of city, country and registered country records
+func TestLookup1(t *testing.T) {
+	resolver, err := FromBytes(database(map[string]map[string]any{
+		"81.2.69.0/24": {
+			"country":      map[string]any{"iso_code": "GB"},
+			"subdivisions": []any{map[string]any{"iso_code": "ENG"}},
+			"city":         map[string]any{"names": map[string]any{"en": "London", "de": "London"}},
+		},
+		"1.0.0.0/16":      {"registered_country": map[string]any{"iso_code": "AU"}},
+		"10.0.0.0/8":      {"city": map[string]any{"names": map[string]any{"en": "Nowhere"}}},
+		"216.160.83.0/24": {"country": map[string]any{"iso_code": "US"}},
+	}))
+	assert.NoError(t, err)
+	defer resolver.Close()
+
+	location, ok := resolver.Lookup(netip.MustParseAddr("81.2.69.160"))
+	assert.True(t, ok)
+	assert.Equal(t, Location{Country: "gb", Region: "GB-ENG", City: "London"}, location)
+
+	location, ok = resolver.Lookup(netip.MustParseAddr("::ffff:216.160.83.56"))
+	assert.True(t, ok)
+	assert.Equal(t, Location{Country: "us"}, location)
+
+	location, ok = resolver.Lookup(netip.MustParseAddr("1.0.12.1"))
+	assert.True(t, ok)
+	assert.Equal(t, Location{Country: "au"}, location)
+
+	// Without a country the location is unknown
+	_, ok = resolver.Lookup(netip.MustParseAddr("10.1.2.3"))
+	assert.False(t, ok)
+
+	_, ok = resolver.Lookup(netip.MustParseAddr("192.168.1.1"))
+	assert.False(t, ok)
+
+	_, err = FromBytes([]byte("not a database"))
+	assert.Error(t, err)
+}
+
+// test the client ip of forwarded and direct requests
+func TestClientIP1(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/delivery", nil)
+	r.RemoteAddr = "10.0.0.1:52100"
+	addr, ok := ClientIP(r)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1", addr.String())
+
+	r.Header.Set("X-Forwarded-For", "81.2.69.160, 10.0.0.2")
+	addr, ok = ClientIP(r)
+	assert.True(t, ok)
+	assert.Equal(t, "81.2.69.160", addr.String())
+
+	// Entries left of the first untrusted hop are set by the client
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 81.2.69.160, 10.0.0.2")
+	addr, ok = ClientIP(r)
+	assert.True(t, ok)
+	assert.Equal(t, "81.2.69.160", addr.String())
+
+	// Forwarded entries of an untrusted remote are ignored
+	r.RemoteAddr = "216.160.83.56:52100"
+	addr, ok = ClientIP(r)
+	assert.True(t, ok)
+	assert.Equal(t, "216.160.83.56", addr.String())
+	r.RemoteAddr = "10.0.0.1:52100"
+
+	// An invalid forwarded address falls back to the remote address
+	r.Header.Set("X-Forwarded-For", "unknown")
+	addr, ok = ClientIP(r)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1", addr.String())
+
+	r.Header.Del("X-Forwarded-For")
+	r.RemoteAddr = "[::ffff:81.2.69.160]:443"
+	addr, ok = ClientIP(r)
+	assert.True(t, ok)
+	assert.Equal(t, "81.2.69.160", addr.String())
+
+	r.RemoteAddr = "pipe"
+	_, ok = ClientIP(r)
+	assert.False(t, ok)
+
+	_, ok = FromContext(context.Background())
+	assert.False(t, ok)
+	location, ok := FromContext(NewContext(context.Background(), Location{Country: "gb"}))
+	assert.True(t, ok)
+	assert.Equal(t, "gb", location.Country)
+}
+
+// test the client ip behind trusted proxies, by address and by block
+func TestClientIP2(t *testing.T) {
+	trusted, err := ParsePrefixes("203.0.113.0/24, 198.51.100.7")
+	assert.NoError(t, err)
+	assert.Len(t, trusted, 2)
+
+	addr, ok := ParseClientIP([]string{"1.2.3.4, 81.2.69.160", "198.51.100.7"}, "203.0.113.9:443", trusted)
+	assert.True(t, ok)
+	assert.Equal(t, "81.2.69.160", addr.String())
+
+	// Every hop trusted, the left-most is the client
+	addr, ok = ParseClientIP([]string{"198.51.100.7"}, "203.0.113.9:443", trusted)
+	assert.True(t, ok)
+	assert.Equal(t, "198.51.100.7", addr.String())
+
+	// A remote that is not an address, like a unix socket, is a local proxy
+	addr, ok = ParseClientIP([]string{"81.2.69.160"}, "pipe", trusted)
+	assert.True(t, ok)
+	assert.Equal(t, "81.2.69.160", addr.String())
+
+	_, err = ParsePrefixes("10.0.0.0/8, proxy")
+	assert.Error(t, err)
+}
+
+// test that the location is looked up once, on first use
+func TestFromContext1(t *testing.T) {
+	lookups := 0
+	ctx := WithLookup(context.Background(), func() (Location, bool) {
+		lookups++
+		return Location{Country: "gb"}, true
+	})
+	assert.Equal(t, 0, lookups)
+
+	location, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "gb", location.Country)
+	FromContext(ctx)
+	assert.Equal(t, 1, lookups)
+}
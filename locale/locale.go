@@ -0,0 +1,105 @@
+package locale
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// MaxAccepted is the number of Accept-Language tags kept, by decreasing preference
+const MaxAccepted = 8
+
+type contextKey struct{}
+
+// IsTag reports whether tag is a well-formed BCP 47 language tag, like en or pt-BR. The
+// pt_BR form language.Parse also accepts is refused, fallbacks split tags on hyphens.
+func IsTag(tag string) bool {
+	_, err := language.Parse(tag)
+	return err == nil && !strings.Contains(tag, "_")
+}
+
+// Fallbacks returns the chain of tags a tag falls back on, itself first and then its
+// shorter prefixes: zh-Hant-TW, zh-Hant, zh
+func Fallbacks(tag string) []string {
+	var chain []string
+	for tag != "" {
+		chain = append(chain, tag)
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return chain
+}
+
+// Lookup returns the value of the tag of values best matching the preferred languages,
+// most preferred first, with that tag. Each language falls back on its shorter prefixes
+// before the next one is tried, tags are compared case-insensitively. It returns false
+// when no tag matches.
+func Lookup[T any](values map[string]T, preferred []string) (T, string, bool) {
+	for _, lang := range preferred {
+		for _, fallback := range Fallbacks(lang) {
+			for tag, value := range values {
+				if strings.EqualFold(tag, fallback) {
+					return value, tag, true
+				}
+			}
+		}
+	}
+
+	var zero T
+	return zero, "", false
+}
+
+// Chain returns the values of the first preferred language with a matching tag, along
+// its fallback chain: for pt-BR, the pt-BR value then the pt value. Values override the
+// fields of the next ones.
+func Chain[T any](values map[string]T, preferred []string) []T {
+	for _, lang := range preferred {
+		var chain []T
+		for _, fallback := range Fallbacks(lang) {
+			for tag, value := range values {
+				if strings.EqualFold(tag, fallback) {
+					chain = append(chain, value)
+					break
+				}
+			}
+		}
+		if len(chain) > 0 {
+			return chain
+		}
+	}
+	return nil
+}
+
+// ParseAcceptLanguage returns the languages of an Accept-Language header by decreasing
+// quality, without the * wildcard and the tags that do not parse
+func ParseAcceptLanguage(header string) []string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil
+	}
+
+	var languages []string
+	for _, tag := range tags {
+		// the * wildcard parses as mul, multiple languages
+		if tag == language.Und || tag.String() == "mul" || len(languages) == MaxAccepted {
+			continue
+		}
+		languages = append(languages, tag.String())
+	}
+	return languages
+}
+
+// NewContext returns ctx carrying the languages a client accepts, most preferred first
+func NewContext(ctx context.Context, languages []string) context.Context {
+	return context.WithValue(ctx, contextKey{}, languages)
+}
+
+// FromContext returns the languages a client accepts, nil when it declared none
+func FromContext(ctx context.Context) []string {
+	languages, _ := ctx.Value(contextKey{}).([]string)
+	return languages
+}
@@ -0,0 +1,62 @@
+package locale
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tags fall back on their shorter prefixes
+func TestFallbacks1(t *testing.T) {
+	assert.Equal(t, []string{"zh-Hant-TW", "zh-Hant", "zh"}, Fallbacks("zh-Hant-TW"))
+	assert.Equal(t, []string{"pt"}, Fallbacks("pt"))
+	assert.Empty(t, Fallbacks(""))
+}
+
+// the most preferred language matching a tag, or one of its prefixes, wins
+func TestLookup1(t *testing.T) {
+	ctas := map[string]string{"pt": "Baixar", "pt-BR": "Baixe já", "fr": "Télécharger"}
+
+	cta, tag, ok := Lookup(ctas, []string{"pt-br"})
+	assert.True(t, ok)
+	assert.Equal(t, "pt-BR", tag)
+	assert.Equal(t, "Baixe já", cta)
+
+	cta, _, _ = Lookup(ctas, []string{"pt-PT"})
+	assert.Equal(t, "Baixar", cta)
+
+	// pt-AO falls back on pt before fr is tried
+	cta, _, _ = Lookup(ctas, []string{"de", "pt-AO", "fr"})
+	assert.Equal(t, "Baixar", cta)
+
+	_, _, ok = Lookup(ctas, []string{"de", "en"})
+	assert.False(t, ok)
+	_, _, ok = Lookup(ctas, nil)
+	assert.False(t, ok)
+}
+
+// chains list the values of a language and its prefixes, most specific first
+func TestChain1(t *testing.T) {
+	ctas := map[string]string{"pt": "Baixar", "pt-BR": "Baixe já", "fr": "Télécharger"}
+
+	assert.Equal(t, []string{"Baixe já", "Baixar"}, Chain(ctas, []string{"pt-BR"}))
+	assert.Equal(t, []string{"Baixar"}, Chain(ctas, []string{"de", "pt-PT", "fr"}))
+	assert.Empty(t, Chain(ctas, []string{"de"}))
+}
+
+// Accept-Language headers are ordered by quality
+func TestParseAcceptLanguage1(t *testing.T) {
+	assert.Equal(t, []string{"fr-CH", "fr", "en"}, ParseAcceptLanguage("en;q=0.8, fr;q=0.9, fr-CH, *;q=0.5"))
+	assert.Empty(t, ParseAcceptLanguage(""))
+	assert.Empty(t, ParseAcceptLanguage("en;q=x,,"))
+
+	ctx := NewContext(context.Background(), []string{"pt-BR", "pt"})
+	assert.Equal(t, []string{"pt-BR", "pt"}, FromContext(ctx))
+	assert.Nil(t, FromContext(context.Background()))
+
+	assert.True(t, IsTag("pt-BR"))
+	assert.True(t, IsTag("zh-Hant-TW"))
+	assert.False(t, IsTag("portuguese brazil"))
+	assert.False(t, IsTag(""))
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
+	"delivery-service/budget"
 	"delivery-service/endpoints"
+	"delivery-service/frequency"
+	"delivery-service/geo"
+	"delivery-service/pb"
 	"delivery-service/service"
+	"delivery-service/storage"
+	"delivery-service/storage/file"
+	"delivery-service/storage/mongodb"
 	"delivery-service/transport"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -21,17 +33,92 @@ func main() {
 	logger = level.NewFilter(logger, level.AllowDebug())
 
 	// Initialize the service
-	svc := service.NewService()
+	// Use the collection files of CAMPAIGNS_DIR when set, mongodb otherwise
+	var store storage.CampaignStore
+	if file.Dir != "" {
+		level.Info(logger).Log("msg", "Reading campaigns from files", "dir", file.Dir)
+		store = file.NewCampaignStore(file.Dir)
+	} else {
+		mongoStore := mongodb.NewCampaignStore(mongodb.MongoDB.GetDb("campaigns"))
+
+		// Create or verify the indexes of the delivery pipeline and explain it, as selected
+		// by MONGODB_INDEXES and MONGODB_EXPLAIN
+		indexCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := mongodb.NewIndexManager(mongoStore).Check(indexCtx)
+		cancel()
+		if errors.Is(err, mongodb.ErrCollScan) {
+			level.Error(logger).Log("msg", "Refusing to start, the delivery pipeline is not indexed", "err", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "Index check failed", "err", err)
+		}
+		store = mongoStore
+	}
+	// Count impressions in memory or in redis, as selected by FREQUENCY_STORE and BUDGET_STORE
+	svc := service.NewService(store, frequency.New(), budget.New())
+
+	// Report the campaigns whose rules do not match the rule parameters
+	checkCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	service.SelfCheck(checkCtx, store)
+	cancel()
+
+	// Keep cached campaigns in sync with the database
+	if watcher, ok := svc.(service.Watcher); ok {
+		go watcher.Watch(context.Background())
+	}
 
 	// Create the endpoint
 	getCampaignsEndpoint := endpoints.MakeGetCampaignsEndpoint(svc)
 
-	// Create the HTTP handler
-	httpHandler := transport.NewHTTPHandler(getCampaignsEndpoint)
+	// Create the HTTP handler, inferring missing countries from the GEOIP_DB database
+	resolver := geo.New()
+	mux := http.NewServeMux()
+	mux.Handle("/", transport.NewHTTPHandler(getCampaignsEndpoint, resolver))
+	mux.Handle("/v1/delivery/batch", transport.NewBatchHTTPHandler(endpoints.MakeGetCampaignsBatchEndpoint(svc), resolver))
+
+	// Impressions use up budgets, they need IMPRESSIONS_API_TOKEN, or else the admin token
+	impressionsToken := os.Getenv("IMPRESSIONS_API_TOKEN")
+	if impressionsToken == "" {
+		impressionsToken = os.Getenv("ADMIN_API_TOKEN")
+	}
+	if impressionsToken == "" {
+		level.Info(logger).Log("msg", "IMPRESSIONS_API_TOKEN and ADMIN_API_TOKEN not set, impressions will be rejected")
+	}
+	mux.Handle("/v1/impressions", transport.NewImpressionsHTTPHandler(endpoints.MakeRecordImpressionEndpoint(svc, impressionsToken)))
+
+	// Mount the campaign management API when the store supports it
+	if admin, ok := store.(storage.CampaignAdmin); ok {
+		token := os.Getenv("ADMIN_API_TOKEN")
+		if token == "" {
+			level.Info(logger).Log("msg", "ADMIN_API_TOKEN not set, admin requests will be rejected")
+		}
+		adminEndpoints := endpoints.MakeAdminEndpoints(service.NewAdminService(admin), token)
+		mux.Handle("/v1/admin/", transport.NewAdminHTTPHandler(adminEndpoints))
+	}
+
+	// Serve the same endpoint over gRPC for server-side clients
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+	listener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		level.Error(logger).Log("msg", "Failed listening for gRPC", "port", grpcPort, "err", err)
+		os.Exit(1)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterDeliveryServer(grpcServer, transport.NewGRPCServer(getCampaignsEndpoint, resolver))
+	go func() {
+		level.Info(logger).Log("msg", "Starting gRPC server on port :"+grpcPort)
+		if err := grpcServer.Serve(listener); err != nil {
+			level.Error(logger).Log("msg", "Failed serving gRPC", "err", err)
+		}
+	}()
 
 	// Start the HTTP server
 	level.Info(logger).Log("msg", "Starting server on port :8080")
-	if err := http.ListenAndServe(":8080", httpHandler); err != nil {
+	if err := http.ListenAndServe(":8080", mux); err != nil {
 		level.Error(logger).Log("msg", "Failed Starting server on port :8080")
 	}
 }
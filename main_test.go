@@ -3,63 +3,53 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 
 	"delivery-service/endpoints"
+	local_error "delivery-service/errors"
+	"delivery-service/frequency"
+	"delivery-service/geo"
 	"delivery-service/mocks"
+	"delivery-service/pb"
 	"delivery-service/service"
-	"delivery-service/storage/mongodb"
+	"delivery-service/storage"
 	"delivery-service/transport"
 
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
-var iMongoDb mongodb.IMongoDb
-var iMongoCollection mongodb.IMongoCollection
+var store storage.CampaignStore
 
 // test 200 http status code
 func TestMain1(t *testing.T) {
 
-	mongodb.MongoDB = mocks.MongoMock{
-		GetDbMock: func(db_name string) mongodb.IMongoDb {
-			return iMongoDb
+	store = mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
 		},
-	}
-	iMongoDb = mocks.MongoDbMock{
-		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
-			return iMongoCollection
-		},
-	}
-	iMongoCollection = mocks.MongoCollectionMock{
-		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
-			data := bson.M{
-				"rules": bson.A{"app", "country", "os"},
-			}
-			result := mongo.NewSingleResultFromDocument(data, nil, nil)
-			return result, nil
-		},
-		AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-			data := bson.A{
-				bson.M{
-					"_id":   "cid",
-					"image": "image",
-					"cta":   "cta",
-				},
-			}
-			cursor, _ := mongo.NewCursorFromDocuments(data, nil, nil)
-			return cursor, nil
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "cid", Image: "image", Cta: "cta", IsActive: true, Countries: []string{"us"}},
+			}, nil
 		},
 	}
 
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -74,9 +64,9 @@ func TestMain1(t *testing.T) {
 // test 400 http status code by missing os param
 func TestMain2(t *testing.T) {
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -91,9 +81,9 @@ func TestMain2(t *testing.T) {
 // test 400 http status code by missing country param
 func TestMain3(t *testing.T) {
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -108,9 +98,9 @@ func TestMain3(t *testing.T) {
 // test 400 http status code by missing app param
 func TestMain4(t *testing.T) {
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -125,9 +115,9 @@ func TestMain4(t *testing.T) {
 // test 400 http status code by missing limit param
 func TestMain5(t *testing.T) {
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -142,9 +132,9 @@ func TestMain5(t *testing.T) {
 // test 400 http status code by missing page param
 func TestMain6(t *testing.T) {
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -158,30 +148,16 @@ func TestMain6(t *testing.T) {
 
 // test 400 http status code by passing unknown param
 func TestMain7(t *testing.T) {
-	mongodb.MongoDB = mocks.MongoMock{
-		GetDbMock: func(db_name string) mongodb.IMongoDb {
-			return iMongoDb
-		},
-	}
-	iMongoDb = mocks.MongoDbMock{
-		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
-			return iMongoCollection
-		},
-	}
-	iMongoCollection = mocks.MongoCollectionMock{
-		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
-			data := bson.M{
-				"rules": bson.A{"app", "country", "os"},
-			}
-			result := mongo.NewSingleResultFromDocument(data, nil, nil)
-			return result, nil
+	store = mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
 		},
 	}
 
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -196,9 +172,9 @@ func TestMain7(t *testing.T) {
 // test 405 http status code by unsupported method
 func TestMain8(t *testing.T) {
 	// Set up the service, endpoint, and HTTP handler
-	svc := service.NewService()
+	svc := service.NewService(store, nil, nil)
 	ep := endpoints.MakeGetCampaignsEndpoint(svc)
-	handler := transport.NewHTTPHandler(ep)
+	handler := transport.NewHTTPHandler(ep, nil)
 
 	// Create a test server
 	server := httptest.NewServer(handler)
@@ -212,3 +188,474 @@ func TestMain8(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
 }
+
+// test 401 http status code for admin requests without the token
+func TestMain9(t *testing.T) {
+	admin := mocks.CampaignAdminMock{}
+	handler := transport.NewAdminHTTPHandler(endpoints.MakeAdminEndpoints(service.NewAdminService(admin), "secret"))
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/admin/campaigns")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// test 201 and 400 http status codes for admin campaign creation
+func TestMain10(t *testing.T) {
+	var saved storage.Campaign
+	admin := mocks.CampaignAdminMock{
+		CampaignStoreMock: mocks.CampaignStoreMock{
+			GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+				return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+			},
+		},
+		GetCampaignMock: func(ctx context.Context, id string) (storage.Campaign, error) {
+			return storage.Campaign{}, storage.ErrCampaignNotFound
+		},
+		SaveCampaignMock: func(ctx context.Context, campaign storage.Campaign) error {
+			saved = campaign
+			return nil
+		},
+	}
+	handler := transport.NewAdminHTTPHandler(endpoints.MakeAdminEndpoints(service.NewAdminService(admin), "secret"))
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func(body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/admin/campaigns", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := post(`{"id": "spotify", "image": "https://img/spotify.png", "cta": "Download", "isActive": true, "countries": ["us"]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "spotify", saved.ID)
+
+	resp = post(`{"id": "spotify", "image": "", "cta": "Download", "isActive": true, "countries": ["us"]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// test 200 http status code for the admin rules validation
+func TestMain11(t *testing.T) {
+	admin := mocks.CampaignAdminMock{
+		CampaignStoreMock: mocks.CampaignStoreMock{
+			GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+				return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+			},
+		},
+		FindCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "spotify", Countries: []string{"us"}, Rules: map[string][]string{"includeOS": {"android"}}},
+			}, nil
+		},
+	}
+	handler := transport.NewAdminHTTPHandler(endpoints.MakeAdminEndpoints(service.NewAdminService(admin), "secret"))
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/admin/validate", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body endpoints.ValidateResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.False(t, body.Valid)
+	assert.Len(t, body.Issues, 1)
+	assert.Equal(t, "includeOS", body.Issues[0].Rule)
+}
+
+// test 200, 400, 401 and 404 http status codes for impression recording
+func TestMain12(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "cid", IsActive: true, Countries: []string{"us"}, FrequencyCap: &storage.FrequencyCap{Impressions: 1, Window: "1h"}},
+			}, nil
+		},
+	}
+	handler := transport.NewImpressionsHTTPHandler(endpoints.MakeRecordImpressionEndpoint(service.NewService(store, frequency.NewMemoryCounter(), nil), "secret"))
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	send := func(token, body string) *http.Response {
+		req, _ := http.NewRequest("POST", server.URL+"/v1/impressions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+	post := func(body string) *http.Response { return send("secret", body) }
+
+	// Impressions without the token are rejected and not counted
+	resp := send("", `{"campaignId": "cid", "deviceId": "device-1"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = send("wrong", `{"campaignId": "cid", "deviceId": "device-1"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = post(`{"campaignId": "cid", "deviceId": "device-1"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var body endpoints.ImpressionResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.True(t, body.Recorded)
+
+	resp = post(`{"campaignId": "cid"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"campaignId": "unknown", "userId": "user-1"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// test 200 http status code with the country inferred from the client ip
+func TestMain13(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "gb", IsActive: true, Countries: []string{"gb"}},
+				{ID: "us", IsActive: true, Countries: []string{"us"}},
+			}, nil
+		},
+	}
+	lookups := 0
+	resolver := mocks.ResolverMock{
+		LookupMock: func(addr netip.Addr) (geo.Location, bool) {
+			lookups++
+			if addr.String() == "81.2.69.160" {
+				return geo.Location{Country: "gb", Region: "GB-ENG", City: "London"}, true
+			}
+			return geo.Location{}, false
+		},
+	}
+	handler := transport.NewHTTPHandler(endpoints.MakeGetCampaignsEndpoint(service.NewService(store, nil, nil)), resolver)
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(query, forwarded string) (*http.Response, endpoints.GetCampaignsResponse) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/delivery?"+query, nil)
+		req.Header.Set("X-Forwarded-For", forwarded)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		var body endpoints.GetCampaignsResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	resp, body := get("limit=10&page=0&app=com.spotify&os=android", "81.2.69.160")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, &endpoints.Country{Code: "gb", Source: geo.SourceInferred}, body.Country)
+	assert.Len(t, body.Campaigns, 1)
+	assert.Equal(t, "gb", body.Campaigns[0].Cid)
+
+	// A forwarded address prepended by the client is ignored
+	resp, body = get("limit=10&page=0&app=com.spotify&os=android", "216.160.83.56, 81.2.69.160")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, &endpoints.Country{Code: "gb", Source: geo.SourceInferred}, body.Country)
+
+	// Requests with a country skip the lookup
+	lookups = 0
+	resp, body = get("limit=10&page=0&app=com.spotify&os=android&country=us", "81.2.69.160")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, &endpoints.Country{Code: "us", Source: geo.SourceClient}, body.Country)
+	assert.Equal(t, "us", body.Campaigns[0].Cid)
+	assert.Equal(t, 0, lookups)
+
+	// The country stays required when it cannot be inferred
+	resp, _ = get("limit=10&page=0&app=com.spotify&os=android", "10.0.0.1")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// test paging with next_cursor, which makes the page parameter optional
+func TestMain14(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", IsActive: true, Countries: []string{"us"}},
+				{ID: "c2", IsActive: true, Countries: []string{"us"}},
+				{ID: "c3", IsActive: true, Countries: []string{"us"}},
+			}, nil
+		},
+	}
+	handler := transport.NewHTTPHandler(endpoints.MakeGetCampaignsEndpoint(service.NewService(store, nil, nil)), nil)
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(query string) (*http.Response, endpoints.GetCampaignsResponse) {
+		resp, err := http.Get(server.URL + "/v1/delivery?app=com.spotify&os=android&country=us&" + query)
+		assert.NoError(t, err)
+		var body endpoints.GetCampaignsResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	resp, body := get("limit=2&page=0&user_id=user-1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, body.Campaigns, 2)
+	assert.NotEmpty(t, body.NextCursor)
+	first := body.Campaigns
+
+	resp, body = get("limit=2&user_id=user-1&cursor=" + body.NextCursor)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, body.Campaigns, 1)
+	assert.Empty(t, body.NextCursor)
+	assert.NotContains(t, first, body.Campaigns[0])
+
+	resp, _ = get("limit=2&cursor=garbage")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// placementStore is a CampaignStore keeping placements
+type placementStore struct {
+	mocks.CampaignStoreMock
+	mocks.PlacementStoreMock
+}
+
+// test the batch delivery of several placements, campaigns are not repeated across placements
+func TestMain15(t *testing.T) {
+	store := placementStore{
+		CampaignStoreMock: mocks.CampaignStoreMock{
+			GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+				return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+			},
+			ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+				return []storage.Campaign{
+					{ID: "c1", IsActive: true, Countries: []string{"us"}},
+					{ID: "c2", IsActive: true, Countries: []string{"us"}},
+				}, nil
+			},
+		},
+		PlacementStoreMock: mocks.PlacementStoreMock{
+			ListPlacementsMock: func(ctx context.Context) ([]storage.Placement, error) {
+				return []storage.Placement{{ID: "banner", App: "com.spotify"}, {ID: "interstitial", App: "com.spotify"}}, nil
+			},
+		},
+	}
+	handler := transport.NewBatchHTTPHandler(endpoints.MakeGetCampaignsBatchEndpoint(service.NewService(store, nil, nil)), nil)
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func(body string) (*http.Response, endpoints.BatchResponse) {
+		resp, err := http.Post(server.URL+"/v1/delivery/batch", "application/json", bytes.NewBufferString(body))
+		assert.NoError(t, err)
+		var batch endpoints.BatchResponse
+		json.NewDecoder(resp.Body).Decode(&batch)
+		return resp, batch
+	}
+
+	resp, batch := post(`{"context": {"app": "com.spotify", "os": "android", "country": "us"}, "userId": "user-1",
+		"placements": [{"id": "interstitial", "limit": 1}, {"id": "banner", "limit": 2}]}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, &endpoints.Country{Code: "us", Source: geo.SourceClient}, batch.Country)
+	assert.Len(t, batch.Placements, 2)
+	assert.Equal(t, "interstitial", batch.Placements[0].ID)
+	assert.Len(t, batch.Placements[0].Campaigns, 1)
+	assert.Equal(t, "banner", batch.Placements[1].ID)
+	assert.Len(t, batch.Placements[1].Campaigns, 1)
+	assert.NotEqual(t, batch.Placements[0].Campaigns[0], batch.Placements[1].Campaigns[0])
+
+	resp, _ = post(`{"context": {"app": "com.spotify", "os": "android"}, "placements": [{"id": "banner", "limit": 1}]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = post(`{"context": {"app": "com.spotify", "os": "android", "country": "us"}, "placements": [], "unknown": 1}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Other methods get the JSON error of the delivery API
+	resp, err := http.Get(server.URL + "/v1/delivery/batch")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	var body map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "method not allowed: GET", body["error"])
+
+	// Placements that are not defined are rejected, in batches as in GET requests
+	resp, _ = post(`{"context": {"app": "com.spotify", "os": "android", "country": "us"}, "placements": [{"id": "banner", "limit": 1}, {"id": "other", "limit": 1}]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	get := httptest.NewServer(transport.NewHTTPHandler(endpoints.MakeGetCampaignsEndpoint(service.NewService(store, nil, nil)), nil))
+	defer get.Close()
+	for placement, status := range map[string]int{"banner": http.StatusOK, "other": http.StatusBadRequest} {
+		resp, err := http.Get(get.URL + "/v1/delivery?app=com.spotify&os=android&country=us&limit=1&page=0&placement=" + placement)
+		assert.NoError(t, err)
+		assert.Equal(t, status, resp.StatusCode, placement)
+	}
+}
+
+// test the gRPC transport of the delivery endpoint and its status codes
+func TestMain16(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", Image: "image", Cta: "cta", IsActive: true, Countries: []string{"gb"}},
+				{ID: "c2", IsActive: true, Countries: []string{"gb"}},
+			}, nil
+		},
+	}
+	resolver := mocks.ResolverMock{
+		LookupMock: func(addr netip.Addr) (geo.Location, bool) {
+			return geo.Location{Country: "gb"}, addr.String() == "81.2.69.160"
+		},
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterDeliveryServer(server, transport.NewGRPCServer(endpoints.MakeGetCampaignsEndpoint(service.NewService(store, nil, nil)), resolver))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewDeliveryClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", "81.2.69.160")
+	resp, err := client.GetCampaigns(ctx, &pb.GetCampaignsRequest{Params: map[string]string{"app": "com.spotify", "os": "android"}, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Campaigns, 1)
+	assert.Equal(t, "c1", resp.Campaigns[0].Cid)
+	assert.Equal(t, "image", resp.Campaigns[0].Img)
+	assert.Equal(t, "gb", resp.Country.GetCode())
+	assert.Equal(t, geo.SourceInferred, resp.Country.GetSource())
+	assert.NotEmpty(t, resp.NextCursor)
+
+	resp, err = client.GetCampaigns(ctx, &pb.GetCampaignsRequest{Params: map[string]string{"app": "com.spotify", "os": "android"}, Limit: 1, Cursor: resp.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, "c2", resp.Campaigns[0].Cid)
+	assert.Empty(t, resp.NextCursor)
+
+	// The country cannot be inferred without the forwarded address
+	_, err = client.GetCampaigns(context.Background(), &pb.GetCampaignsRequest{Params: map[string]string{"app": "com.spotify", "os": "android"}, Limit: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.GetCampaigns(ctx, &pb.GetCampaignsRequest{Params: map[string]string{"app": "com.spotify", "os": "android"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "limit must be a positive integer")
+	_, err = client.GetCampaigns(ctx, &pb.GetCampaignsRequest{Params: map[string]string{"app": "com.spotify", "os": "android"}, Limit: 1, Page: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "page must be a non-negative integer")
+
+	_, err = transport.DecodeGRPCGetCampaignsRequest(context.Background(), &pb.GetCampaignsRequest{Limit: -1})
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+	_, err = transport.DecodeGRPCGetCampaignsRequest(context.Background(), &pb.GetCampaignsRequest{Limit: 1, Page: -1})
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+
+	assert.Equal(t, codes.NotFound, status.Code(transport.GRPCError(&local_error.ErrCampaignNotFound{ID: "c3"})))
+	assert.Equal(t, codes.Unauthenticated, status.Code(transport.GRPCError(&local_error.ErrUnauthorized{})))
+	assert.Equal(t, codes.Internal, status.Code(transport.GRPCError(errors.New("mongodb down"))))
+}
+
+// test the localization of the cta by the lang parameter, or else the Accept-Language header
+func TestMain17(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", IsActive: true, Countries: []string{"us"}, Image: "image", Cta: "Download", Localized: map[string]storage.Localization{
+					"pt": {Cta: "Baixar"},
+					"fr": {Cta: "Télécharger"},
+				}},
+			}, nil
+		},
+	}
+	handler := transport.NewHTTPHandler(endpoints.MakeGetCampaignsEndpoint(service.NewService(store, nil, nil)), nil)
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(query, acceptLanguage string) (*http.Response, endpoints.GetCampaignsResponse) {
+		req, _ := http.NewRequest("GET", server.URL+"/v1/delivery?app=com.spotify&os=android&country=us&limit=1&page=0"+query, nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		var body endpoints.GetCampaignsResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	_, body := get("", "de-DE, fr;q=0.8, en;q=0.5")
+	assert.Equal(t, "Télécharger", body.Campaigns[0].Cta)
+
+	_, body = get("&lang=pt-BR", "fr")
+	assert.Equal(t, "Baixar", body.Campaigns[0].Cta)
+
+	_, body = get("", "")
+	assert.Equal(t, "Download", body.Campaigns[0].Cta)
+
+	resp, _ := get("&lang=pt_BR", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// test 400 http status code by a limit that is not positive or a negative page
+func TestMain18(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{{ID: "c1", IsActive: true, Countries: []string{"us"}}}, nil
+		},
+	}
+	handler := transport.NewHTTPHandler(endpoints.MakeGetCampaignsEndpoint(service.NewService(store, nil, nil)), nil)
+
+	// Create a test server
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, query := range []string{"limit=-1&page=1", "limit=0&page=0", "limit=ten&page=0", "limit=10&page=-1", "limit=10&page=one"} {
+		resp, err := http.Get(server.URL + "/v1/delivery?app=com.spotify&os=android&country=us&" + query)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		assert.Contains(t, body["error"], "invalid parameter", query)
+
+		_, err = transport.DecodeGetCampaignsRequest(context.Background(), httptest.NewRequest(http.MethodGet, "/v1/delivery?"+query, nil))
+		assert.IsType(t, &local_error.ErrInvalidParams{}, err, query)
+	}
+
+	// A limit left out is missing, not invalid
+	_, err := transport.DecodeGetCampaignsRequest(context.Background(), httptest.NewRequest(http.MethodGet, "/v1/delivery?page=0", nil))
+	assert.IsType(t, &local_error.ErrMissingParams{}, err)
+
+	resp, err := http.Get(server.URL + "/v1/delivery?app=com.spotify&os=android&country=us&limit=4611686018427387904&page=4")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -9,6 +9,13 @@ import (
 var (
 	HttpRequestCount   prometheus.Counter
 	HttpRequestLatency prometheus.Histogram
+
+	WatcherChangesApplied prometheus.Counter
+	WatcherLag            prometheus.Gauge
+	WatcherLastEvent      prometheus.Gauge
+
+	VariantDeliveryCount prometheus.Counter
+	StaleCursorCount     prometheus.Counter
 )
 
 func init() {
@@ -20,6 +27,20 @@ func init() {
 		Help:      "Total number of http requests",
 	}, []string{"method", "code"})
 
+	VariantDeliveryCount = *prometheus.NewCounterFrom(prom.CounterOpts{
+		Namespace: "delivery_service",
+		Subsystem: "campaigns",
+		Name:      "variant_delivery_count_total",
+		Help:      "Total number of deliveries of each creative variant of the campaigns.",
+	}, []string{"campaign", "variant"})
+
+	StaleCursorCount = *prometheus.NewCounterFrom(prom.CounterOpts{
+		Namespace: "delivery_service",
+		Subsystem: "campaigns",
+		Name:      "stale_cursor_count_total",
+		Help:      "Total number of pages requested with a cursor of campaigns that changed since.",
+	}, []string{})
+
 	HttpRequestLatency = *prometheus.NewHistogramFrom(prom.HistogramOpts{
 		Namespace: "delivery_service",
 		Subsystem: "campaigns",
@@ -27,4 +48,25 @@ func init() {
 		Help:      "Request latency in seconds.",
 		Buckets:   prom.DefBuckets,
 	}, []string{})
+
+	WatcherChangesApplied = *prometheus.NewCounterFrom(prom.CounterOpts{
+		Namespace: "delivery_service",
+		Subsystem: "watcher",
+		Name:      "changes_applied_total",
+		Help:      "Total number of campaign changes applied to the in-memory cache.",
+	}, []string{"mode", "operation"})
+
+	WatcherLag = *prometheus.NewGaugeFrom(prom.GaugeOpts{
+		Namespace: "delivery_service",
+		Subsystem: "watcher",
+		Name:      "lag_seconds",
+		Help:      "Delay between a change in mongodb and its application to the in-memory cache.",
+	}, []string{})
+
+	WatcherLastEvent = *prometheus.NewGaugeFrom(prom.GaugeOpts{
+		Namespace: "delivery_service",
+		Subsystem: "watcher",
+		Name:      "last_event_timestamp_seconds",
+		Help:      "Cluster time of the last change stream event applied to the in-memory cache, in unix seconds.",
+	}, []string{})
 }
@@ -0,0 +1,14 @@
+package mocks
+
+import (
+	"delivery-service/geo"
+	"net/netip"
+)
+
+type ResolverMock struct {
+	LookupMock func(netip.Addr) (geo.Location, bool)
+}
+
+func (m ResolverMock) Lookup(addr netip.Addr) (geo.Location, bool) {
+	return m.LookupMock(addr)
+}
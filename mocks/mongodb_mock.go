@@ -4,6 +4,7 @@ import (
 	"context"
 	"delivery-service/storage/mongodb"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -13,12 +14,19 @@ type MongoMock struct {
 }
 
 type MongoDbMock struct {
-	GetCollectionMock func(string) mongodb.IMongoCollection
+	GetCollectionMock       func(string) mongodb.IMongoCollection
+	WatchMock               func(context.Context, interface{}, ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+	ListCollectionNamesMock func(context.Context, interface{}, ...*options.ListCollectionsOptions) ([]string, error)
+	RunCommandMock          func(context.Context, interface{}) (bson.Raw, error)
 }
 
 type MongoCollectionMock struct {
-	FindOneMock   func(context.Context, interface{}, ...*options.FindOneOptions) (*mongo.SingleResult, error)
-	AggregateMock func(context.Context, interface{}, ...*options.AggregateOptions) (*mongo.Cursor, error)
+	FindOneMock        func(context.Context, interface{}, ...*options.FindOneOptions) (*mongo.SingleResult, error)
+	AggregateMock      func(context.Context, interface{}, ...*options.AggregateOptions) (*mongo.Cursor, error)
+	ReplaceOneMock     func(context.Context, interface{}, interface{}, ...*options.ReplaceOptions) (*mongo.UpdateResult, error)
+	DeleteOneMock      func(context.Context, interface{}, ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	CreateIndexMock    func(context.Context, mongo.IndexModel, ...*options.CreateIndexesOptions) (string, error)
+	ListIndexSpecsMock func(context.Context) ([]*mongo.IndexSpecification, error)
 }
 
 func (m MongoMock) GetDb(db_name string) mongodb.IMongoDb {
@@ -29,6 +37,18 @@ func (m MongoDbMock) GetCollection(coll_name string) mongodb.IMongoCollection {
 	return m.GetCollectionMock(coll_name)
 }
 
+func (m MongoDbMock) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return m.WatchMock(ctx, pipeline, opts...)
+}
+
+func (m MongoDbMock) ListCollectionNames(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) ([]string, error) {
+	return m.ListCollectionNamesMock(ctx, filter, opts...)
+}
+
+func (m MongoDbMock) RunCommand(ctx context.Context, command interface{}) (bson.Raw, error) {
+	return m.RunCommandMock(ctx, command)
+}
+
 func (m MongoCollectionMock) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
 	return m.FindOneMock(ctx, filter, opts...)
 }
@@ -36,3 +56,19 @@ func (m MongoCollectionMock) FindOne(ctx context.Context, filter interface{}, op
 func (m MongoCollectionMock) Aggregate(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
 	return m.AggregateMock(ctx, filter, opts...)
 }
+
+func (m MongoCollectionMock) ReplaceOne(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	return m.ReplaceOneMock(ctx, filter, replacement, opts...)
+}
+
+func (m MongoCollectionMock) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return m.DeleteOneMock(ctx, filter, opts...)
+}
+
+func (m MongoCollectionMock) CreateIndex(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error) {
+	return m.CreateIndexMock(ctx, model, opts...)
+}
+
+func (m MongoCollectionMock) ListIndexSpecs(ctx context.Context) ([]*mongo.IndexSpecification, error) {
+	return m.ListIndexSpecsMock(ctx)
+}
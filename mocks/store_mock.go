@@ -0,0 +1,94 @@
+package mocks
+
+import (
+	"context"
+	"delivery-service/storage"
+)
+
+type CampaignStoreMock struct {
+	GetParametersMock  func(context.Context) ([]storage.Dimension, error)
+	QueryCampaignsMock func(context.Context, map[string]string, string, int, int) ([]storage.Campaign, error)
+	ListCampaignsMock  func(context.Context) ([]storage.Campaign, error)
+	ActiveCampaignMock func(context.Context, string) (storage.Campaign, error)
+}
+
+func (m CampaignStoreMock) GetParameters(ctx context.Context) ([]storage.Dimension, error) {
+	return m.GetParametersMock(ctx)
+}
+
+func (m CampaignStoreMock) QueryCampaigns(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]storage.Campaign, error) {
+	return m.QueryCampaignsMock(ctx, params, userID, limit, offset)
+}
+
+func (m CampaignStoreMock) ListCampaigns(ctx context.Context) ([]storage.Campaign, error) {
+	return m.ListCampaignsMock(ctx)
+}
+
+func (m CampaignStoreMock) ActiveCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	return m.ActiveCampaignMock(ctx, id)
+}
+
+type CampaignAdminMock struct {
+	CampaignStoreMock
+	FindCampaignsMock  func(context.Context) ([]storage.Campaign, error)
+	GetCampaignMock    func(context.Context, string) (storage.Campaign, error)
+	SaveCampaignMock   func(context.Context, storage.Campaign) error
+	DeleteCampaignMock func(context.Context, string) error
+}
+
+func (m CampaignAdminMock) FindCampaigns(ctx context.Context) ([]storage.Campaign, error) {
+	return m.FindCampaignsMock(ctx)
+}
+
+func (m CampaignAdminMock) GetCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	return m.GetCampaignMock(ctx, id)
+}
+
+func (m CampaignAdminMock) SaveCampaign(ctx context.Context, campaign storage.Campaign) error {
+	return m.SaveCampaignMock(ctx, campaign)
+}
+
+func (m CampaignAdminMock) DeleteCampaign(ctx context.Context, id string) error {
+	return m.DeleteCampaignMock(ctx, id)
+}
+
+type SegmentStoreMock struct {
+	ListSegmentsMock  func(context.Context) ([]storage.Segment, error)
+	LoadSegmentMock   func(context.Context, storage.Segment) ([]uint64, error)
+	SaveSegmentMock   func(context.Context, storage.Segment, []uint64) error
+	DeleteSegmentMock func(context.Context, string) error
+}
+
+func (m SegmentStoreMock) ListSegments(ctx context.Context) ([]storage.Segment, error) {
+	return m.ListSegmentsMock(ctx)
+}
+
+func (m SegmentStoreMock) LoadSegment(ctx context.Context, segment storage.Segment) ([]uint64, error) {
+	return m.LoadSegmentMock(ctx, segment)
+}
+
+func (m SegmentStoreMock) SaveSegment(ctx context.Context, segment storage.Segment, members []uint64) error {
+	return m.SaveSegmentMock(ctx, segment, members)
+}
+
+func (m SegmentStoreMock) DeleteSegment(ctx context.Context, name string) error {
+	return m.DeleteSegmentMock(ctx, name)
+}
+
+type PlacementStoreMock struct {
+	ListPlacementsMock  func(context.Context) ([]storage.Placement, error)
+	SavePlacementMock   func(context.Context, storage.Placement) error
+	DeletePlacementMock func(context.Context, string) error
+}
+
+func (m PlacementStoreMock) ListPlacements(ctx context.Context) ([]storage.Placement, error) {
+	return m.ListPlacementsMock(ctx)
+}
+
+func (m PlacementStoreMock) SavePlacement(ctx context.Context, placement storage.Placement) error {
+	return m.SavePlacementMock(ctx, placement)
+}
+
+func (m PlacementStoreMock) DeletePlacement(ctx context.Context, id string) error {
+	return m.DeletePlacementMock(ctx, id)
+}
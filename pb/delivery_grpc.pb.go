@@ -0,0 +1,127 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: delivery.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Delivery_GetCampaigns_FullMethodName = "/delivery.v1.Delivery/GetCampaigns"
+)
+
+// DeliveryClient is the client API for Delivery service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Delivery serves the campaigns of GET /v1/delivery to server-side clients
+type DeliveryClient interface {
+	// GetCampaigns returns a page of the campaigns targeting the request params
+	GetCampaigns(ctx context.Context, in *GetCampaignsRequest, opts ...grpc.CallOption) (*GetCampaignsResponse, error)
+}
+
+type deliveryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeliveryClient(cc grpc.ClientConnInterface) DeliveryClient {
+	return &deliveryClient{cc}
+}
+
+func (c *deliveryClient) GetCampaigns(ctx context.Context, in *GetCampaignsRequest, opts ...grpc.CallOption) (*GetCampaignsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetCampaignsResponse)
+	err := c.cc.Invoke(ctx, Delivery_GetCampaigns_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeliveryServer is the server API for Delivery service.
+// All implementations must embed UnimplementedDeliveryServer
+// for forward compatibility.
+//
+// Delivery serves the campaigns of GET /v1/delivery to server-side clients
+type DeliveryServer interface {
+	// GetCampaigns returns a page of the campaigns targeting the request params
+	GetCampaigns(context.Context, *GetCampaignsRequest) (*GetCampaignsResponse, error)
+	mustEmbedUnimplementedDeliveryServer()
+}
+
+// UnimplementedDeliveryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDeliveryServer struct{}
+
+func (UnimplementedDeliveryServer) GetCampaigns(context.Context, *GetCampaignsRequest) (*GetCampaignsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCampaigns not implemented")
+}
+func (UnimplementedDeliveryServer) mustEmbedUnimplementedDeliveryServer() {}
+func (UnimplementedDeliveryServer) testEmbeddedByValue()                  {}
+
+// UnsafeDeliveryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeliveryServer will
+// result in compilation errors.
+type UnsafeDeliveryServer interface {
+	mustEmbedUnimplementedDeliveryServer()
+}
+
+func RegisterDeliveryServer(s grpc.ServiceRegistrar, srv DeliveryServer) {
+	// If the following call pancis, it indicates UnimplementedDeliveryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Delivery_ServiceDesc, srv)
+}
+
+func _Delivery_GetCampaigns_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCampaignsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeliveryServer).GetCampaigns(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Delivery_GetCampaigns_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeliveryServer).GetCampaigns(ctx, req.(*GetCampaignsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Delivery_ServiceDesc is the grpc.ServiceDesc for Delivery service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Delivery_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "delivery.v1.Delivery",
+	HandlerType: (*DeliveryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCampaigns",
+			Handler:    _Delivery_GetCampaigns_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "delivery.proto",
+}
@@ -0,0 +1,193 @@
+package placement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// RefreshInterval is the time between two reloads of the placements, set by
+// PLACEMENTS_REFRESH_INTERVAL
+var RefreshInterval = time.Minute
+
+// Formats are the creative formats of placements and campaigns
+var Formats = []string{"banner", "mrec", "interstitial", "rewarded", "native", "video", "playable"}
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "placement")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	if interval := os.Getenv("PLACEMENTS_REFRESH_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			RefreshInterval = d
+		} else {
+			level.Error(logger).Log("msg", "invalid PLACEMENTS_REFRESH_INTERVAL, using default", "value", interval)
+		}
+	}
+}
+
+// IsFormat reports whether format is one of Formats
+func IsFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSize parses a WIDTHxHEIGHT size in pixels, like 320x50
+func ParseSize(size string) (width, height int, err error) {
+	errSize := errors.New("size must be WIDTHxHEIGHT in pixels, like 320x50")
+
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return 0, 0, errSize
+	}
+	if width, err = strconv.Atoi(w); err != nil || width <= 0 {
+		return 0, 0, errSize
+	}
+	if height, err = strconv.Atoi(h); err != nil || height <= 0 {
+		return 0, 0, errSize
+	}
+	return width, height, nil
+}
+
+// Validate checks the formats and the size of a placement or a campaign
+func Validate(formats []string, size string) error {
+	seen := make(map[string]struct{}, len(formats))
+	for _, format := range formats {
+		if !IsFormat(format) {
+			return fmt.Errorf("unknown format %s, expected one of %s", format, strings.Join(Formats, ", "))
+		}
+		if _, ok := seen[format]; ok {
+			return fmt.Errorf("duplicate format %s", format)
+		}
+		seen[format] = struct{}{}
+	}
+	if size != "" {
+		if _, _, err := ParseSize(size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fits reports whether campaign may be shown in the placement id, placement being its
+// definition or nil when it has none. Include placements restrict a campaign to them,
+// requests without a placement included. The formats and the size of the creative must
+// be shown by a defined placement.
+func Fits(campaign storage.Campaign, id string, placement *storage.Placement) bool {
+	if targeting := campaign.Placements; targeting != nil {
+		if len(targeting.Include) > 0 && (id == "" || !contains(targeting.Include, id)) {
+			return false
+		}
+		if id != "" && contains(targeting.Exclude, id) {
+			return false
+		}
+	}
+
+	if placement == nil {
+		return true
+	}
+	if len(campaign.Formats) > 0 && len(placement.Formats) > 0 && !overlaps(campaign.Formats, placement.Formats) {
+		return false
+	}
+	return campaign.Size == "" || placement.Size == "" || campaign.Size == placement.Size
+}
+
+func contains(slice []string, str string) bool {
+	for _, v := range slice {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b []string) bool {
+	for _, v := range a {
+		if contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cache holds the placements of a PlacementSource in memory, loaded on first use and
+// reloaded on the first lookup after RefreshInterval. Lookups keep the previous placements
+// when a reload fails.
+type Cache struct {
+	source   storage.PlacementSource
+	interval time.Duration
+
+	mu         sync.Mutex
+	loaded     bool
+	next       time.Time
+	placements map[string]storage.Placement
+}
+
+// Cached is implemented by stores keeping their own placement Cache, expired as soon as
+// their placements change
+type Cached interface {
+	// PlacementCache returns the placement Cache of the store
+	PlacementCache() *Cache
+}
+
+// NewCache creates an empty Cache over source
+func NewCache(source storage.PlacementSource) *Cache {
+	return &Cache{
+		source:     source,
+		interval:   RefreshInterval,
+		placements: make(map[string]storage.Placement),
+	}
+}
+
+// Get returns the placement id, false when there is none
+func (c *Cache) Get(ctx context.Context, id string) (storage.Placement, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded || !time.Now().Before(c.next) {
+		placements, err := c.source.ListPlacements(ctx)
+		if err != nil && !c.loaded {
+			level.Error(logger).Log("method", "Get", "msg", "loading placements failed", "err", err)
+			return storage.Placement{}, false, err
+		}
+		if err != nil {
+			level.Error(logger).Log("method", "Get", "msg", "reloading placements failed, keeping the previous ones", "err", err)
+		} else {
+			c.placements = make(map[string]storage.Placement, len(placements))
+			for _, placement := range placements {
+				c.placements[placement.ID] = placement
+			}
+			c.loaded = true
+		}
+		c.next = time.Now().Add(c.interval)
+	}
+
+	placement, ok := c.placements[id]
+	return placement, ok, nil
+}
+
+// Expire makes the next Get reload the placements
+func (c *Cache) Expire() {
+	c.mu.Lock()
+	c.next = time.Time{}
+	c.mu.Unlock()
+}
@@ -0,0 +1,85 @@
+package placement
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sourceFunc is a storage.PlacementSource listing the placements it returns, the mocks
+// package cannot be imported here as the mongodb store it mocks uses the Cache
+type sourceFunc func(ctx context.Context) ([]storage.Placement, error)
+
+func (f sourceFunc) ListPlacements(ctx context.Context) ([]storage.Placement, error) {
+	return f(ctx)
+}
+
+// campaigns fit placements by id, format and size
+func TestFits1(t *testing.T) {
+	banner := &storage.Placement{ID: "home_banner", App: "com.example.app", Formats: []string{"banner", "mrec"}, Size: "320x50"}
+
+	assert.True(t, Fits(storage.Campaign{ID: "c1"}, "home_banner", banner))
+	assert.True(t, Fits(storage.Campaign{ID: "c1"}, "", nil))
+	assert.True(t, Fits(storage.Campaign{ID: "c1", Formats: []string{"video", "banner"}, Size: "320x50"}, "home_banner", banner))
+	assert.False(t, Fits(storage.Campaign{ID: "c1", Formats: []string{"video"}}, "home_banner", banner))
+	assert.False(t, Fits(storage.Campaign{ID: "c1", Size: "300x250"}, "home_banner", banner))
+
+	included := storage.Campaign{ID: "c1", Placements: &storage.PlacementTargeting{Include: []string{"home_banner"}}}
+	assert.True(t, Fits(included, "home_banner", banner))
+	assert.False(t, Fits(included, "level_end", nil))
+	// Included placements are required
+	assert.False(t, Fits(included, "", nil))
+
+	excluded := storage.Campaign{ID: "c1", Placements: &storage.PlacementTargeting{Exclude: []string{"home_banner"}}}
+	assert.False(t, Fits(excluded, "home_banner", banner))
+	assert.True(t, Fits(excluded, "level_end", nil))
+	assert.True(t, Fits(excluded, "", nil))
+}
+
+// formats must be known and distinct, sizes WIDTHxHEIGHT
+func TestValidate1(t *testing.T) {
+	assert.NoError(t, Validate([]string{"banner", "video"}, "320x50"))
+	assert.NoError(t, Validate(nil, ""))
+	assert.Error(t, Validate([]string{"billboard"}, ""))
+	assert.Error(t, Validate([]string{"banner", "banner"}, ""))
+
+	for _, size := range []string{"320", "320x", "0x50", "320x-50", "axb"} {
+		assert.Error(t, Validate(nil, size), size)
+	}
+}
+
+// placements are loaded on first use and kept when a reload fails
+func TestCache1(t *testing.T) {
+	loads := 0
+	var failing error
+	cache := NewCache(sourceFunc(func(ctx context.Context) ([]storage.Placement, error) {
+		loads++
+		return []storage.Placement{{ID: "home_banner", App: "com.example.app"}}, failing
+	}))
+
+	placement, ok, err := cache.Get(context.Background(), "home_banner")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "com.example.app", placement.App)
+
+	_, ok, err = cache.Get(context.Background(), "level_end")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, loads)
+
+	failing = errors.New("some error")
+	cache.Expire()
+	_, ok, err = cache.Get(context.Background(), "home_banner")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, loads)
+
+	_, _, err = NewCache(sourceFunc(func(ctx context.Context) ([]storage.Placement, error) {
+		return nil, failing
+	})).Get(context.Background(), "home_banner")
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package ranking
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"delivery-service/storage"
+)
+
+// Position is the place of a campaign in the ranking of a user: campaigns come by
+// decreasing Priority, then decreasing Key, then increasing ID
+type Position struct {
+	Priority int
+	Key      float64
+	ID       string
+}
+
+// PositionOf returns the position of campaign in the ranking of userID. It only depends
+// on the user and the id, priority and weight of the campaign, so it stays the same
+// while other campaigns are added or removed.
+func PositionOf(campaign storage.Campaign, userID string) Position {
+	position := Position{Priority: campaign.Priority, ID: campaign.ID}
+	if userID != "" {
+		position.Key = key(userID, campaign)
+	}
+	return position
+}
+
+// Before reports whether p is ranked before q
+func (p Position) Before(q Position) bool {
+	if p.Priority != q.Priority {
+		return p.Priority > q.Priority
+	}
+	if p.Key != q.Key {
+		return p.Key > q.Key
+	}
+	return p.ID < q.ID
+}
+
+// Rank orders campaigns by priority tier, highest first. Within a tier the campaigns
+// are shuffled by weight with a shuffle seeded by userID, so the same user gets the
+// same order on every page; without a user they stay in id order. The slice is sorted
+// in place.
+func Rank(campaigns []storage.Campaign, userID string) {
+	positions := make(map[string]Position, len(campaigns))
+	for _, campaign := range campaigns {
+		positions[campaign.ID] = PositionOf(campaign, userID)
+	}
+
+	sort.SliceStable(campaigns, func(i, j int) bool {
+		return positions[campaigns[i].ID].Before(positions[campaigns[j].ID])
+	})
+}
+
+// key is the weighted random sampling key of a campaign for a user: sorting by
+// decreasing key puts a campaign first with a probability proportional to its weight
+func key(userID string, campaign storage.Campaign) float64 {
+	weight := campaign.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+
+	return math.Log(Uniform(userID, campaign.ID)) / weight
+}
+
+// Uniform returns a number uniform in (0, 1) that only depends on keys, the draw of
+// the shuffle for the keys of a user and a campaign
+func Uniform(keys ...string) float64 {
+	h := fnv.New64a()
+	for i, key := range keys {
+		if i > 0 {
+			h.Write([]byte{0})
+		}
+		h.Write([]byte(key))
+	}
+
+	// uniform in (0, 1) from the 53 high bits of the hash
+	return (float64(mix(h.Sum64())>>11) + 0.5) / (1 << 53)
+}
+
+// mix is the murmur3 finalizer, the high bits of fnv hashes of ids that only differ
+// in their last bytes are otherwise close
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,50 @@
+package ranking
+
+import (
+	"fmt"
+	"testing"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(campaigns []storage.Campaign) []string {
+	ids := make([]string, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		ids = append(ids, campaign.ID)
+	}
+	return ids
+}
+
+// higher priority tiers come first, without a user a tier keeps its id order
+func TestRank1(t *testing.T) {
+	campaigns := []storage.Campaign{{ID: "c1"}, {ID: "c2", Priority: 1}, {ID: "c3"}, {ID: "c4", Priority: 2}, {ID: "c5", Priority: 1}}
+
+	Rank(campaigns, "")
+	assert.Equal(t, []string{"c4", "c2", "c5", "c1", "c3"}, ids(campaigns))
+}
+
+// the order of a tier only depends on the user, whatever the input order
+func TestRank2(t *testing.T) {
+	first := []storage.Campaign{{ID: "c1"}, {ID: "c2"}, {ID: "c3"}, {ID: "c4"}, {ID: "c5", Priority: 1}}
+	second := []storage.Campaign{{ID: "c4"}, {ID: "c5", Priority: 1}, {ID: "c3"}, {ID: "c2"}, {ID: "c1"}}
+
+	Rank(first, "user-1")
+	Rank(second, "user-1")
+	assert.Equal(t, ids(first), ids(second))
+	assert.Equal(t, "c5", first[0].ID)
+}
+
+// a campaign is ranked first within its tier in proportion to its weight
+func TestRank3(t *testing.T) {
+	wins := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		campaigns := []storage.Campaign{{ID: "c1", Weight: 3}, {ID: "c2"}}
+		Rank(campaigns, fmt.Sprintf("user-%d", i))
+		wins[campaigns[0].ID]++
+	}
+
+	assert.InDelta(t, 3000, wins["c1"], 150)
+	assert.InDelta(t, 1000, wins["c2"], 150)
+}
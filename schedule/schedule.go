@@ -0,0 +1,207 @@
+package schedule
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	// StatusInactive campaigns are switched off
+	StatusInactive = "inactive"
+	// StatusUpcoming campaigns are active and wait for their start date
+	StatusUpcoming = "upcoming"
+	// StatusLive campaigns are delivered
+	StatusLive = "live"
+	// StatusOffHours campaigns are within their flight dates but outside their dayparts
+	StatusOffHours = "off_hours"
+	// StatusExpired campaigns are past their end date
+	StatusExpired = "expired"
+)
+
+var (
+	// Timezone is the timezone of the dayparts of schedules without one
+	Timezone = time.UTC
+
+	days     = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+	fullDays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+)
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "schedule")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	if name := os.Getenv("SCHEDULE_TIMEZONE"); name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			level.Error(logger).Log("msg", "unknown SCHEDULE_TIMEZONE, using UTC", "timezone", name, "err", err)
+		} else {
+			Timezone = location
+		}
+	}
+}
+
+// Status returns the delivery status of a campaign at now
+func Status(campaign storage.Campaign, now time.Time) string {
+	if !campaign.IsActive {
+		return StatusInactive
+	}
+
+	s := campaign.Schedule
+	switch {
+	case s == nil:
+		return StatusLive
+	case s.StartAt != nil && now.Before(*s.StartAt):
+		return StatusUpcoming
+	case s.EndAt != nil && !now.Before(*s.EndAt):
+		return StatusExpired
+	case !inDayparts(s, now):
+		return StatusOffHours
+	}
+	return StatusLive
+}
+
+// Live reports whether a schedule allows delivery at now, a nil schedule always does
+func Live(s *storage.Schedule, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	if s.StartAt != nil && now.Before(*s.StartAt) {
+		return false
+	}
+	if s.EndAt != nil && !now.Before(*s.EndAt) {
+		return false
+	}
+	return inDayparts(s, now)
+}
+
+// Validate checks the flight dates, timezone and dayparts of a schedule
+func Validate(s *storage.Schedule) error {
+	if s == nil {
+		return nil
+	}
+
+	if s.StartAt != nil && s.EndAt != nil && !s.StartAt.Before(*s.EndAt) {
+		return errors.New("schedule startAt must be before endAt")
+	}
+
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return errors.New("unknown schedule timezone " + s.Timezone)
+		}
+	}
+
+	for _, daypart := range s.Dayparts {
+		for _, day := range daypart.Days {
+			if dayIndex(day) < 0 {
+				return errors.New("daypart day must be one of " + strings.Join(days, ", ") + ": " + day)
+			}
+		}
+		start, okStart := parseClock(daypart.Start)
+		end, okEnd := parseClock(daypart.End)
+		if !okStart || !okEnd || start == end {
+			return errors.New("daypart needs distinct HH:MM start and end: " + daypart.Start + "-" + daypart.End)
+		}
+	}
+
+	return nil
+}
+
+// Location returns the timezone of a schedule, the service default for a nil schedule
+// or one without a timezone
+func Location(s *storage.Schedule) *time.Location {
+	if s != nil && s.Timezone != "" {
+		if location, err := time.LoadLocation(s.Timezone); err == nil {
+			return location
+		}
+	}
+	return Timezone
+}
+
+// inDayparts reports whether now falls in one of the dayparts of s, in the schedule timezone
+func inDayparts(s *storage.Schedule, now time.Time) bool {
+	if len(s.Dayparts) == 0 {
+		return true
+	}
+
+	local := now.In(Location(s))
+	minute := local.Hour()*60 + local.Minute()
+	today := int(local.Weekday())
+	yesterday := (today + 6) % 7
+
+	for _, daypart := range s.Dayparts {
+		start, okStart := parseClock(daypart.Start)
+		end, okEnd := parseClock(daypart.End)
+		if !okStart || !okEnd {
+			continue
+		}
+
+		if start < end {
+			if onDay(daypart, today) && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+
+		// the window crosses midnight
+		if onDay(daypart, today) && minute >= start {
+			return true
+		}
+		if onDay(daypart, yesterday) && minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+func onDay(daypart storage.Daypart, day int) bool {
+	if len(daypart.Days) == 0 {
+		return true
+	}
+	for _, d := range daypart.Days {
+		if dayIndex(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+func dayIndex(day string) int {
+	day = strings.ToLower(day)
+	for i := range days {
+		if day == days[i] || day == fullDays[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseClock returns the minutes since midnight of an HH:MM time, 24:00 being the end of the day
+func parseClock(clock string) (int, bool) {
+	hours, minutes, ok := strings.Cut(clock, ":")
+	if !ok || len(hours) != 2 || len(minutes) != 2 {
+		return 0, false
+	}
+
+	h, err := strconv.Atoi(hours)
+	if err != nil {
+		return 0, false
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 59 || h < 0 || h > 24 || (h == 24 && m != 0) {
+		return 0, false
+	}
+	return h*60 + m, true
+}
@@ -0,0 +1,59 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func at(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+// flight dates - upcoming, live and expired
+func TestStatus1(t *testing.T) {
+	start, end := at("2026-03-01T00:00:00Z"), at("2026-04-01T00:00:00Z")
+	campaign := storage.Campaign{IsActive: true, Schedule: &storage.Schedule{StartAt: &start, EndAt: &end}}
+
+	assert.Equal(t, StatusUpcoming, Status(campaign, at("2026-02-28T23:59:59Z")))
+	assert.Equal(t, StatusLive, Status(campaign, at("2026-03-01T00:00:00Z")))
+	assert.Equal(t, StatusExpired, Status(campaign, at("2026-04-01T00:00:00Z")))
+
+	campaign.IsActive = false
+	assert.Equal(t, StatusInactive, Status(campaign, at("2026-03-15T00:00:00Z")))
+}
+
+// dayparts - evaluated in the schedule timezone, windows may cross midnight
+func TestLive1(t *testing.T) {
+	office := &storage.Schedule{Timezone: "Asia/Kolkata", Dayparts: []storage.Daypart{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}}}
+
+	// monday 09:30 in Kolkata
+	assert.True(t, Live(office, at("2026-03-02T04:00:00Z")))
+	// monday 08:30 in Kolkata
+	assert.False(t, Live(office, at("2026-03-02T03:00:00Z")))
+	// saturday 10:30 in Kolkata
+	assert.False(t, Live(office, at("2026-03-07T05:00:00Z")))
+
+	night := &storage.Schedule{Dayparts: []storage.Daypart{{Days: []string{"friday"}, Start: "22:00", End: "02:00"}}}
+	assert.True(t, Live(night, at("2026-03-06T23:00:00Z")))
+	assert.True(t, Live(night, at("2026-03-07T01:59:00Z")))
+	assert.False(t, Live(night, at("2026-03-07T02:00:00Z")))
+	assert.False(t, Live(night, at("2026-03-05T23:00:00Z")))
+}
+
+// validation of flight dates, timezones and dayparts
+func TestValidate1(t *testing.T) {
+	start, end := at("2026-03-01T00:00:00Z"), at("2026-04-01T00:00:00Z")
+
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate(&storage.Schedule{StartAt: &start, EndAt: &end, Timezone: "Europe/Paris", Dayparts: []storage.Daypart{{Start: "18:00", End: "24:00"}}}))
+	assert.Error(t, Validate(&storage.Schedule{StartAt: &end, EndAt: &start}))
+	assert.Error(t, Validate(&storage.Schedule{Timezone: "Europe/Nowhere"}))
+	assert.Error(t, Validate(&storage.Schedule{Dayparts: []storage.Daypart{{Days: []string{"someday"}, Start: "09:00", End: "17:00"}}}))
+	assert.Error(t, Validate(&storage.Schedule{Dayparts: []storage.Daypart{{Start: "09:00", End: "25:00"}}}))
+	assert.Error(t, Validate(&storage.Schedule{Dayparts: []storage.Daypart{{Start: "09:00", End: "09:00"}}}))
+}
@@ -0,0 +1,139 @@
+package segment
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/go-kit/log/level"
+)
+
+// refreshTimeout bounds a background reload of the segments
+const refreshTimeout = 5 * time.Minute
+
+// Cache holds the members of the segments of a SegmentStore in memory. Segments are
+// loaded on first use and the changed ones reloaded in the background every
+// RefreshInterval, lookups keep using the previous members meanwhile.
+type Cache struct {
+	store    storage.SegmentStore
+	interval time.Duration
+
+	// loading serializes the reloads
+	loading    sync.Mutex
+	refreshing atomic.Bool
+
+	mu       sync.RWMutex
+	loaded   bool
+	next     time.Time
+	segments map[string]cached
+}
+
+type cached struct {
+	segment storage.Segment
+	set     Set
+}
+
+// NewCache creates an empty Cache over store
+func NewCache(store storage.SegmentStore) *Cache {
+	return &Cache{
+		store:    store,
+		interval: RefreshInterval,
+		segments: make(map[string]cached),
+	}
+}
+
+// Sync loads the segments when they were never loaded, and starts a background reload
+// when the refresh interval elapsed
+func (c *Cache) Sync(ctx context.Context) error {
+	c.mu.RLock()
+	loaded, stale := c.loaded, !time.Now().Before(c.next)
+	c.mu.RUnlock()
+
+	if !loaded {
+		return c.Refresh(ctx)
+	}
+	if stale && c.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer c.refreshing.Store(false)
+			ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+			defer cancel()
+			c.Refresh(ctx)
+		}()
+	}
+	return nil
+}
+
+// Expire makes the next Sync reload the changed segments
+func (c *Cache) Expire() {
+	c.mu.Lock()
+	c.next = time.Time{}
+	c.mu.Unlock()
+}
+
+// Refresh reloads the segments whose version changed and drops the deleted ones. A
+// segment failing to load keeps its previous members until the next refresh.
+func (c *Cache) Refresh(ctx context.Context) error {
+	c.loading.Lock()
+	defer c.loading.Unlock()
+
+	segments, err := c.store.ListSegments(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "Refresh", "msg", "listing segments failed", "err", err)
+		// retried in the background after the interval rather than on every request
+		c.mu.Lock()
+		c.loaded = true
+		c.next = time.Now().Add(c.interval)
+		c.mu.Unlock()
+		return err
+	}
+
+	c.mu.RLock()
+	current := c.segments
+	c.mu.RUnlock()
+
+	fresh := make(map[string]cached, len(segments))
+	for _, segment := range segments {
+		if existing, ok := current[segment.Name]; ok && existing.segment.Version == segment.Version {
+			fresh[segment.Name] = existing
+			continue
+		}
+
+		members, err := c.store.LoadSegment(ctx, segment)
+		if err != nil {
+			level.Error(logger).Log("method", "Refresh", "msg", "loading segment failed", "segment", segment.Name, "err", err)
+			if existing, ok := current[segment.Name]; ok {
+				fresh[segment.Name] = existing
+			}
+			continue
+		}
+		set := NewSet(members)
+		fresh[segment.Name] = cached{segment: segment, set: set}
+		level.Info(logger).Log("method", "Refresh", "msg", "segment loaded", "segment", segment.Name, "members", len(set))
+	}
+
+	c.mu.Lock()
+	c.segments = fresh
+	c.loaded = true
+	c.next = time.Now().Add(c.interval)
+	c.mu.Unlock()
+	return nil
+}
+
+// Contains reports whether the normalized value is a member of the segment name
+func (c *Cache) Contains(name, value string) bool {
+	c.mu.RLock()
+	segment, ok := c.segments[name]
+	c.mu.RUnlock()
+	return ok && segment.set.Contains(value)
+}
+
+// Dimension returns the dimension of the segment name, false when it is unknown
+func (c *Cache) Dimension(name string) (string, bool) {
+	c.mu.RLock()
+	segment, ok := c.segments[name]
+	c.mu.RUnlock()
+	return segment.segment.Dimension, ok
+}
@@ -0,0 +1,169 @@
+package segment
+
+import (
+	"bufio"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"delivery-service/dimensions"
+	"delivery-service/expression"
+	"delivery-service/storage"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// maxLineLength bounds the length of an uploaded member
+const maxLineLength = 4096
+
+// RefreshInterval is the time between two reloads of the changed segments, set by
+// SEGMENTS_REFRESH_INTERVAL
+var RefreshInterval = time.Minute
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "segment")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	if interval := os.Getenv("SEGMENTS_REFRESH_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			RefreshInterval = d
+		} else {
+			level.Error(logger).Log("msg", "invalid SEGMENTS_REFRESH_INTERVAL, using default", "value", interval)
+		}
+	}
+}
+
+// Hash returns the 64-bit hash a normalized value is kept as. With tens of millions of
+// members the odds of a false membership are below one in a billion.
+func Hash(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	return h.Sum64()
+}
+
+// Set is the sorted hashes of the members of a segment, 8 bytes per member
+type Set []uint64
+
+// NewSet sorts hashes and drops the duplicates, reusing the slice
+func NewSet(hashes []uint64) Set {
+	slices.Sort(hashes)
+	return Set(slices.Compact(hashes))
+}
+
+// Contains reports whether the normalized value is a member of the set
+func (s Set) Contains(value string) bool {
+	_, found := slices.BinarySearch(s, Hash(value))
+	return found
+}
+
+// NormalizeUserID returns the form user and device ids are compared in
+func NormalizeUserID(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
+
+// RequestParams returns the normalized params with the user id of the request, which
+// segments of user_id are matched on
+func RequestParams(params map[string]string, userID string) map[string]string {
+	if userID == "" {
+		return params
+	}
+	request := make(map[string]string, len(params)+1)
+	for name, value := range params {
+		request[name] = value
+	}
+	request[dimensions.UserID] = NormalizeUserID(userID)
+	return request
+}
+
+// Match reports whether the request params are in one of the include segments of
+// targeting, when it has any, and in none of its exclude segments. Unknown segments
+// have no members.
+func Match(targeting *storage.SegmentTargeting, segments storage.Segments, params map[string]string) bool {
+	if targeting == nil {
+		return true
+	}
+	for _, name := range targeting.Exclude {
+		if member(segments, name, params) {
+			return false
+		}
+	}
+	if len(targeting.Include) == 0 {
+		return true
+	}
+	for _, name := range targeting.Include {
+		if member(segments, name, params) {
+			return true
+		}
+	}
+	return false
+}
+
+func member(segments storage.Segments, name string, params map[string]string) bool {
+	if segments == nil {
+		return false
+	}
+	dimension, ok := segments.Dimension(name)
+	if !ok {
+		return false
+	}
+	value, ok := params[dimension]
+	return ok && segments.Contains(name, value)
+}
+
+// Targeted reports whether a campaign may target segments, through its segments or the
+// segment references of its expression, for lookups loading the segments only when a
+// campaign needs them
+func Targeted(campaign storage.Campaign) bool {
+	if campaign.Segments != nil {
+		return true
+	}
+	if campaign.Expression == "" {
+		return false
+	}
+	expr, err := expression.Parse(campaign.Expression)
+	return err == nil && References(expr)
+}
+
+// References reports whether a parsed expression compares dimensions with segments
+func References(expr *expression.Expr) bool {
+	return len(expr.SegmentReferences()) > 0
+}
+
+// Read hashes the members of an upload, one value per line. Values are normalized with
+// normalize, empty lines are ignored and the values normalize rejects are skipped.
+func Read(r io.Reader, normalize func(string) (string, error)) (Set, int, error) {
+	var hashes []uint64
+	skipped := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, maxLineLength), maxLineLength)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		value, err := normalize(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		hashes = append(hashes, Hash(value))
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, 0, errors.New("members must be one per line and shorter than 4096 bytes")
+		}
+		return nil, 0, err
+	}
+	return NewSet(hashes), skipped, nil
+}
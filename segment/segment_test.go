@@ -0,0 +1,154 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// segments is a storage.Segments of member lists
+type segments map[string]struct {
+	dimension string
+	members   []string
+}
+
+func (s segments) Contains(name, value string) bool {
+	for _, member := range s[name].members {
+		if member == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s segments) Dimension(name string) (string, bool) {
+	segment, ok := s[name]
+	return segment.dimension, ok
+}
+
+// store is a storage.SegmentStore of listed segments and their members per version
+type store struct {
+	segments []storage.Segment
+	members  map[int64][]uint64
+	loads    int
+}
+
+func (s *store) ListSegments(ctx context.Context) ([]storage.Segment, error) {
+	return s.segments, nil
+}
+
+func (s *store) LoadSegment(ctx context.Context, segment storage.Segment) ([]uint64, error) {
+	s.loads++
+	return append([]uint64{}, s.members[segment.Version]...), nil
+}
+
+func (s *store) SaveSegment(ctx context.Context, segment storage.Segment, members []uint64) error {
+	return errors.New("read only")
+}
+
+func (s *store) DeleteSegment(ctx context.Context, name string) error {
+	return errors.New("read only")
+}
+
+// sets hash and deduplicate their members
+func TestSet1(t *testing.T) {
+	set := NewSet([]uint64{Hash("b"), Hash("a"), Hash("b")})
+	assert.Len(t, set, 2)
+	assert.True(t, set.Contains("a"))
+	assert.True(t, set.Contains("b"))
+	assert.False(t, set.Contains("c"))
+	assert.False(t, Set(nil).Contains("a"))
+}
+
+// requests must be in an include segment and in no exclude segment, unknown segments have no members
+func TestMatch1(t *testing.T) {
+	s := segments{
+		"whales":  {dimension: "user_id", members: []string{"u1", "u2"}},
+		"churned": {dimension: "user_id", members: []string{"u2"}},
+		"games":   {dimension: "app", members: []string{"com.a.game"}},
+	}
+	targeting := &storage.SegmentTargeting{Include: []string{"whales", "games"}, Exclude: []string{"churned"}}
+
+	assert.True(t, Match(targeting, s, map[string]string{"user_id": "u1"}))
+	assert.False(t, Match(targeting, s, map[string]string{"user_id": "u2"}))
+	assert.True(t, Match(targeting, s, map[string]string{"user_id": "u3", "app": "com.a.game"}))
+	assert.False(t, Match(targeting, s, map[string]string{"app": "com.b.game"}))
+
+	assert.True(t, Match(nil, nil, map[string]string{}))
+	assert.True(t, Match(&storage.SegmentTargeting{Exclude: []string{"unknown"}}, s, map[string]string{"user_id": "u1"}))
+	assert.False(t, Match(&storage.SegmentTargeting{Include: []string{"whales"}}, nil, map[string]string{"user_id": "u1"}))
+}
+
+// uploads are normalized line by line, invalid values are skipped
+func TestRead1(t *testing.T) {
+	normalize := func(value string) (string, error) {
+		if strings.Contains(value, " ") {
+			return "", errors.New("no spaces")
+		}
+		return strings.ToLower(value), nil
+	}
+
+	set, skipped, err := Read(strings.NewReader("ABC\n\n  abc  \r\nnot valid\ndef\n"), normalize)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, skipped)
+	assert.Len(t, set, 2)
+	assert.True(t, set.Contains("abc"))
+	assert.True(t, set.Contains("def"))
+
+	_, _, err = Read(strings.NewReader(strings.Repeat("a", maxLineLength+1)), normalize)
+	assert.Error(t, err)
+}
+
+// the cache loads the segments on first use and reloads the changed versions
+func TestCache1(t *testing.T) {
+	stored := &store{
+		segments: []storage.Segment{{Name: "whales", Dimension: "user_id", Version: 1}},
+		members:  map[int64][]uint64{1: {Hash("u1")}, 2: {Hash("u2")}},
+	}
+	cache := NewCache(stored)
+
+	assert.NoError(t, cache.Sync(context.Background()))
+	assert.True(t, cache.Contains("whales", "u1"))
+	dimension, ok := cache.Dimension("whales")
+	assert.True(t, ok)
+	assert.Equal(t, "user_id", dimension)
+
+	// unchanged versions are not loaded again
+	assert.NoError(t, cache.Refresh(context.Background()))
+	assert.Equal(t, 1, stored.loads)
+
+	stored.segments = []storage.Segment{{Name: "whales", Dimension: "user_id", Version: 2}, {Name: "churned", Dimension: "user_id", Version: 1}}
+	assert.NoError(t, cache.Refresh(context.Background()))
+	assert.False(t, cache.Contains("whales", "u1"))
+	assert.True(t, cache.Contains("whales", "u2"))
+	assert.True(t, cache.Contains("churned", "u1"))
+
+	stored.segments = nil
+	assert.NoError(t, cache.Refresh(context.Background()))
+	_, ok = cache.Dimension("whales")
+	assert.False(t, ok)
+}
+
+// the user id of a request is added to a copy of the params
+func TestRequestParams1(t *testing.T) {
+	params := map[string]string{"os": "ios"}
+	assert.Equal(t, map[string]string{"os": "ios", "user_id": "abc-def"}, RequestParams(params, " ABC-def"))
+	assert.Equal(t, map[string]string{"os": "ios"}, params)
+	assert.Equal(t, params, RequestParams(params, ""))
+}
+
+// campaigns target segments through their segments or the segment references of their
+// expression, not through values that merely contain the word
+func TestTargeted1(t *testing.T) {
+	assert.True(t, Targeted(storage.Campaign{Segments: &storage.SegmentTargeting{Include: []string{"whales"}}}))
+	assert.True(t, Targeted(storage.Campaign{Expression: `os == "ios" and user_id in segment("whales")`}))
+	assert.True(t, Targeted(storage.Campaign{Expression: `app not in segment("churned")`}))
+	assert.False(t, Targeted(storage.Campaign{Expression: `channel == "segment" or segment_id in ["a", "b"]`}))
+	assert.False(t, Targeted(storage.Campaign{Expression: `segment(`}))
+	assert.False(t, Targeted(storage.Campaign{}))
+}
@@ -0,0 +1,457 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"delivery-service/budget"
+	"delivery-service/creative"
+	"delivery-service/dimensions"
+	local_error "delivery-service/errors"
+	"delivery-service/experiment"
+	"delivery-service/frequency"
+	"delivery-service/locale"
+	"delivery-service/placement"
+	"delivery-service/schedule"
+	"delivery-service/storage"
+	"delivery-service/validation"
+
+	"github.com/go-kit/log/level"
+)
+
+var (
+	campaignIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// CampaignDetails is a campaign as managed through the admin API
+type CampaignDetails struct {
+	ID        string              `json:"id"`
+	Image     string              `json:"image"`
+	Cta       string              `json:"cta"`
+	IsActive  bool                `json:"isActive"`
+	Countries []string            `json:"countries"`
+	Rules     map[string][]string `json:"rules,omitempty"`
+	// Expression is a boolean targeting expression like (country in ["US", "CA"] and os == "ios")
+	Expression string            `json:"expression,omitempty"`
+	Schedule   *storage.Schedule `json:"schedule,omitempty"`
+	Priority   int               `json:"priority,omitempty"`
+	Weight     float64           `json:"weight,omitempty"`
+	Variants   []storage.Variant `json:"variants,omitempty"`
+	// FrequencyCap limits the impressions per user recorded through the impressions API
+	FrequencyCap *storage.FrequencyCap `json:"frequencyCap,omitempty"`
+	Budget       *storage.Budget       `json:"budget,omitempty"`
+	// Segments includes or excludes audience segments uploaded through the segments API
+	Segments *storage.SegmentTargeting `json:"segments,omitempty"`
+	// Placements includes or excludes placements managed through the placements API
+	Placements *storage.PlacementTargeting `json:"placements,omitempty"`
+	// Formats are the creative formats of the campaign, like banner or video
+	Formats []string `json:"formats,omitempty"`
+	// Size is the WIDTHxHEIGHT size of the creative
+	Size string `json:"size,omitempty"`
+	// Creative holds typed image, video, html, localized text and tracking assets
+	Creative *storage.Creative `json:"creative,omitempty"`
+	// Localized overrides the image and the cta by BCP 47 language tag, like pt or pt-BR
+	Localized map[string]storage.Localization `json:"localized,omitempty"`
+	// Status is the delivery status computed from IsActive and Schedule, ignored in requests
+	Status string `json:"status,omitempty"`
+}
+
+// AdminService defines the campaign management operations
+type AdminService interface {
+	ListCampaigns(ctx context.Context) ([]CampaignDetails, error)
+	GetCampaign(ctx context.Context, id string) (CampaignDetails, error)
+	CreateCampaign(ctx context.Context, campaign CampaignDetails) (CampaignDetails, error)
+	UpdateCampaign(ctx context.Context, campaign CampaignDetails) (CampaignDetails, error)
+	UpdateRules(ctx context.Context, id string, rules map[string][]string) (CampaignDetails, error)
+	SetActive(ctx context.Context, id string, active bool) (CampaignDetails, error)
+	DeleteCampaign(ctx context.Context, id string) error
+	Validate(ctx context.Context) ([]validation.Issue, error)
+	ListSegments(ctx context.Context) ([]storage.Segment, error)
+	UploadSegment(ctx context.Context, name, dimension string, members io.Reader) (SegmentUpload, error)
+	DeleteSegment(ctx context.Context, name string) error
+	ListPlacements(ctx context.Context) ([]storage.Placement, error)
+	SavePlacement(ctx context.Context, placement storage.Placement) (storage.Placement, error)
+	DeletePlacement(ctx context.Context, id string) error
+}
+
+// adminService is the implementation of the AdminService interface
+type adminService struct {
+	store storage.CampaignAdmin
+	// segments is the store itself when it keeps segments, nil otherwise
+	segments storage.SegmentStore
+	// placements is the store itself when it keeps placements, nil otherwise
+	placements storage.PlacementStore
+}
+
+// NewAdminService creates and returns a new AdminService writing campaigns to store.
+// Segments and placements are managed when the store is also a storage.SegmentStore and
+// a storage.PlacementStore.
+func NewAdminService(store storage.CampaignAdmin) AdminService {
+	segments, _ := store.(storage.SegmentStore)
+	placements, _ := store.(storage.PlacementStore)
+	return &adminService{
+		store:      store,
+		segments:   segments,
+		placements: placements,
+	}
+}
+
+// ListCampaigns returns every campaign, active or not
+func (s *adminService) ListCampaigns(ctx context.Context) ([]CampaignDetails, error) {
+	campaigns, err := s.store.FindCampaigns(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "ListCampaigns", "msg", "listing campaigns failed", "err", err)
+		return nil, err
+	}
+
+	details := make([]CampaignDetails, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		details = append(details, toDetails(campaign))
+	}
+	return details, nil
+}
+
+// GetCampaign returns a single campaign
+func (s *adminService) GetCampaign(ctx context.Context, id string) (CampaignDetails, error) {
+	campaign, err := s.get(ctx, id)
+	if err != nil {
+		return CampaignDetails{}, err
+	}
+	return toDetails(campaign), nil
+}
+
+// CreateCampaign validates and stores a new campaign
+func (s *adminService) CreateCampaign(ctx context.Context, campaign CampaignDetails) (CampaignDetails, error) {
+	if err := s.validate(ctx, campaign); err != nil {
+		return CampaignDetails{}, err
+	}
+
+	if _, err := s.store.GetCampaign(ctx, campaign.ID); err == nil {
+		return CampaignDetails{}, &local_error.ErrCampaignExists{ID: campaign.ID}
+	} else if !errors.Is(err, storage.ErrCampaignNotFound) {
+		return CampaignDetails{}, err
+	}
+
+	return s.save(ctx, campaign)
+}
+
+// UpdateCampaign validates and replaces an existing campaign
+func (s *adminService) UpdateCampaign(ctx context.Context, campaign CampaignDetails) (CampaignDetails, error) {
+	if err := s.validate(ctx, campaign); err != nil {
+		return CampaignDetails{}, err
+	}
+
+	if _, err := s.get(ctx, campaign.ID); err != nil {
+		return CampaignDetails{}, err
+	}
+
+	return s.save(ctx, campaign)
+}
+
+// UpdateRules replaces the include/exclude rules of an existing campaign
+func (s *adminService) UpdateRules(ctx context.Context, id string, rules map[string][]string) (CampaignDetails, error) {
+	campaign, err := s.get(ctx, id)
+	if err != nil {
+		return CampaignDetails{}, err
+	}
+
+	details := toDetails(campaign)
+	details.Rules = rules
+	if err := s.validate(ctx, details); err != nil {
+		return CampaignDetails{}, err
+	}
+
+	return s.save(ctx, details)
+}
+
+// SetActive activates or deactivates an existing campaign, a campaign is only
+// activated when it passes validation as an active campaign
+func (s *adminService) SetActive(ctx context.Context, id string, active bool) (CampaignDetails, error) {
+	campaign, err := s.get(ctx, id)
+	if err != nil {
+		return CampaignDetails{}, err
+	}
+
+	details := toDetails(campaign)
+	details.IsActive = active
+	// campaigns with invalid rules can still be deactivated
+	if active {
+		err = s.validate(ctx, details)
+	} else {
+		err = validateCampaign(details)
+	}
+	if err != nil {
+		return CampaignDetails{}, err
+	}
+
+	return s.save(ctx, details)
+}
+
+// DeleteCampaign removes a campaign and its country entries
+func (s *adminService) DeleteCampaign(ctx context.Context, id string) error {
+	err := s.store.DeleteCampaign(ctx, id)
+	if errors.Is(err, storage.ErrCampaignNotFound) {
+		return &local_error.ErrCampaignNotFound{ID: id}
+	}
+	if err != nil {
+		level.Error(logger).Log("method", "DeleteCampaign", "msg", "deleting campaign failed", "id", id, "err", err)
+	}
+	return err
+}
+
+// Validate checks the rules of every campaign, active or not, against the rule parameters
+func (s *adminService) Validate(ctx context.Context) ([]validation.Issue, error) {
+	parameters, err := s.store.GetParameters(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "Validate", "msg", "loading rule parameters failed", "err", err)
+		return nil, err
+	}
+
+	campaigns, err := s.store.FindCampaigns(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "Validate", "msg", "listing campaigns failed", "err", err)
+		return nil, err
+	}
+
+	return validation.New(dimensions.New(parameters)).Validate(campaigns), nil
+}
+
+// validate checks a campaign payload and its rules against the rule parameters
+func (s *adminService) validate(ctx context.Context, details CampaignDetails) error {
+	if err := validateCampaign(details); err != nil {
+		return err
+	}
+
+	parameters, err := s.store.GetParameters(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "validate", "msg", "loading rule parameters failed", "err", err)
+		return err
+	}
+
+	issues := validation.New(dimensions.New(parameters)).ValidateCampaign(toCampaign(details))
+	if len(issues) > 0 {
+		issue := issues[0]
+		reason := issue.Rule + ": " + issue.Reason
+		if issue.Value != "" {
+			reason = issue.Rule + " " + issue.Value + ": " + issue.Reason
+		}
+		return &local_error.ErrInvalidPayload{Reason: reason}
+	}
+	return s.checkSegments(ctx, details)
+}
+
+func (s *adminService) get(ctx context.Context, id string) (storage.Campaign, error) {
+	campaign, err := s.store.GetCampaign(ctx, id)
+	if errors.Is(err, storage.ErrCampaignNotFound) {
+		return storage.Campaign{}, &local_error.ErrCampaignNotFound{ID: id}
+	}
+	if err != nil {
+		level.Error(logger).Log("method", "get", "msg", "reading campaign failed", "id", id, "err", err)
+	}
+	return campaign, err
+}
+
+func (s *adminService) save(ctx context.Context, details CampaignDetails) (CampaignDetails, error) {
+	if err := s.store.SaveCampaign(ctx, toCampaign(details)); err != nil {
+		level.Error(logger).Log("method", "save", "msg", "saving campaign failed", "id", details.ID, "err", err)
+		return CampaignDetails{}, err
+	}
+
+	level.Info(logger).Log("method", "save", "msg", "campaign saved", "id", details.ID, "active", details.IsActive)
+	return toDetails(toCampaign(details)), nil
+}
+
+func toCampaign(details CampaignDetails) storage.Campaign {
+	return storage.Campaign{
+		ID:           details.ID,
+		Image:        details.Image,
+		Cta:          details.Cta,
+		IsActive:     details.IsActive,
+		Rules:        details.Rules,
+		Expression:   details.Expression,
+		Schedule:     details.Schedule,
+		Priority:     details.Priority,
+		Weight:       details.Weight,
+		Countries:    lowerCountries(details.Countries),
+		Variants:     details.Variants,
+		FrequencyCap: details.FrequencyCap,
+		Budget:       details.Budget,
+		Segments:     details.Segments,
+		Placements:   details.Placements,
+		Formats:      details.Formats,
+		Size:         details.Size,
+		Creative:     details.Creative,
+		Localized:    details.Localized,
+	}
+}
+
+// lowerCountries returns the lower case form campaigns keep their countries in
+func lowerCountries(countries []string) []string {
+	var lower []string
+	for _, country := range countries {
+		lower = append(lower, strings.ToLower(country))
+	}
+	return lower
+}
+
+func toDetails(campaign storage.Campaign) CampaignDetails {
+	return CampaignDetails{
+		ID:           campaign.ID,
+		Image:        campaign.Image,
+		Cta:          campaign.Cta,
+		IsActive:     campaign.IsActive,
+		Countries:    campaign.Countries,
+		Rules:        campaign.Rules,
+		Expression:   campaign.Expression,
+		Schedule:     campaign.Schedule,
+		Priority:     campaign.Priority,
+		Weight:       campaign.Weight,
+		Variants:     campaign.Variants,
+		FrequencyCap: campaign.FrequencyCap,
+		Budget:       campaign.Budget,
+		Segments:     campaign.Segments,
+		Placements:   campaign.Placements,
+		Formats:      campaign.Formats,
+		Size:         campaign.Size,
+		Creative:     campaign.Creative,
+		Localized:    campaign.Localized,
+		Status:       schedule.Status(campaign, time.Now()),
+	}
+}
+
+// validateLocalized checks the localizations of a campaign or a variant: BCP 47 language
+// tags, unique regardless of case, and http(s) images
+func validateLocalized(localized map[string]storage.Localization) error {
+	tags := make([]string, 0, len(localized))
+	for tag := range localized {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	seen := make(map[string]struct{}, len(localized))
+	for _, tag := range tags {
+		if !locale.IsTag(tag) {
+			return errors.New("localized language must be a BCP 47 tag, like pt or pt-BR: " + tag)
+		}
+		if _, ok := seen[strings.ToLower(tag)]; ok {
+			return errors.New("duplicate localized language: " + tag)
+		}
+		seen[strings.ToLower(tag)] = struct{}{}
+
+		if image := localized[tag].Image; image != "" {
+			if u, err := url.Parse(image); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("localized " + tag + " image must be an http(s) url")
+			}
+		}
+	}
+	return nil
+}
+
+// validateCampaign checks a campaign payload, active campaigns must be deliverable
+func validateCampaign(campaign CampaignDetails) error {
+	if !campaignIDPattern.MatchString(campaign.ID) {
+		return &local_error.ErrInvalidPayload{Reason: "id must be made of letters, digits, '_', '.' or '-'"}
+	}
+
+	if campaign.Image != "" {
+		if u, err := url.Parse(campaign.Image); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &local_error.ErrInvalidPayload{Reason: "image must be an http(s) url"}
+		}
+	}
+
+	if campaign.IsActive {
+		// variants and typed creatives carry their own assets
+		if campaign.Image == "" && len(campaign.Variants) == 0 && !creative.HasAsset(campaign.Creative) {
+			return &local_error.ErrInvalidPayload{Reason: "active campaign needs an image"}
+		}
+		if strings.TrimSpace(campaign.Cta) == "" && len(campaign.Variants) == 0 {
+			return &local_error.ErrInvalidPayload{Reason: "active campaign needs a cta"}
+		}
+		if len(campaign.Countries) == 0 {
+			return &local_error.ErrInvalidPayload{Reason: "active campaign needs at least one country"}
+		}
+	}
+
+	if campaign.Weight < 0 {
+		return &local_error.ErrInvalidPayload{Reason: "weight must not be negative"}
+	}
+
+	if err := schedule.Validate(campaign.Schedule); err != nil {
+		return &local_error.ErrInvalidPayload{Reason: err.Error()}
+	}
+
+	if err := experiment.Validate(campaign.Variants); err != nil {
+		return &local_error.ErrInvalidPayload{Reason: err.Error()}
+	}
+
+	if err := frequency.Validate(campaign.FrequencyCap); err != nil {
+		return &local_error.ErrInvalidPayload{Reason: err.Error()}
+	}
+
+	if err := budget.Validate(campaign.Budget, campaign.Schedule); err != nil {
+		return &local_error.ErrInvalidPayload{Reason: err.Error()}
+	}
+
+	seen := make(map[string]struct{}, len(campaign.Countries))
+	for _, country := range campaign.Countries {
+		if !dimensions.IsCountryCode(country) {
+			return &local_error.ErrInvalidPayload{Reason: "invalid country: " + country + ", not an ISO 3166-1 alpha-2 code"}
+		}
+		if _, ok := seen[strings.ToLower(country)]; ok {
+			return &local_error.ErrInvalidPayload{Reason: "duplicate country: " + country}
+		}
+		seen[strings.ToLower(country)] = struct{}{}
+	}
+
+	if campaign.Segments != nil {
+		for _, name := range append(append([]string{}, campaign.Segments.Include...), campaign.Segments.Exclude...) {
+			if !campaignIDPattern.MatchString(name) {
+				return &local_error.ErrInvalidPayload{Reason: "invalid segment: " + name}
+			}
+		}
+	}
+
+	if campaign.Placements != nil {
+		for _, id := range append(append([]string{}, campaign.Placements.Include...), campaign.Placements.Exclude...) {
+			if !campaignIDPattern.MatchString(id) {
+				return &local_error.ErrInvalidPayload{Reason: "invalid placement: " + id}
+			}
+		}
+	}
+
+	if err := placement.Validate(campaign.Formats, campaign.Size); err != nil {
+		return &local_error.ErrInvalidPayload{Reason: err.Error()}
+	}
+
+	if err := creative.Validate(campaign.Creative); err != nil {
+		return &local_error.ErrInvalidPayload{Reason: err.Error()}
+	}
+
+	if err := validateLocalized(campaign.Localized); err != nil {
+		return &local_error.ErrInvalidPayload{Reason: err.Error()}
+	}
+	for _, variant := range campaign.Variants {
+		if err := validateLocalized(variant.Localized); err != nil {
+			return &local_error.ErrInvalidPayload{Reason: "variant " + variant.ID + " " + err.Error()}
+		}
+	}
+
+	for key, values := range campaign.Rules {
+		if _, _, ok := dimensions.RuleKey(key); !ok {
+			return &local_error.ErrInvalidPayload{Reason: "rule must be include<param> or exclude<param>: " + key}
+		}
+		for _, value := range values {
+			if value == "" {
+				return &local_error.ErrInvalidPayload{Reason: "empty value in rule " + key}
+			}
+		}
+	}
+
+	return nil
+}
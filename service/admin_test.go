@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	local_error "delivery-service/errors"
+	"delivery-service/mocks"
+	"delivery-service/schedule"
+	"delivery-service/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newAdminStore returns a CampaignAdmin mock backed by the campaigns map
+func newAdminStore(campaigns map[string]storage.Campaign) mocks.CampaignAdminMock {
+	return mocks.CampaignAdminMock{
+		CampaignStoreMock: mocks.CampaignStoreMock{
+			GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+				return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+			},
+		},
+		FindCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			var list []storage.Campaign
+			for _, campaign := range campaigns {
+				list = append(list, campaign)
+			}
+			return list, nil
+		},
+		GetCampaignMock: func(ctx context.Context, id string) (storage.Campaign, error) {
+			if campaign, ok := campaigns[id]; ok {
+				return campaign, nil
+			}
+			return storage.Campaign{}, storage.ErrCampaignNotFound
+		},
+		SaveCampaignMock: func(ctx context.Context, campaign storage.Campaign) error {
+			campaigns[campaign.ID] = campaign
+			return nil
+		},
+		DeleteCampaignMock: func(ctx context.Context, id string) error {
+			if _, ok := campaigns[id]; !ok {
+				return storage.ErrCampaignNotFound
+			}
+			delete(campaigns, id)
+			return nil
+		},
+	}
+}
+
+// create campaign - success
+func TestCreateCampaign1(t *testing.T) {
+	campaigns := map[string]storage.Campaign{}
+	svc := NewAdminService(newAdminStore(campaigns))
+
+	campaign := CampaignDetails{ID: "spotify", Image: "https://img/spotify.png", Cta: "Download", IsActive: true, Countries: []string{"us"}, Rules: map[string][]string{"includeos": {"android"}}}
+	created, err := svc.CreateCampaign(context.Background(), campaign)
+	assert.NoError(t, err)
+	campaign.Status = schedule.StatusLive
+	assert.Equal(t, campaign, created)
+	assert.Equal(t, []string{"us"}, campaigns["spotify"].Countries)
+
+	campaign.ID, campaign.Countries = "deezer", []string{"FR"}
+	_, err = svc.CreateCampaign(context.Background(), campaign)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fr"}, campaigns["deezer"].Countries)
+}
+
+// create campaign - failed because an active campaign has no image
+func TestCreateCampaign2(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{}))
+
+	_, err := svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Cta: "Download", IsActive: true, Countries: []string{"us"}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+}
+
+// create campaign - failed because the campaign exists
+func TestCreateCampaign3(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{"spotify": {ID: "spotify"}}))
+
+	_, err := svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify"})
+	assert.IsType(t, &local_error.ErrCampaignExists{}, err)
+}
+
+// create campaign - failed because of invalid rules and countries
+func TestCreateCampaign4(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{}))
+
+	_, err := svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Rules: map[string][]string{"os": {"android"}}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Countries: []string{"campaigns_details"}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Countries: []string{"us", "US"}})
+	assert.EqualError(t, err, "invalid payload: duplicate country: US")
+}
+
+// activate campaign - failed because the stored campaign is not deliverable, succeeds once fixed
+func TestSetActive1(t *testing.T) {
+	campaigns := map[string]storage.Campaign{"spotify": {ID: "spotify", Cta: "Download", Countries: []string{"us"}}}
+	svc := NewAdminService(newAdminStore(campaigns))
+
+	_, err := svc.SetActive(context.Background(), "spotify", true)
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+	assert.False(t, campaigns["spotify"].IsActive)
+
+	_, err = svc.UpdateCampaign(context.Background(), CampaignDetails{ID: "spotify", Image: "https://img/spotify.png", Cta: "Download", Countries: []string{"us"}})
+	assert.NoError(t, err)
+
+	activated, err := svc.SetActive(context.Background(), "spotify", true)
+	assert.NoError(t, err)
+	assert.True(t, activated.IsActive)
+	assert.True(t, campaigns["spotify"].IsActive)
+}
+
+// create campaign - failed because of a rule on an unknown dimension or an unknown country code
+func TestCreateCampaign5(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{}))
+
+	_, err := svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Countries: []string{"us"}, Rules: map[string][]string{"includeOS": {"android"}}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+	assert.Contains(t, err.Error(), "did you mean os?")
+
+	_, err = svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Countries: []string{"xx"}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+}
+
+// validate - reports the issues of inactive campaigns too
+func TestValidate1(t *testing.T) {
+	campaigns := map[string]storage.Campaign{
+		"spotify":  {ID: "spotify", Countries: []string{"us"}, Rules: map[string][]string{"includeos": {"android"}}},
+		"duolingo": {ID: "duolingo", Countries: []string{"us"}, Rules: map[string][]string{"excludeapp": {"not an app"}}},
+	}
+	svc := NewAdminService(newAdminStore(campaigns))
+
+	issues, err := svc.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, "duolingo", issues[0].CampaignID)
+	assert.Equal(t, "not an app", issues[0].Value)
+}
+
+// list campaigns - upcoming and expired campaigns are listed with their status
+func TestListCampaigns1(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{
+		"spotify":  {ID: "spotify", IsActive: true, Schedule: &storage.Schedule{StartAt: &future}},
+		"duolingo": {ID: "duolingo", IsActive: true, Schedule: &storage.Schedule{StartAt: &past, EndAt: &past}},
+	}))
+
+	campaigns, err := svc.ListCampaigns(context.Background())
+	assert.NoError(t, err)
+	statuses := map[string]string{}
+	for _, campaign := range campaigns {
+		statuses[campaign.ID] = campaign.Status
+	}
+	assert.Equal(t, map[string]string{"spotify": schedule.StatusUpcoming, "duolingo": schedule.StatusExpired}, statuses)
+}
+
+// create campaign - failed because of an invalid schedule
+func TestCreateCampaign6(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{}))
+
+	_, err := svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Schedule: &storage.Schedule{Dayparts: []storage.Daypart{{Start: "9:00", End: "17:00"}}}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Schedule: &storage.Schedule{Timezone: "Mars/Olympus"}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+}
+
+// delete campaign - failed because the campaign does not exist
+func TestDeleteCampaign1(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{}))
+
+	err := svc.DeleteCampaign(context.Background(), "spotify")
+	assert.IsType(t, &local_error.ErrCampaignNotFound{}, err)
+}
+
+// segmentAdminStore is a CampaignAdmin keeping segments
+type segmentAdminStore struct {
+	mocks.CampaignAdminMock
+	mocks.SegmentStoreMock
+}
+
+// newSegmentAdminStore returns a segmentAdminStore backed by the campaigns and segments maps
+func newSegmentAdminStore(campaigns map[string]storage.Campaign, segments map[string]storage.Segment) segmentAdminStore {
+	return segmentAdminStore{
+		CampaignAdminMock: newAdminStore(campaigns),
+		SegmentStoreMock: mocks.SegmentStoreMock{
+			ListSegmentsMock: func(ctx context.Context) ([]storage.Segment, error) {
+				var list []storage.Segment
+				for _, segment := range segments {
+					list = append(list, segment)
+				}
+				return list, nil
+			},
+			SaveSegmentMock: func(ctx context.Context, segment storage.Segment, members []uint64) error {
+				segments[segment.Name] = segment
+				return nil
+			},
+			DeleteSegmentMock: func(ctx context.Context, name string) error {
+				if _, ok := segments[name]; !ok {
+					return storage.ErrSegmentNotFound
+				}
+				delete(segments, name)
+				return nil
+			},
+		},
+	}
+}
+
+// upload segment - values are normalized with the dimension, invalid ones skipped
+func TestUploadSegment1(t *testing.T) {
+	segments := map[string]storage.Segment{}
+	svc := NewAdminService(newSegmentAdminStore(map[string]storage.Campaign{}, segments))
+
+	upload, err := svc.UploadSegment(context.Background(), "games", "app", strings.NewReader("com.a.game\ncom.b.game\nnot an app\ncom.a.game\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, upload.Segment.Size)
+	assert.Equal(t, 1, upload.Skipped)
+	assert.Equal(t, "app", segments["games"].Dimension)
+
+	_, err = svc.UploadSegment(context.Background(), "games", "device", strings.NewReader("abc\n"))
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = NewAdminService(newAdminStore(map[string]storage.Campaign{})).UploadSegment(context.Background(), "games", "app", strings.NewReader(""))
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+}
+
+// create campaign - targeted segments must exist and be compared with their dimension
+func TestCreateCampaign7(t *testing.T) {
+	segments := map[string]storage.Segment{"whales": {Name: "whales", Dimension: "user_id"}}
+	svc := NewAdminService(newSegmentAdminStore(map[string]storage.Campaign{}, segments))
+
+	_, err := svc.CreateCampaign(context.Background(), CampaignDetails{ID: "spotify", Countries: []string{"us"}, Segments: &storage.SegmentTargeting{Include: []string{"whales"}}, Expression: `user_id not in segment("whales")`})
+	assert.NoError(t, err)
+
+	_, err = svc.CreateCampaign(context.Background(), CampaignDetails{ID: "duolingo", Countries: []string{"us"}, Segments: &storage.SegmentTargeting{Exclude: []string{"churned"}}})
+	assert.EqualError(t, err, "invalid payload: unknown segment: churned")
+
+	_, err = svc.CreateCampaign(context.Background(), CampaignDetails{ID: "duolingo", Countries: []string{"us"}, Expression: `app in segment("whales")`})
+	assert.EqualError(t, err, "invalid payload: segment whales lists user_id values, not app")
+}
+
+// delete segment - failed while a campaign targets it
+func TestDeleteSegment1(t *testing.T) {
+	campaigns := map[string]storage.Campaign{"spotify": {ID: "spotify", Segments: &storage.SegmentTargeting{Exclude: []string{"whales"}}}}
+	segments := map[string]storage.Segment{"whales": {Name: "whales", Dimension: "user_id"}}
+	svc := NewAdminService(newSegmentAdminStore(campaigns, segments))
+
+	err := svc.DeleteSegment(context.Background(), "whales")
+	assert.IsType(t, &local_error.ErrSegmentInUse{}, err)
+
+	delete(campaigns, "spotify")
+	assert.NoError(t, svc.DeleteSegment(context.Background(), "whales"))
+	assert.IsType(t, &local_error.ErrSegmentNotFound{}, svc.DeleteSegment(context.Background(), "whales"))
+}
+
+// placementAdminStore is a CampaignAdmin keeping placements
+type placementAdminStore struct {
+	mocks.CampaignAdminMock
+	mocks.PlacementStoreMock
+}
+
+// newPlacementAdminStore returns a placementAdminStore backed by the campaigns and placements maps
+func newPlacementAdminStore(campaigns map[string]storage.Campaign, placements map[string]storage.Placement) placementAdminStore {
+	return placementAdminStore{
+		CampaignAdminMock: newAdminStore(campaigns),
+		PlacementStoreMock: mocks.PlacementStoreMock{
+			ListPlacementsMock: func(ctx context.Context) ([]storage.Placement, error) {
+				var list []storage.Placement
+				for _, placement := range placements {
+					list = append(list, placement)
+				}
+				return list, nil
+			},
+			SavePlacementMock: func(ctx context.Context, placement storage.Placement) error {
+				placements[placement.ID] = placement
+				return nil
+			},
+			DeletePlacementMock: func(ctx context.Context, id string) error {
+				if _, ok := placements[id]; !ok {
+					return storage.ErrPlacementNotFound
+				}
+				delete(placements, id)
+				return nil
+			},
+		},
+	}
+}
+
+// save placement - formats and size are validated
+func TestSavePlacement1(t *testing.T) {
+	placements := map[string]storage.Placement{}
+	svc := NewAdminService(newPlacementAdminStore(map[string]storage.Campaign{}, placements))
+
+	saved, err := svc.SavePlacement(context.Background(), storage.Placement{ID: "home_banner", App: "com.example.app", Formats: []string{"banner"}, Size: "320x50"})
+	assert.NoError(t, err)
+	assert.Equal(t, placements["home_banner"], saved)
+
+	_, err = svc.SavePlacement(context.Background(), storage.Placement{ID: "home_banner", App: "com.example.app", Formats: []string{"billboard"}})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = svc.SavePlacement(context.Background(), storage.Placement{ID: "home_banner", App: "com.example.app", Size: "320"})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = svc.SavePlacement(context.Background(), storage.Placement{ID: "home banner", App: "com.example.app"})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = svc.SavePlacement(context.Background(), storage.Placement{ID: "home_banner"})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	_, err = NewAdminService(newAdminStore(map[string]storage.Campaign{})).SavePlacement(context.Background(), storage.Placement{ID: "home_banner", App: "com.example.app"})
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+}
+
+// delete placement - failed while a campaign includes it
+func TestDeletePlacement1(t *testing.T) {
+	campaigns := map[string]storage.Campaign{"spotify": {ID: "spotify", Placements: &storage.PlacementTargeting{Include: []string{"home_banner"}}}}
+	placements := map[string]storage.Placement{"home_banner": {ID: "home_banner", App: "com.example.app"}}
+	svc := NewAdminService(newPlacementAdminStore(campaigns, placements))
+
+	err := svc.DeletePlacement(context.Background(), "home_banner")
+	assert.IsType(t, &local_error.ErrPlacementInUse{}, err)
+
+	delete(campaigns, "spotify")
+	assert.NoError(t, svc.DeletePlacement(context.Background(), "home_banner"))
+	assert.IsType(t, &local_error.ErrPlacementNotFound{}, svc.DeletePlacement(context.Background(), "home_banner"))
+}
+
+// create campaign - typed creatives are validated and stand in for the image
+func TestCreateCampaign8(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{}))
+
+	campaign := CampaignDetails{ID: "spotify", Cta: "Download", IsActive: true, Countries: []string{"us"}, Creative: &storage.Creative{
+		Video: &storage.Video{URL: "https://video/spotify.mp4", MimeType: "video/mp4", Duration: 30},
+	}}
+	created, err := svc.CreateCampaign(context.Background(), campaign)
+	assert.NoError(t, err)
+	assert.Equal(t, campaign.Creative, created.Creative)
+
+	campaign.ID, campaign.Creative.Video.Duration = "duolingo", 0
+	_, err = svc.CreateCampaign(context.Background(), campaign)
+	assert.EqualError(t, err, "invalid payload: creative video duration must be positive")
+}
+
+// create campaign - localizations need BCP 47 language tags and http(s) images
+func TestCreateCampaign9(t *testing.T) {
+	svc := NewAdminService(newAdminStore(map[string]storage.Campaign{}))
+
+	campaign := CampaignDetails{ID: "spotify", Image: "https://img/spotify.png", Cta: "Download", IsActive: true, Countries: []string{"us"},
+		Localized: map[string]storage.Localization{"pt": {Cta: "Baixar"}, "pt-BR": {Image: "https://img/spotify-br.png"}}}
+	created, err := svc.CreateCampaign(context.Background(), campaign)
+	assert.NoError(t, err)
+	assert.Equal(t, campaign.Localized, created.Localized)
+
+	campaign.ID, campaign.Localized = "duolingo", map[string]storage.Localization{"pt_BR": {Cta: "Baixar"}}
+	_, err = svc.CreateCampaign(context.Background(), campaign)
+	assert.EqualError(t, err, "invalid payload: localized language must be a BCP 47 tag, like pt or pt-BR: pt_BR")
+
+	campaign.Localized = map[string]storage.Localization{"pt": {Image: "spotify-br.png"}}
+	_, err = svc.CreateCampaign(context.Background(), campaign)
+	assert.IsType(t, &local_error.ErrInvalidPayload{}, err)
+
+	campaign.Localized = nil
+	campaign.Variants = []storage.Variant{{ID: "only", Image: "https://img/v.png", Cta: "Play", Percent: 100, Localized: map[string]storage.Localization{"PT": {}, "pt": {}}}}
+	_, err = svc.CreateCampaign(context.Background(), campaign)
+	assert.EqualError(t, err, "invalid payload: variant only duplicate localized language: pt")
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	local_error "delivery-service/errors"
+	"delivery-service/placement"
+	"delivery-service/storage"
+	"delivery-service/utils"
+
+	"github.com/go-kit/log/level"
+)
+
+// errNoPlacements rejects placement operations on stores without placements
+var errNoPlacements = &local_error.ErrInvalidPayload{Reason: "the campaign store does not keep placements"}
+
+// ListPlacements returns every placement
+func (s *adminService) ListPlacements(ctx context.Context) ([]storage.Placement, error) {
+	if s.placements == nil {
+		return nil, errNoPlacements
+	}
+
+	placements, err := s.placements.ListPlacements(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "ListPlacements", "msg", "listing placements failed", "err", err)
+		return nil, err
+	}
+	return placements, nil
+}
+
+// SavePlacement validates and creates or replaces a placement
+func (s *adminService) SavePlacement(ctx context.Context, p storage.Placement) (storage.Placement, error) {
+	if s.placements == nil {
+		return storage.Placement{}, errNoPlacements
+	}
+	if !campaignIDPattern.MatchString(p.ID) {
+		return storage.Placement{}, &local_error.ErrInvalidPayload{Reason: "placement id must be made of letters, digits, '_', '.' or '-'", Method: "PUT"}
+	}
+	if p.App == "" {
+		return storage.Placement{}, &local_error.ErrInvalidPayload{Reason: "placement needs an app", Method: "PUT"}
+	}
+	if err := placement.Validate(p.Formats, p.Size); err != nil {
+		return storage.Placement{}, &local_error.ErrInvalidPayload{Reason: err.Error(), Method: "PUT"}
+	}
+	if p.MaxCampaigns < 0 {
+		return storage.Placement{}, &local_error.ErrInvalidPayload{Reason: "maxCampaigns must not be negative", Method: "PUT"}
+	}
+
+	if err := s.placements.SavePlacement(ctx, p); err != nil {
+		level.Error(logger).Log("method", "SavePlacement", "msg", "saving placement failed", "placement", p.ID, "err", err)
+		return storage.Placement{}, err
+	}
+
+	level.Info(logger).Log("method", "SavePlacement", "msg", "placement saved", "placement", p.ID, "app", p.App)
+	return p, nil
+}
+
+// DeletePlacement removes a placement no campaign includes
+func (s *adminService) DeletePlacement(ctx context.Context, id string) error {
+	if s.placements == nil {
+		return errNoPlacements
+	}
+
+	campaigns, err := s.store.FindCampaigns(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "DeletePlacement", "msg", "listing campaigns failed", "err", err)
+		return err
+	}
+	for _, campaign := range campaigns {
+		if campaign.Placements != nil && utils.ContainsFold(campaign.Placements.Include, id) {
+			return &local_error.ErrPlacementInUse{ID: id, Campaign: campaign.ID, Method: "DELETE"}
+		}
+	}
+
+	err = s.placements.DeletePlacement(ctx, id)
+	if errors.Is(err, storage.ErrPlacementNotFound) {
+		return &local_error.ErrPlacementNotFound{ID: id, Method: "DELETE"}
+	}
+	if err != nil {
+		level.Error(logger).Log("method", "DeletePlacement", "msg", "deleting placement failed", "placement", id, "err", err)
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"delivery-service/dimensions"
+	local_error "delivery-service/errors"
+	"delivery-service/expression"
+	"delivery-service/segment"
+	"delivery-service/storage"
+
+	"github.com/go-kit/log/level"
+)
+
+// SegmentUpload is the outcome of a segment upload
+type SegmentUpload struct {
+	Segment storage.Segment `json:"segment"`
+	// Skipped is the number of uploaded values that are not of the segment dimension
+	Skipped int `json:"skipped"`
+}
+
+// errNoSegments rejects segment operations on stores without segments
+var errNoSegments = &local_error.ErrInvalidPayload{Reason: "the campaign store does not keep segments"}
+
+// ListSegments returns every segment without its members
+func (s *adminService) ListSegments(ctx context.Context) ([]storage.Segment, error) {
+	if s.segments == nil {
+		return nil, errNoSegments
+	}
+
+	segments, err := s.segments.ListSegments(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "ListSegments", "msg", "listing segments failed", "err", err)
+		return nil, err
+	}
+	return segments, nil
+}
+
+// UploadSegment creates or replaces the segment name with the values of members, one
+// per line. Values of dimension are normalized like request values and skipped when
+// they are not of the dimension type, user_id values are compared case-insensitively.
+func (s *adminService) UploadSegment(ctx context.Context, name, dimension string, members io.Reader) (SegmentUpload, error) {
+	if s.segments == nil {
+		return SegmentUpload{}, errNoSegments
+	}
+	if !campaignIDPattern.MatchString(name) {
+		return SegmentUpload{}, &local_error.ErrInvalidPayload{Reason: "segment name must be made of letters, digits, '_', '.' or '-'", Method: "PUT"}
+	}
+
+	normalize, err := s.segmentNormalizer(ctx, dimension)
+	if err != nil {
+		return SegmentUpload{}, err
+	}
+
+	set, skipped, err := segment.Read(members, normalize)
+	if err != nil {
+		return SegmentUpload{}, &local_error.ErrInvalidPayload{Reason: err.Error(), Method: "PUT"}
+	}
+
+	upload := SegmentUpload{
+		Segment: storage.Segment{Name: name, Dimension: dimension, Size: len(set), UpdatedAt: time.Now().UTC()},
+		Skipped: skipped,
+	}
+	if err := s.segments.SaveSegment(ctx, upload.Segment, set); err != nil {
+		level.Error(logger).Log("method", "UploadSegment", "msg", "saving segment failed", "segment", name, "err", err)
+		return SegmentUpload{}, err
+	}
+
+	level.Info(logger).Log("method", "UploadSegment", "msg", "segment saved", "segment", name, "dimension", dimension, "members", len(set), "skipped", skipped)
+	return upload, nil
+}
+
+// DeleteSegment removes a segment no campaign targets
+func (s *adminService) DeleteSegment(ctx context.Context, name string) error {
+	if s.segments == nil {
+		return errNoSegments
+	}
+
+	campaigns, err := s.store.FindCampaigns(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "DeleteSegment", "msg", "listing campaigns failed", "err", err)
+		return err
+	}
+	for _, campaign := range campaigns {
+		for _, reference := range segmentReferences(toDetails(campaign)) {
+			if reference.Segment == name {
+				return &local_error.ErrSegmentInUse{Name: name, Campaign: campaign.ID, Method: "DELETE"}
+			}
+		}
+	}
+
+	err = s.segments.DeleteSegment(ctx, name)
+	if errors.Is(err, storage.ErrSegmentNotFound) {
+		return &local_error.ErrSegmentNotFound{Name: name, Method: "DELETE"}
+	}
+	if err != nil {
+		level.Error(logger).Log("method", "DeleteSegment", "msg", "deleting segment failed", "segment", name, "err", err)
+	}
+	return err
+}
+
+// segmentNormalizer returns the normalization of the uploaded values of dimension
+func (s *adminService) segmentNormalizer(ctx context.Context, dimension string) (func(string) (string, error), error) {
+	if dimension == dimensions.UserID {
+		return func(value string) (string, error) { return segment.NormalizeUserID(value), nil }, nil
+	}
+
+	parameters, err := s.store.GetParameters(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "UploadSegment", "msg", "loading rule parameters failed", "err", err)
+		return nil, err
+	}
+	d, ok := dimensions.New(parameters).Get(dimension)
+	if !ok {
+		return nil, &local_error.ErrInvalidPayload{Reason: "segment dimension must be user_id or a rules_parameters dimension: " + dimension, Method: "PUT"}
+	}
+
+	return func(value string) (string, error) {
+		if reason := d.Check(value); reason != "" {
+			return "", errors.New(reason)
+		}
+		return d.Normalize(value)
+	}, nil
+}
+
+// checkSegments checks that the segments a campaign targets exist and that its
+// expression compares them with their dimension
+func (s *adminService) checkSegments(ctx context.Context, details CampaignDetails) error {
+	references := segmentReferences(details)
+	if len(references) == 0 {
+		return nil
+	}
+	if s.segments == nil {
+		return errNoSegments
+	}
+
+	segments, err := s.segments.ListSegments(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "validate", "msg", "listing segments failed", "err", err)
+		return err
+	}
+	known := make(map[string]string, len(segments))
+	for _, segment := range segments {
+		known[segment.Name] = segment.Dimension
+	}
+
+	for _, reference := range references {
+		dimension, ok := known[reference.Segment]
+		if !ok {
+			return &local_error.ErrInvalidPayload{Reason: "unknown segment: " + reference.Segment}
+		}
+		if reference.Dimension != "" && reference.Dimension != dimension {
+			return &local_error.ErrInvalidPayload{Reason: "segment " + reference.Segment + " lists " + dimension + " values, not " + reference.Dimension}
+		}
+	}
+	return nil
+}
+
+// segmentReferences returns the segments of the segment targeting of a campaign, without
+// dimension, and those its expression compares dimensions with
+func segmentReferences(details CampaignDetails) []expression.Reference {
+	var references []expression.Reference
+	if details.Segments != nil {
+		for _, name := range details.Segments.Include {
+			references = append(references, expression.Reference{Segment: name})
+		}
+		for _, name := range details.Segments.Exclude {
+			references = append(references, expression.Reference{Segment: name})
+		}
+	}
+	if details.Expression != "" {
+		if expr, err := expression.Parse(details.Expression); err == nil {
+			references = append(references, expr.SegmentReferences()...)
+		}
+	}
+	return references
+}
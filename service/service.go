@@ -2,15 +2,31 @@ package service
 
 import (
 	"context"
+	"errors"
+	"math"
 	"os"
-
+	"strings"
+	"time"
+
+	"delivery-service/budget"
+	"delivery-service/creative"
+	"delivery-service/cursor"
+	"delivery-service/dimensions"
+	"delivery-service/engine"
 	local_error "delivery-service/errors"
-	"delivery-service/storage/mongodb"
+	"delivery-service/experiment"
+	"delivery-service/frequency"
+	"delivery-service/geo"
+	"delivery-service/locale"
+	"delivery-service/metrics"
+	"delivery-service/placement"
+	"delivery-service/ranking"
+	"delivery-service/storage"
 	"delivery-service/utils"
+	"delivery-service/validation"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 // Campaign represents a campaign entity
@@ -18,20 +34,97 @@ type Campaign struct {
 	Cid string `json:"cid" bson:"_id"`
 	Img string `json:"img" bson:"image"`
 	Cta string `json:"cta" bson:"cta"`
+	// Vid is the creative variant of the campaign shown to the user, empty without variants
+	Vid string `json:"vid,omitempty" bson:"vid,omitempty"`
+	// Creative holds the typed assets picked for the request, nil when the campaign has none
+	Creative *Creative `json:"creative,omitempty" bson:"creative,omitempty"`
+}
+
+// Creative is the typed creative of a campaign with the image and the texts picked for
+// the screen and the language of a request
+type Creative struct {
+	Image       *storage.Image `json:"image,omitempty" bson:"image,omitempty"`
+	Video       *storage.Video `json:"video,omitempty" bson:"video,omitempty"`
+	HTML        string         `json:"html,omitempty" bson:"html,omitempty"`
+	Title       string         `json:"title,omitempty" bson:"title,omitempty"`
+	Description string         `json:"description,omitempty" bson:"description,omitempty"`
+	// Lang is the language tag of the texts, empty when none matched the request
+	Lang     string            `json:"lang,omitempty" bson:"lang,omitempty"`
+	Tracking *storage.Tracking `json:"tracking,omitempty" bson:"tracking,omitempty"`
+}
+
+// display holds the screen and the languages a request declares for creative selection
+type display struct {
+	screen creative.Screen
+	// sized is set when the request declares a screen size
+	sized bool
+	// languages are the lang parameter, or else the accepted languages, most preferred first
+	languages []string
+}
+
+// requestPlacement is the placement parameter of a request
+type requestPlacement struct {
+	id string
+	// placement is the definition of the placement, nil when it has none
+	placement *storage.Placement
 }
 
-type Parameters struct {
-	Rules []string `bson:"rules"`
+// Page selects a page of Limit campaigns: the page after Cursor when it is set, the page
+// at Offset otherwise
+type Page struct {
+	Limit  int
+	Offset int
+	// Cursor is the next cursor of a previous page
+	Cursor string
 }
 
+// BatchPlacement is a placement of a batch request, like an interstitial or a banner,
+// with the number of campaigns it shows
+type BatchPlacement struct {
+	ID    string
+	Limit int
+}
+
+const (
+	// ModeEngine answers requests from the in-memory targeting engine
+	ModeEngine = "engine"
+	// ModeAggregation answers requests with a store query per request
+	ModeAggregation = "aggregation"
+
+	// RulesCheckLog logs the campaigns with invalid rules
+	RulesCheckLog = "log"
+	// RulesCheckRefuse logs the campaigns with invalid rules and does not deliver them
+	RulesCheckRefuse = "refuse"
+	// RulesCheckOff disables the rules check
+	RulesCheckOff = "off"
+)
+
+var (
+	deliveryMode = ModeEngine
+	rulesCheck   = RulesCheckLog
+)
+
 // Service defines the behavior of our campaign service
 type Service interface {
-	GetCampaigns(ctx context.Context, params map[string]string, limit, offset int) ([]Campaign, error)
+	GetCampaigns(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]Campaign, error)
+	GetCampaignsPage(ctx context.Context, params map[string]string, userID string, page Page) ([]Campaign, string, error)
+	GetCampaignsBatch(ctx context.Context, params map[string]string, userID string, placements []BatchPlacement, allowDuplicates bool) ([][]Campaign, error)
+	RecordImpression(ctx context.Context, campaignID, userID string) (bool, error)
+}
+
+// Watcher is implemented by services caching campaigns that need to follow store changes
+type Watcher interface {
+	Watch(ctx context.Context)
 }
 
 // campaignService is the implementation of the Service interface
 type campaignService struct {
-	db mongodb.IMongoDb
+	store   storage.CampaignStore
+	engine  *engine.Engine
+	counter frequency.Counter
+	ledger  budget.Ledger
+	// placements caches the placements of the store, nil when it keeps none
+	placements *placement.Cache
 }
 
 var logger log.Logger
@@ -43,143 +136,591 @@ func init() {
 	// Set log level debug
 	logger = level.NewFilter(logger, level.AllowDebug())
 
+	if mode := os.Getenv("DELIVERY_MODE"); mode != "" {
+		deliveryMode = mode
+	}
+	if check := os.Getenv("RULES_CHECK"); check != "" {
+		rulesCheck = check
+	}
 }
 
-// NewService creates and returns a new Campaign Service
-func NewService() Service {
-	return &campaignService{
-		db: mongodb.MongoDB.GetDb("campaigns"),
+// NewService creates and returns a new Campaign Service reading campaigns from store.
+// Campaigns are served from the in-memory engine unless DELIVERY_MODE selects the
+// aggregation fallback, which queries the store on every request. Frequency caps are
+// enforced with the impressions of counter and budgets with the impressions of ledger,
+// they are ignored when counter or ledger is nil.
+func NewService(store storage.CampaignStore, counter frequency.Counter, ledger budget.Ledger) Service {
+	svc := &campaignService{
+		store:   store,
+		counter: counter,
+		ledger:  ledger,
+	}
+	if cached, ok := store.(placement.Cached); ok {
+		svc.placements = cached.PlacementCache()
+	} else if source, ok := store.(storage.PlacementSource); ok {
+		svc.placements = placement.NewCache(source)
+	}
+
+	switch deliveryMode {
+	case ModeAggregation:
+	case ModeEngine:
+		svc.engine = engine.New(store)
+	default:
+		level.Error(logger).Log("msg", "unknown DELIVERY_MODE, using engine", "mode", deliveryMode)
+		svc.engine = engine.New(store)
+	}
+
+	if svc.engine != nil && rulesCheck == RulesCheckRefuse {
+		svc.engine.SetCheck(func(registry *dimensions.Registry, campaign storage.Campaign) bool {
+			return len(validation.New(registry).ValidateCampaign(campaign)) == 0
+		})
 	}
+
+	level.Info(logger).Log("msg", "campaign service created", "mode", deliveryMode, "rulesCheck", rulesCheck, "frequencyCapping", counter != nil, "budgets", ledger != nil)
+	return svc
 }
 
-// GetCampaigns implements the business logic
-func (s *campaignService) GetCampaigns(ctx context.Context, params map[string]string, limit, offset int) ([]Campaign, error) {
+// SelfCheck validates the rules of the active campaigns of store and logs every issue found.
+// It does nothing when RULES_CHECK is off.
+func SelfCheck(ctx context.Context, store storage.CampaignStore) []validation.Issue {
+	if rulesCheck == RulesCheckOff {
+		return nil
+	}
 
-	var campaigns []Campaign
-	var parameters Parameters
-	var coll mongodb.IMongoCollection
+	parameters, err := store.GetParameters(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "SelfCheck", "msg", "loading rule parameters failed", "err", err)
+		return nil
+	}
+
+	campaigns, err := store.ListCampaigns(ctx)
+	if err != nil {
+		level.Error(logger).Log("method", "SelfCheck", "msg", "loading campaigns failed", "err", err)
+		return nil
+	}
+
+	issues := validation.New(dimensions.New(parameters)).Validate(campaigns)
+	for _, issue := range issues {
+		level.Warn(logger).Log("method", "SelfCheck", "campaign", issue.CampaignID, "rule", issue.Rule, "value", issue.Value, "reason", issue.Reason, "action", rulesCheck)
+	}
+	level.Info(logger).Log("method", "SelfCheck", "msg", "campaign rules checked", "campaigns", len(campaigns), "issues", len(issues))
+	return issues
+}
+
+// Watch keeps the engine campaign cache in sync with the store until ctx is cancelled.
+// It returns immediately in aggregation mode or when the store cannot be watched.
+func (s *campaignService) Watch(ctx context.Context) {
+	if s.engine == nil {
+		return
+	}
+
+	watcher, ok := s.store.(storage.Watcher)
+	if !ok {
+		level.Info(logger).Log("method", "Watch", "msg", "store does not support watching, campaigns are loaded once")
+		return
+	}
+	watcher.Watch(ctx, s.engine)
+}
+
+// GetCampaigns implements the business logic, userID is a stable user or device id
+// seeding the order of the campaigns of a priority tier and the creative variants,
+// empty for id order and random variants
+func (s *campaignService) GetCampaigns(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]Campaign, error) {
+	campaigns, _, err := s.GetCampaignsPage(ctx, params, userID, Page{Limit: limit, Offset: offset})
+	return campaigns, err
+}
+
+// GetCampaignsPage returns the campaigns of page like GetCampaigns, with the cursor of
+// the next page, empty on the last page. A cursor resumes after the position of the last
+// campaign of its page, which does not depend on the other campaigns, so that campaigns
+// starting or ending between two pages neither shift nor repeat the following ones.
+func (s *campaignService) GetCampaignsPage(ctx context.Context, params map[string]string, userID string, page Page) ([]Campaign, string, error) {
+	var after cursor.Cursor
 	var err error
 
-	coll = s.db.GetCollection("rules_parameters")
-	result, err := coll.FindOne(ctx, bson.M{"_id": "current"})
+	if page.Cursor != "" {
+		if after, err = cursor.Decode(page.Cursor); err != nil {
+			return nil, "", &local_error.ErrInvalidParams{Param: "cursor", Reason: err.Error()}
+		}
+	}
+
+	params, slot, err := s.requestPlacement(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+	params, view, err := requestDisplay(ctx, params, "GET")
+	if err != nil {
+		return nil, "", err
+	}
+
+	matched, version, err := s.deliverable(ctx, params, userID, view.languages)
+	if err != nil {
+		return nil, "", err
+	}
+	matched = fitting(matched, slot)
+	if slot.placement != nil && slot.placement.MaxCampaigns > 0 {
+		page.Limit = min(page.Limit, slot.placement.MaxCampaigns)
+	}
+	if page.Limit <= 0 {
+		return nil, "", nil
+	}
+
+	position := func(c storage.Campaign) ranking.Position { return ranking.PositionOf(c, userID) }
+	// rest holds the matches from the first campaign of the page on
+	var rest []storage.Campaign
+	if page.Cursor != "" {
+		if after.Version != version {
+			level.Debug(logger).Log("method", "GetCampaigns", "msg", "campaigns changed since the cursor, resuming after its position", "cursor", after.Version, "current", version)
+			metrics.StaleCursorCount.Add(1)
+		}
+		rest = cursor.After(matched, after, position)
+	} else if page.Offset >= 0 && page.Offset <= len(matched)/page.Limit && page.Limit*page.Offset < len(matched) {
+		// the offset is bounded first so that the product does not overflow
+		rest = matched[page.Limit*page.Offset:]
+	}
 
+	next := ""
+	if len(rest) > page.Limit {
+		rest = rest[:page.Limit]
+		next = cursor.Encode(cursor.Cursor{After: position(rest[len(rest)-1]), Version: version})
+	}
+	return creatives(rest, userID, view, slot), next, nil
+}
+
+// GetCampaignsBatch returns the campaigns of several placements of a request, looked up
+// once. The placements are filled in order with the best ranked campaigns left that fit
+// them, so that a campaign is only returned in one placement, unless allowDuplicates is
+// set and every placement gets the best ranked campaigns fitting it. Placements must be
+// defined, like the placement parameter of GetCampaigns.
+func (s *campaignService) GetCampaignsBatch(ctx context.Context, params map[string]string, userID string, placements []BatchPlacement, allowDuplicates bool) ([][]Campaign, error) {
+	if len(placements) == 0 {
+		return nil, &local_error.ErrMissingParams{Param: "placements", Method: "POST"}
+	}
+	seen := make(map[string]struct{}, len(placements))
+	for _, placement := range placements {
+		if placement.ID == "" {
+			return nil, &local_error.ErrMissingParams{Param: "placements.id", Method: "POST"}
+		}
+		if _, ok := seen[placement.ID]; ok {
+			return nil, &local_error.ErrInvalidParams{Param: "placements", Reason: "duplicate placement " + placement.ID, Method: "POST"}
+		}
+		if placement.Limit <= 0 {
+			return nil, &local_error.ErrInvalidParams{Param: "placements", Reason: "limit of placement " + placement.ID + " must be positive", Method: "POST"}
+		}
+		seen[placement.ID] = struct{}{}
+	}
+
+	params, view, err := requestDisplay(ctx, params, "POST")
 	if err != nil {
-		level.Error(logger).Log("method", "GetCampaigns", "msg", "mongodb findOne failed", "err", err)
 		return nil, err
 	}
 
-	if err = result.Decode(&parameters); err != nil {
-		level.Error(logger).Log("method", "GetCampaigns", "msg", "error decoding doc", "err", err)
+	slots := make([]requestPlacement, 0, len(placements))
+	for _, placement := range placements {
+		definition, err := s.placement(ctx, placement.ID, params["app"], "POST")
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, requestPlacement{id: placement.ID, placement: definition})
+	}
+
+	matched, _, err := s.deliverable(ctx, params, userID, view.languages)
+	if err != nil {
 		return nil, err
 	}
 
-	for param := range params {
-		if !utils.Contains(parameters.Rules, param) {
-			return nil, &local_error.ErrUnknownParams{Param: param}
+	used := make(map[string]struct{})
+	batch := make([][]Campaign, 0, len(placements))
+	for i, placement := range placements {
+		limit := placement.Limit
+		if slot := slots[i].placement; slot != nil && slot.MaxCampaigns > 0 {
+			limit = min(limit, slot.MaxCampaigns)
+		}
+
+		var page []storage.Campaign
+		for _, campaign := range fitting(matched, slots[i]) {
+			if len(page) == limit {
+				break
+			}
+			if _, ok := used[campaign.ID]; ok {
+				continue
+			}
+			page = append(page, campaign)
+			if !allowDuplicates {
+				used[campaign.ID] = struct{}{}
+			}
 		}
+		batch = append(batch, creatives(page, userID, view, slots[i]))
 	}
+	return batch, nil
+}
 
-	coll = s.db.GetCollection(params["country"])
-	filter := getCampaignsFilter(params, limit, offset)
-	cursor, err := coll.Aggregate(ctx, filter)
+// requestPlacement returns params without the placement parameter and the placement it
+// names, which must be defined for the app of the request
+func (s *campaignService) requestPlacement(ctx context.Context, params map[string]string) (map[string]string, requestPlacement, error) {
+	id, ok := params["placement"]
+	if !ok {
+		return params, requestPlacement{}, nil
+	}
 
+	rest := make(map[string]string, len(params)-1)
+	for name, value := range params {
+		if name != "placement" {
+			rest[name] = value
+		}
+	}
+	definition, err := s.placement(ctx, id, params["app"], "GET")
 	if err != nil {
-		level.Error(logger).Log("method", "GetCampaigns", "msg", "mongodb aggregate failed", "err", err)
-		return nil, err
+		return nil, requestPlacement{}, err
+	}
+	return rest, requestPlacement{id: id, placement: definition}, nil
+}
+
+// localize overrides the img and the cta of campaign with the localization best matching
+// the languages of the request, each falling back along the language chain
+func (view display) localize(campaign *Campaign, localized map[string]storage.Localization) {
+	image, cta := "", ""
+	for _, localization := range locale.Chain(localized, view.languages) {
+		if image == "" {
+			image = localization.Image
+		}
+		if cta == "" {
+			cta = localization.Cta
+		}
+	}
+	if image != "" {
+		campaign.Img = image
+	}
+	if cta != "" {
+		campaign.Cta = cta
+	}
+}
+
+// requestDisplay returns params without the screen, density and lang parameters and the
+// display they declare. Requests without lang get the languages of their Accept-Language.
+func requestDisplay(ctx context.Context, params map[string]string, method string) (map[string]string, display, error) {
+	view := display{screen: creative.Screen{Density: 1}}
+	var err error
+
+	if size, ok := params["screen"]; ok {
+		if view.screen.Width, view.screen.Height, err = placement.ParseSize(size); err != nil {
+			return nil, display{}, &local_error.ErrInvalidParams{Param: "screen", Reason: err.Error(), Method: method}
+		}
+		view.sized = true
+	}
+	if density, ok := params["density"]; ok {
+		if view.screen.Density, err = creative.ParseDensity(density); err != nil {
+			return nil, display{}, &local_error.ErrInvalidParams{Param: "density", Reason: err.Error(), Method: method}
+		}
+	}
+	if lang, ok := params["lang"]; ok {
+		if !locale.IsTag(lang) {
+			return nil, display{}, &local_error.ErrInvalidParams{Param: "lang", Reason: "not a BCP 47 language tag, like en or pt-BR", Method: method}
+		}
+		view.languages = []string{lang}
+	} else {
+		view.languages = locale.FromContext(ctx)
+	}
+
+	rest := make(map[string]string, len(params))
+	for name, value := range params {
+		if name != "screen" && name != "density" && name != "lang" {
+			rest[name] = value
+		}
 	}
+	return rest, view, nil
+}
 
-	if err = cursor.All(context.TODO(), &campaigns); err != nil {
-		level.Error(logger).Log("method", "GetCampaigns", err, "error decoding cursor")
+// placement returns the definition of the placement id, an ErrInvalidParams when it is
+// not defined or not a placement of app
+func (s *campaignService) placement(ctx context.Context, id, app, method string) (*storage.Placement, error) {
+	if s.placements == nil {
+		return nil, &local_error.ErrInvalidParams{Param: "placement", Reason: "unknown placement " + id, Method: method}
+	}
+
+	placement, ok, err := s.placements.Get(ctx, id)
+	if err != nil {
 		return nil, err
 	}
+	if !ok {
+		return nil, &local_error.ErrInvalidParams{Param: "placement", Reason: "unknown placement " + id, Method: method}
+	}
+	if app != "" && !strings.EqualFold(placement.App, app) {
+		return nil, &local_error.ErrInvalidParams{Param: "placement", Reason: "placement " + id + " belongs to app " + placement.App, Method: method}
+	}
+	return &placement, nil
+}
 
-	return campaigns, nil
-}
-
-func getCampaignsFilter(parameters map[string]string, limit, offset int) bson.A {
-
-	var pipeline bson.A
-
-	pipeline = append(pipeline, bson.M{
-		"$sort": bson.M{
-			"_id": 1,
-		},
-	})
-
-	pipeline = append(pipeline, bson.M{
-		"$lookup": bson.M{
-			"from":         "campaigns_details",
-			"localField":   "_id",
-			"foreignField": "_id",
-			"as":           "result",
-		},
-	})
-
-	pipeline = append(pipeline, bson.M{
-		"$match": bson.M{
-			"result.isActive": true,
-		},
-	})
-
-	pipeline = append(pipeline, bson.M{
-		"$unwind": bson.M{
-			"path":                       "$result",
-			"preserveNullAndEmptyArrays": false,
-		},
-	})
-
-	for param, paramValue := range parameters {
-		includeParam := "result.rules.include" + param
-		excludeParam := "result.rules.exclude" + param
-
-		pipeline = append(pipeline, bson.M{
-			"$match": bson.M{
-				"$and": bson.A{
-					bson.M{
-						"$or": bson.A{
-							bson.M{
-								includeParam: nil,
-							},
-							bson.M{
-								includeParam: bson.M{
-									"$in": bson.A{paramValue},
-								},
-							},
-						},
-					},
-					bson.M{
-						"$or": bson.A{
-							bson.M{
-								excludeParam: nil,
-							},
-							bson.M{
-								excludeParam: bson.M{
-									"$not": bson.M{
-										"$in": bson.A{paramValue},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		})
+// fitting returns the campaigns that may be shown in the placement of a request
+func fitting(campaigns []storage.Campaign, slot requestPlacement) []storage.Campaign {
+	fit := make([]storage.Campaign, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		if placement.Fits(campaign, slot.id, slot.placement) {
+			fit = append(fit, campaign)
+		}
 	}
+	return fit
+}
 
-	pipeline = append(pipeline, bson.M{
-		"$limit": limit,
-	})
+// deliverable returns the campaigns matching params and the request languages that can
+// be delivered to userID, ranked, with the version of the matches for the cursors
+func (s *campaignService) deliverable(ctx context.Context, params map[string]string, userID string, languages []string) ([]storage.Campaign, string, error) {
 
-	pipeline = append(pipeline, bson.M{
-		"$skip": limit * offset,
-	})
+	var registry *dimensions.Registry
+	var matched []storage.Campaign
+	var err error
 
-	pipeline = append(pipeline, bson.M{
-		"$project": bson.M{
-			"image": "$result.image",
-			"cta":   "$result.cta",
-		},
-	})
+	if s.engine != nil {
+		registry, err = s.engine.Dimensions(ctx)
+	} else {
+		var parameters []storage.Dimension
+		if parameters, err = s.store.GetParameters(ctx); err == nil {
+			registry = dimensions.New(parameters)
+		}
+	}
 
-	return pipeline
+	if err != nil {
+		level.Error(logger).Log("method", "GetCampaigns", "msg", "loading rule parameters failed", "err", err)
+		return nil, "", err
+	}
+
+	params, err = normalizeParams(registry, withLanguage(registry, locate(ctx, registry, params), languages))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// every match is looked up, for the version of the cursors and since capped and
+	// exhausted campaigns are dropped before paginating
+	if s.engine != nil {
+		matched, err = s.engine.GetCampaigns(ctx, params, userID, math.MaxInt, 0)
+	} else {
+		matched, err = s.store.QueryCampaigns(ctx, params, userID, math.MaxInt, 0)
+	}
+
+	if err != nil {
+		level.Error(logger).Log("method", "GetCampaigns", "msg", "campaign lookup failed", "err", err)
+		return nil, "", err
+	}
+
+	version := cursor.Version(matched)
+	now := time.Now()
+	if s.counter != nil && userID != "" {
+		matched = s.uncapped(ctx, userID, matched, now)
+	}
+	if s.ledger != nil {
+		matched = s.withinBudget(ctx, matched, userID, now)
+	}
+	return matched, version, nil
+}
+
+// creatives returns the creatives of campaigns delivered to userID in slot, those of its
+// variant for the campaigns running an experiment. Variants replace the image and the cta.
+func creatives(matched []storage.Campaign, userID string, view display, slot requestPlacement) []Campaign {
+	campaigns := make([]Campaign, 0, len(matched))
+	for _, c := range matched {
+		campaign := Campaign{Cid: c.ID, Img: c.Image, Cta: c.Cta}
+		if c.Creative != nil {
+			campaign.Creative = view.creative(&campaign, c.Creative, slot)
+		}
+		view.localize(&campaign, c.Localized)
+		if variant, ok := experiment.Assign(c, userID); ok {
+			campaign.Img, campaign.Cta, campaign.Vid = variant.Image, variant.Cta, variant.ID
+			if campaign.Creative != nil {
+				campaign.Creative.Image = nil
+			}
+			view.localize(&campaign, variant.Localized)
+			metrics.VariantDeliveryCount.With("campaign", c.ID, "variant", variant.ID).Add(1)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns
+}
+
+// creative picks the image and the texts of c for the request and sets them as the img and
+// the cta of campaign. The image fits the size of the placement, or else of the screen; it
+// only replaces the campaign image when the request declares one of them, for the clients
+// that do not.
+func (view display) creative(campaign *Campaign, c *storage.Creative, slot requestPlacement) *Creative {
+	picked := &Creative{Video: c.Video, HTML: c.HTML, Tracking: c.Tracking}
+
+	width := 0
+	if view.sized {
+		width = view.screen.Width
+	}
+	if slot.placement != nil && slot.placement.Size != "" {
+		width, _, _ = placement.ParseSize(slot.placement.Size)
+	}
+	if image, ok := creative.Image(c.Images, view.screen.Pixels(width)); ok {
+		picked.Image = &image
+		if width > 0 || campaign.Img == "" {
+			campaign.Img = image.URL
+		}
+	}
+
+	if text, tag, ok := creative.Text(c.Texts, view.languages); ok {
+		picked.Title, picked.Description, picked.Lang = text.Title, text.Description, tag
+		if text.Cta != "" {
+			campaign.Cta = text.Cta
+		}
+	}
+	return picked
+}
+
+// RecordImpression counts an impression of an active campaign for userID, a stable user
+// or device id, against its frequency cap and its budget. It reports whether the impression
+// was counted, which it is not when the campaign has neither or they are off.
+func (s *campaignService) RecordImpression(ctx context.Context, campaignID, userID string) (bool, error) {
+	if userID == "" {
+		return false, &local_error.ErrMissingParams{Param: "user_id", Method: "POST"}
+	}
+
+	var campaign storage.Campaign
+	var err error
+	found := true
+
+	if s.engine != nil {
+		campaign, found, err = s.engine.Campaign(ctx, campaignID)
+	} else {
+		campaign, err = s.store.ActiveCampaign(ctx, campaignID)
+		if errors.Is(err, storage.ErrCampaignNotFound) {
+			found, err = false, nil
+		}
+	}
+
+	if err != nil {
+		level.Error(logger).Log("method", "RecordImpression", "msg", "campaign lookup failed", "id", campaignID, "err", err)
+		return false, err
+	}
+	if !found {
+		return false, &local_error.ErrCampaignNotFound{ID: campaignID, Method: "POST"}
+	}
+
+	now := time.Now()
+	recorded := false
+
+	if s.ledger != nil && campaign.Budget != nil {
+		if err := s.ledger.Record(ctx, campaignID, budget.Day(campaign, now)); err != nil {
+			level.Error(logger).Log("method", "RecordImpression", "msg", "recording delivered impression failed", "id", campaignID, "err", err)
+			return false, err
+		}
+		recorded = true
+	}
+
+	if s.counter == nil || campaign.FrequencyCap == nil {
+		return recorded, nil
+	}
+
+	window, err := frequency.Window(campaign.FrequencyCap)
+	if err != nil {
+		level.Warn(logger).Log("method", "RecordImpression", "msg", "invalid frequency cap", "id", campaignID, "err", err)
+		return recorded, nil
+	}
+
+	if err := s.counter.Record(ctx, userID, campaignID, window, now); err != nil {
+		level.Error(logger).Log("method", "RecordImpression", "msg", "recording impression failed", "id", campaignID, "err", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// uncapped returns the campaigns whose frequency cap userID has not reached. Campaigns
+// are not capped when the counters cannot be read, delivery goes on without capping.
+func (s *campaignService) uncapped(ctx context.Context, userID string, campaigns []storage.Campaign, now time.Time) []storage.Campaign {
+	capped, err := frequency.Capped(ctx, s.counter, userID, campaigns, now)
+	if err != nil {
+		level.Error(logger).Log("method", "GetCampaigns", "msg", "reading impression counters failed, campaigns are not capped", "err", err)
+		return campaigns
+	}
+	if len(capped) == 0 {
+		return campaigns
+	}
+
+	kept := make([]storage.Campaign, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		if _, ok := capped[campaign.ID]; !ok {
+			kept = append(kept, campaign)
+		}
+	}
+	return kept
+}
+
+// withinBudget returns the campaigns whose budget and pacing allow delivery to userID.
+// Campaigns are kept when the ledger cannot be read, delivery goes on without budgets.
+func (s *campaignService) withinBudget(ctx context.Context, campaigns []storage.Campaign, userID string, now time.Time) []storage.Campaign {
+	kept, err := budget.Filter(ctx, s.ledger, campaigns, userID, now)
+	if err != nil {
+		level.Error(logger).Log("method", "GetCampaigns", "msg", "reading delivered impressions failed, budgets are not applied", "err", err)
+		return campaigns
+	}
+	return kept
+}
+
+// locate returns params with the location inferred from the client ip (if any) for the
+// missing country. Region and city are added when registered and missing. Requests with
+// a country are returned as is, without a lookup.
+func locate(ctx context.Context, registry *dimensions.Registry, params map[string]string) map[string]string {
+	if _, ok := params["country"]; ok {
+		return params
+	}
+	location, ok := geo.FromContext(ctx)
+	if !ok {
+		return params
+	}
+
+	located := make(map[string]string, len(params)+3)
+	for name, value := range params {
+		located[name] = value
+	}
+	located["country"] = location.Country
+
+	for name, value := range map[string]string{"region": location.Region, "city": location.City} {
+		if _, registered := registry.Get(name); registered && value != "" {
+			if _, ok := located[name]; !ok {
+				located[name] = value
+			}
+		}
+	}
+	return located
+}
+
+// withLanguage returns params with the most preferred of the request languages when lang
+// is a registered dimension, campaigns being targeted on it
+func withLanguage(registry *dimensions.Registry, params map[string]string, languages []string) map[string]string {
+	if _, registered := registry.Get("lang"); !registered || len(languages) == 0 {
+		return params
+	}
+
+	with := make(map[string]string, len(params)+1)
+	for name, value := range params {
+		with[name] = value
+	}
+	with["lang"] = languages[0]
+	return with
+}
+
+// normalizeParams checks the request parameters against the registered dimensions and
+// returns them in the normalized form the lookups compare
+func normalizeParams(registry *dimensions.Registry, params map[string]string) (map[string]string, error) {
+	for _, name := range utils.SortedKeys(params) {
+		if _, ok := registry.Get(name); !ok {
+			return nil, &local_error.ErrUnknownParams{Param: name}
+		}
+	}
+
+	for _, name := range registry.Required() {
+		if _, ok := params[name]; !ok {
+			return nil, &local_error.ErrMissingParams{Param: name}
+		}
+	}
+
+	normalized := make(map[string]string, len(params))
+	for name, value := range params {
+		dimension, _ := registry.Get(name)
+		value, err := dimension.Normalize(value)
+		if err != nil {
+			return nil, &local_error.ErrInvalidParams{Param: name, Reason: err.Error()}
+		}
+		normalized[name] = value
+	}
+	return normalized, nil
 }
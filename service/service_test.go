@@ -2,192 +2,590 @@ package service
 
 import (
 	"context"
+	"delivery-service/budget"
+	local_error "delivery-service/errors"
+	"delivery-service/frequency"
+	"delivery-service/locale"
 	"delivery-service/mocks"
-	"delivery-service/storage/mongodb"
+	"delivery-service/storage"
 	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var iMongoDb mongodb.IMongoDb
-var iMongoCollection mongodb.IMongoCollection
+var rulesParameters = func(ctx context.Context) ([]storage.Dimension, error) {
+	return storage.DimensionsFromNames([]string{"app", "country", "os"}), nil
+}
+
+var listCampaigns = func(ctx context.Context) ([]storage.Campaign, error) {
+	return []storage.Campaign{
+		{ID: "cid", Image: "image", Cta: "cta", IsActive: true, Countries: []string{"us"}},
+	}, nil
+}
 
-// get campaign from mongodb - success
+// get campaign from store - success
 func TestGetCampaigns1(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: listCampaigns,
+	}
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "us", "os": "c"}
+
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(campaigns))
+	assert.Equal(t, []Campaign{{Cid: "cid", Img: "image", Cta: "cta"}}, campaigns)
+}
 
-	mongodb.MongoDB = mocks.MongoMock{
-		GetDbMock: func(db_name string) mongodb.IMongoDb {
-			return iMongoDb
+// get campaign from store - failed because loading rule parameters returns some error
+func TestGetCampaigns2(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return nil, errors.New("some error")
 		},
 	}
-	iMongoDb = mocks.MongoDbMock{
-		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
-			return iMongoCollection
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "us", "os": "c"}
+
+	_, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.Error(t, err)
+}
+
+// get campaign from store - failed because listing campaigns returns some error
+func TestGetCampaigns3(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return nil, errors.New("some error")
 		},
 	}
-	iMongoCollection = mocks.MongoCollectionMock{
-		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
-			data := bson.M{
-				"rules": bson.A{"app", "country", "os"},
-			}
-			result := mongo.NewSingleResultFromDocument(data, nil, nil)
-			return result, nil
-		},
-		AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-			data := bson.A{
-				bson.M{
-					"_id":   "cid",
-					"image": "image",
-					"cta":   "cta",
-				},
-			}
-			cursor, _ := mongo.NewCursorFromDocuments(data, nil, nil)
-			return cursor, nil
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "us", "os": "c"}
+
+	_, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.Error(t, err)
+}
+
+// get campaign from store - failed because unknown rules parameters passed
+func TestGetCampaigns4(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+	}
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "us", "os": "c", "unknown": "unknown"}
+
+	_, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.IsType(t, &local_error.ErrUnknownParams{}, err)
+}
+
+// get campaign from store - success, accept new rule parameter state
+func TestGetCampaigns5(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os", "state"}), nil
 		},
+		ListCampaignsMock: listCampaigns,
 	}
 
-	svc := NewService()
+	svc := NewService(store, nil, nil)
 
-	params := map[string]string{"app": "a", "country": "b", "os": "c"}
+	params := map[string]string{"app": "a", "country": "us", "os": "c", "state": "d"}
 
-	campaigns, err := svc.GetCampaigns(context.Background(), params, 10, 0)
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(campaigns))
 	assert.Equal(t, []Campaign{{Cid: "cid", Img: "image", Cta: "cta"}}, campaigns)
 }
 
-// get campaign from mongodb - failed because mongo return some error
-func TestGetCampaigns2(t *testing.T) {
-	mongodb.MongoDB = mocks.MongoMock{
-		GetDbMock: func(db_name string) mongodb.IMongoDb {
-			return iMongoDb
+// get campaign from store - success, aggregation fallback mode queries the store
+func TestGetCampaigns6(t *testing.T) {
+	deliveryMode = ModeAggregation
+	defer func() { deliveryMode = ModeEngine }()
+
+	var queried map[string]string
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		QueryCampaignsMock: func(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]storage.Campaign, error) {
+			queried = params
+			return []storage.Campaign{{ID: "cid", Image: "image", Cta: "cta"}}, nil
 		},
 	}
-	iMongoDb = mocks.MongoDbMock{
-		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
-			return iMongoCollection
-		},
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "us", "os": "c"}
+
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "cid", Img: "image", Cta: "cta"}}, campaigns)
+	assert.Equal(t, params, queried)
+}
+
+// get campaign from store - campaigns of other countries are not returned
+func TestGetCampaigns7(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: listCampaigns,
 	}
-	iMongoCollection = mocks.MongoCollectionMock{
-		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
-			return nil, errors.New("some error")
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "de", "os": "c"}
+
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, campaigns)
+}
+
+// get campaign from store - required dimensions and value types come from the dimension registry
+func TestGetCampaigns8(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return []storage.Dimension{
+				{Name: "country", Type: storage.TypeGeo, Required: true},
+				{Name: "os", Type: storage.TypeEnum},
+				{Name: "os_version", Type: storage.TypeVersion},
+			}, nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "cid", Image: "image", Cta: "cta", IsActive: true, Countries: []string{"us"}, Rules: map[string][]string{"includeos": {"iOS"}, "includeos_version": {"14.2"}}},
+			}, nil
 		},
 	}
 
-	svc := NewService()
+	svc := NewService(store, nil, nil)
 
-	params := map[string]string{"app": "a", "country": "b", "os": "c"}
+	campaigns, err := svc.GetCampaigns(context.Background(), map[string]string{"country": "US", "os": "IOS", "os_version": "v14.2.0"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "cid", Img: "image", Cta: "cta"}}, campaigns)
 
-	_, err := svc.GetCampaigns(context.Background(), params, 10, 0)
-	assert.Error(t, err)
+	_, err = svc.GetCampaigns(context.Background(), map[string]string{"os": "ios"}, "", 10, 0)
+	assert.IsType(t, &local_error.ErrMissingParams{}, err)
+
+	_, err = svc.GetCampaigns(context.Background(), map[string]string{"country": "us", "os_version": "latest"}, "", 10, 0)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+
+	_, err = svc.GetCampaigns(context.Background(), map[string]string{"country": "usa", "os": "ios"}, "", 10, 0)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
 }
 
-// get campaign from mongodb - failed because mongo return some error
-func TestGetCampaigns3(t *testing.T) {
-	mongodb.MongoDB = mocks.MongoMock{
-		GetDbMock: func(db_name string) mongodb.IMongoDb {
-			return iMongoDb
+// get campaign from store - campaigns gated on os and app version ranges
+func TestGetCampaigns9(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os", "os_version", "app_version"}), nil
 		},
-	}
-	iMongoDb = mocks.MongoDbMock{
-		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
-			return iMongoCollection
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "new-os", IsActive: true, Countries: []string{"us"}, Rules: map[string][]string{"includeos_version": {">=14.2"}}},
+				{ID: "old-builds", IsActive: true, Countries: []string{"us"}, Rules: map[string][]string{"includeapp_version": {"3.1.0 - 3.4.x"}}},
+				{ID: "not-beta", IsActive: true, Countries: []string{"us"}, Rules: map[string][]string{"excludeapp_version": {">=4.0.0-0 <4.0.0"}}},
+			}, nil
 		},
 	}
-	iMongoCollection = mocks.MongoCollectionMock{
-		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
-			data := bson.M{
-				"rules": bson.A{"app", "country", "os"},
-			}
-			result := mongo.NewSingleResultFromDocument(data, nil, nil)
-			return result, nil
-		},
-		AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-			return nil, errors.New("some error")
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "us", "os": "ios", "os_version": "14.1", "app_version": "3.4.2"}
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "not-beta"}, {Cid: "old-builds"}}, campaigns)
+
+	params = map[string]string{"app": "a", "country": "us", "os": "ios", "os_version": "15", "app_version": "4.0.0-beta.2"}
+	campaigns, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "new-os"}}, campaigns)
+}
+
+// get campaign from store - campaigns reaching their frequency cap are left out before paginating
+func TestGetCampaigns10(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", IsActive: true, Countries: []string{"us"}, FrequencyCap: &storage.FrequencyCap{Impressions: 2, Window: "24h"}},
+				{ID: "c2", IsActive: true, Countries: []string{"us"}},
+				{ID: "c3", IsActive: true, Countries: []string{"us"}},
+			}, nil
 		},
 	}
 
-	svc := NewService()
+	svc := NewService(store, frequency.NewMemoryCounter(), nil)
+	params := map[string]string{"app": "a", "country": "us", "os": "ios"}
 
-	params := map[string]string{"app": "a", "country": "b", "os": "c"}
+	for i := 0; i < 2; i++ {
+		campaigns, err := svc.GetCampaigns(context.Background(), params, "", 1, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []Campaign{{Cid: "c1"}}, campaigns)
 
-	_, err := svc.GetCampaigns(context.Background(), params, 10, 0)
-	assert.Error(t, err)
+		recorded, err := svc.RecordImpression(context.Background(), "c1", "user-1")
+		assert.NoError(t, err)
+		assert.True(t, recorded)
+	}
+
+	// the cap of user-1 is reached, other users still get c1
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "user-1", 2, 0)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Campaign{{Cid: "c2"}, {Cid: "c3"}}, campaigns)
+
+	campaigns, err = svc.GetCampaigns(context.Background(), params, "user-2", 3, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 3)
 }
 
-// get campaign from mongodb - failed because unknown rules parameters passed
-func TestGetCampaigns4(t *testing.T) {
-	mongodb.MongoDB = mocks.MongoMock{
-		GetDbMock: func(db_name string) mongodb.IMongoDb {
-			return iMongoDb
+// record impression - uncapped campaigns are not counted, unknown campaigns and missing users are rejected
+func TestRecordImpression1(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: listCampaigns,
+	}
+
+	svc := NewService(store, frequency.NewMemoryCounter(), nil)
+
+	recorded, err := svc.RecordImpression(context.Background(), "cid", "user-1")
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+
+	_, err = svc.RecordImpression(context.Background(), "unknown", "user-1")
+	assert.IsType(t, &local_error.ErrCampaignNotFound{}, err)
+
+	_, err = svc.RecordImpression(context.Background(), "cid", "")
+	assert.IsType(t, &local_error.ErrMissingParams{}, err)
+}
+
+// get campaign from store - campaigns that exhausted their budget are left out for every user
+func TestGetCampaigns11(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", IsActive: true, Countries: []string{"us"}, Budget: &storage.Budget{DailyImpressions: 1}},
+				{ID: "c2", IsActive: true, Countries: []string{"us"}},
+			}, nil
 		},
 	}
-	iMongoDb = mocks.MongoDbMock{
-		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
-			return iMongoCollection
+
+	svc := NewService(store, nil, budget.NewMemoryLedger())
+	params := map[string]string{"app": "a", "country": "us", "os": "ios"}
+
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c1"}}, campaigns)
+
+	recorded, err := svc.RecordImpression(context.Background(), "c1", "user-1")
+	assert.NoError(t, err)
+	assert.True(t, recorded)
+
+	campaigns, err = svc.GetCampaigns(context.Background(), params, "user-2", 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c2"}}, campaigns)
+}
+
+// get campaign from store - campaigns with variants return the creative and id of the variant of the user
+func TestGetCampaigns12(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", Image: "image", Cta: "cta", IsActive: true, Countries: []string{"us"}, Variants: []storage.Variant{
+					{ID: "only", Image: "variant-image", Cta: "variant-cta", Percent: 100},
+				}},
+			}, nil
 		},
 	}
-	iMongoCollection = mocks.MongoCollectionMock{
-		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
-			data := bson.M{
-				"rules": bson.A{"app", "country", "os"},
+
+	svc := NewService(store, nil, nil)
+	params := map[string]string{"app": "a", "country": "us", "os": "ios"}
+
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "user-1", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c1", Img: "variant-image", Cta: "variant-cta", Vid: "only"}}, campaigns)
+}
+
+// get campaign page - cursors resume after the last campaign of their page while campaigns change
+func TestGetCampaignsPage1(t *testing.T) {
+	deliveryMode = ModeAggregation
+	defer func() { deliveryMode = ModeEngine }()
+
+	active := []string{"c1", "c2", "c3", "c4", "c5"}
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		QueryCampaignsMock: func(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]storage.Campaign, error) {
+			campaigns := make([]storage.Campaign, 0, len(active))
+			for _, id := range active {
+				campaigns = append(campaigns, storage.Campaign{ID: id})
 			}
-			result := mongo.NewSingleResultFromDocument(data, nil, nil)
-			return result, nil
+			return campaigns, nil
 		},
 	}
 
-	svc := NewService()
+	svc := NewService(store, nil, nil)
+	params := map[string]string{"app": "a", "country": "us", "os": "c"}
 
-	params := map[string]string{"app": "a", "country": "b", "os": "c", "unknown": "unknown"}
+	campaigns, next, err := svc.GetCampaignsPage(context.Background(), params, "", Page{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c1"}, {Cid: "c2"}}, campaigns)
+	assert.NotEmpty(t, next)
 
-	_, err := svc.GetCampaigns(context.Background(), params, 10, 0)
-	assert.Error(t, err)
+	// c1 ends, the second page by offset would skip c3
+	active = active[1:]
+	campaigns, next, err = svc.GetCampaignsPage(context.Background(), params, "", Page{Limit: 2, Cursor: next})
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c3"}, {Cid: "c4"}}, campaigns)
+
+	campaigns, next, err = svc.GetCampaignsPage(context.Background(), params, "", Page{Limit: 2, Cursor: next})
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c5"}}, campaigns)
+	assert.Empty(t, next)
+
+	_, _, err = svc.GetCampaignsPage(context.Background(), params, "", Page{Limit: 2, Cursor: "not-a-cursor"})
+	var invalid *local_error.ErrInvalidParams
+	assert.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "cursor", invalid.Param)
 }
 
-// get campaign from mongodb - success, accept new rule parameter state
-func TestGetCampaigns5(t *testing.T) {
-	mongodb.MongoDB = mocks.MongoMock{
-		GetDbMock: func(db_name string) mongodb.IMongoDb {
-			return iMongoDb
+// get campaign batch - placements are filled in order without repeating campaigns unless allowed
+func TestGetCampaignsBatch1(t *testing.T) {
+	store := placementStore{
+		CampaignStoreMock: mocks.CampaignStoreMock{
+			GetParametersMock: rulesParameters,
+			ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+				return []storage.Campaign{
+					{ID: "c1", IsActive: true, Countries: []string{"us"}},
+					{ID: "c2", IsActive: true, Countries: []string{"us"}, Priority: 1},
+					{ID: "c3", IsActive: true, Countries: []string{"us"}},
+				}, nil
+			},
+		},
+		PlacementStoreMock: mocks.PlacementStoreMock{
+			ListPlacementsMock: func(ctx context.Context) ([]storage.Placement, error) {
+				return []storage.Placement{{ID: "banner", App: "a"}, {ID: "interstitial", App: "a"}, {ID: "rewarded", App: "a"}}, nil
+			},
 		},
 	}
-	iMongoDb = mocks.MongoDbMock{
-		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
-			return iMongoCollection
+
+	svc := NewService(store, nil, nil)
+	params := map[string]string{"app": "a", "country": "us", "os": "c"}
+	placements := []BatchPlacement{{ID: "interstitial", Limit: 1}, {ID: "banner", Limit: 3}, {ID: "rewarded", Limit: 1}}
+
+	batch, err := svc.GetCampaignsBatch(context.Background(), params, "", placements, false)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Campaign{{{Cid: "c2"}}, {{Cid: "c1"}, {Cid: "c3"}}, {}}, batch)
+
+	batch, err = svc.GetCampaignsBatch(context.Background(), params, "", placements, true)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Campaign{{{Cid: "c2"}}, {{Cid: "c2"}, {Cid: "c1"}, {Cid: "c3"}}, {{Cid: "c2"}}}, batch)
+
+	_, err = svc.GetCampaignsBatch(context.Background(), params, "", []BatchPlacement{{ID: "banner", Limit: 1}, {ID: "banner", Limit: 2}}, false)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+
+	_, err = svc.GetCampaignsBatch(context.Background(), params, "", []BatchPlacement{{ID: "banner"}}, false)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+
+	_, err = svc.GetCampaignsBatch(context.Background(), params, "", nil, false)
+	assert.IsType(t, &local_error.ErrMissingParams{}, err)
+
+	_, err = NewService(store.CampaignStoreMock, nil, nil).GetCampaignsBatch(context.Background(), params, "", placements, false)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+}
+
+// placementStore is a CampaignStore keeping placements
+type placementStore struct {
+	mocks.CampaignStoreMock
+	mocks.PlacementStoreMock
+}
+
+// get campaign from store - campaigns are left out of the placements they do not fit
+func TestGetCampaigns13(t *testing.T) {
+	store := placementStore{
+		CampaignStoreMock: mocks.CampaignStoreMock{
+			GetParametersMock: rulesParameters,
+			ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+				return []storage.Campaign{
+					{ID: "c1", IsActive: true, Countries: []string{"us"}, Formats: []string{"video"}},
+					{ID: "c2", IsActive: true, Countries: []string{"us"}, Formats: []string{"banner"}, Size: "320x50"},
+					{ID: "c3", IsActive: true, Countries: []string{"us"}, Placements: &storage.PlacementTargeting{Include: []string{"home_banner"}}},
+					{ID: "c4", IsActive: true, Countries: []string{"us"}, Placements: &storage.PlacementTargeting{Exclude: []string{"home_banner"}}},
+					{ID: "c5", IsActive: true, Countries: []string{"us"}, Formats: []string{"banner"}, Size: "728x90"},
+				}, nil
+			},
+		},
+		PlacementStoreMock: mocks.PlacementStoreMock{
+			ListPlacementsMock: func(ctx context.Context) ([]storage.Placement, error) {
+				return []storage.Placement{
+					{ID: "home_banner", App: "com.example.app", Formats: []string{"banner"}, Size: "320x50"},
+					{ID: "level_end", App: "com.example.app", Formats: []string{"interstitial", "video"}, MaxCampaigns: 1},
+				}, nil
+			},
 		},
 	}
-	iMongoCollection = mocks.MongoCollectionMock{
-		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
-			data := bson.M{
-				"rules": bson.A{"app", "country", "os", "state"},
-			}
-			result := mongo.NewSingleResultFromDocument(data, nil, nil)
-			return result, nil
-		},
-		AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-			data := bson.A{
-				bson.M{
-					"_id":   "cid",
-					"image": "image",
-					"cta":   "cta",
-				},
-			}
-			cursor, _ := mongo.NewCursorFromDocuments(data, nil, nil)
-			return cursor, nil
+
+	svc := NewService(store, nil, nil)
+	params := map[string]string{"app": "com.example.app", "country": "us", "os": "ios", "placement": "home_banner"}
+
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c2"}, {Cid: "c3"}}, campaigns)
+	assert.Equal(t, "home_banner", params["placement"])
+
+	// Only one campaign is shown in level_end
+	params["placement"] = "level_end"
+	campaigns, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c1"}}, campaigns)
+
+	// Campaigns including placements are left out of requests without one
+	delete(params, "placement")
+	campaigns, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Campaign{{Cid: "c1"}, {Cid: "c2"}, {Cid: "c4"}, {Cid: "c5"}}, campaigns)
+
+	params["placement"] = "unknown"
+	_, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+
+	params["placement"], params["app"] = "home_banner", "com.other.app"
+	_, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+
+	// Batch placements fit their definition, undefined ones are rejected like in GetCampaigns
+	params["app"] = "com.example.app"
+	delete(params, "placement")
+	batch, err := svc.GetCampaignsBatch(context.Background(), params, "", []BatchPlacement{{ID: "home_banner", Limit: 5}, {ID: "level_end", Limit: 5}}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Campaign{{{Cid: "c2"}, {Cid: "c3"}}, {{Cid: "c1"}}}, batch)
+
+	_, err = svc.GetCampaignsBatch(context.Background(), params, "", []BatchPlacement{{ID: "home_banner", Limit: 5}, {ID: "unknown", Limit: 5}}, false)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+}
+
+// get campaign from store - typed creatives are picked for the screen and language of the request
+func TestGetCampaigns14(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", IsActive: true, Countries: []string{"us"}, Image: "https://img/c1.png", Cta: "Listen", Creative: &storage.Creative{
+					Images: []storage.Image{{URL: "https://img/c1-320.png", Width: 320, Height: 50}, {URL: "https://img/c1-640.png", Width: 640, Height: 100}},
+					Texts:  map[string]storage.Text{"pt": {Title: "Música", Cta: "Ouvir"}},
+				}},
+				{ID: "c2", IsActive: true, Countries: []string{"us"}, Cta: "Play", Creative: &storage.Creative{
+					Images: []storage.Image{{URL: "https://img/c2-320.png", Width: 320, Height: 480}},
+					Video:  &storage.Video{URL: "https://video/c2.mp4", MimeType: "video/mp4", Duration: 15},
+				}},
+			}, nil
 		},
 	}
 
-	svc := NewService()
+	svc := NewService(store, nil, nil)
+	params := map[string]string{"app": "com.example.app", "country": "us", "os": "ios"}
 
-	params := map[string]string{"app": "a", "country": "b", "os": "c", "state": "d"}
+	// Clients declaring no screen keep the campaign image
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://img/c1.png", campaigns[0].Img)
+	assert.Equal(t, "Listen", campaigns[0].Cta)
+	assert.Equal(t, "https://img/c1-640.png", campaigns[0].Creative.Image.URL)
+	assert.Equal(t, "https://img/c2-320.png", campaigns[1].Img)
+	assert.Equal(t, "video/mp4", campaigns[1].Creative.Video.MimeType)
 
-	campaigns, err := svc.GetCampaigns(context.Background(), params, 10, 0)
+	params["screen"], params["density"], params["lang"] = "320x568", "1.5", "pt-BR"
+	campaigns, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
 	assert.NoError(t, err)
-	assert.Equal(t, 1, len(campaigns))
-	assert.Equal(t, []Campaign{{Cid: "cid", Img: "image", Cta: "cta"}}, campaigns)
+	assert.Equal(t, Campaign{Cid: "c1", Img: "https://img/c1-640.png", Cta: "Ouvir", Creative: &Creative{
+		Image: &storage.Image{URL: "https://img/c1-640.png", Width: 640, Height: 100}, Title: "Música", Lang: "pt",
+	}}, campaigns[0])
+
+	params["density"] = "0"
+	_, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+
+	params["density"], params["lang"] = "2", "not a language"
+	_, err = svc.GetCampaigns(context.Background(), params, "", 10, 0)
+	assert.IsType(t, &local_error.ErrInvalidParams{}, err)
+}
+
+// get campaign from store - images and ctas are localized for the lang parameter, or else the accepted languages
+func TestGetCampaigns15(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: func(ctx context.Context) ([]storage.Dimension, error) {
+			return storage.DimensionsFromNames([]string{"app", "country", "os", "lang"}), nil
+		},
+		ListCampaignsMock: func(ctx context.Context) ([]storage.Campaign, error) {
+			return []storage.Campaign{
+				{ID: "c1", IsActive: true, Countries: []string{"us"}, Image: "image", Cta: "Download", Localized: map[string]storage.Localization{
+					"pt":    {Cta: "Baixar"},
+					"pt-BR": {Image: "image-br"},
+				}},
+				{ID: "c2", IsActive: true, Countries: []string{"us"}, Image: "image", Cta: "Play", Variants: []storage.Variant{
+					{ID: "only", Image: "variant-image", Cta: "Play now", Percent: 100, Localized: map[string]storage.Localization{"fr": {Cta: "Jouer"}}},
+				}},
+				{ID: "c3", IsActive: true, Countries: []string{"us"}, Image: "image", Cta: "Learn", Rules: map[string][]string{"includelang": {"fr"}}},
+			}, nil
+		},
+	}
+
+	svc := NewService(store, nil, nil)
+	params := map[string]string{"app": "com.example.app", "country": "us", "os": "ios", "lang": "pt-BR"}
+
+	// pt-BR falls back on pt for the cta, c3 only targets French
+	campaigns, err := svc.GetCampaigns(context.Background(), params, "user-1", 10, 0)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Campaign{
+		{Cid: "c1", Img: "image-br", Cta: "Baixar"},
+		{Cid: "c2", Img: "variant-image", Cta: "Play now", Vid: "only"},
+	}, campaigns)
+
+	// The lang parameter takes precedence over the accepted languages
+	ctx := locale.NewContext(context.Background(), []string{"fr-CA", "pt"})
+	campaigns, err = svc.GetCampaigns(ctx, params, "user-1", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 2)
+
+	delete(params, "lang")
+	campaigns, err = svc.GetCampaigns(ctx, params, "user-1", 10, 0)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Campaign{
+		{Cid: "c1", Img: "image", Cta: "Baixar"},
+		{Cid: "c2", Img: "variant-image", Cta: "Jouer", Vid: "only"},
+		{Cid: "c3", Img: "image", Cta: "Learn"},
+	}, campaigns)
+
+	// Requests without a language get the campaign copy, language rules do not apply to them
+	campaigns, err = svc.GetCampaigns(context.Background(), params, "user-1", 10, 0)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Campaign{
+		{Cid: "c1", Img: "image", Cta: "Download"},
+		{Cid: "c2", Img: "variant-image", Cta: "Play now", Vid: "only"},
+		{Cid: "c3", Img: "image", Cta: "Learn"},
+	}, campaigns)
+}
+
+// get campaigns - negative limits and offsets past the last page, however large, return no campaigns
+func TestGetCampaigns16(t *testing.T) {
+	store := mocks.CampaignStoreMock{
+		GetParametersMock: rulesParameters,
+		ListCampaignsMock: listCampaigns,
+	}
+
+	svc := NewService(store, nil, nil)
+
+	params := map[string]string{"app": "a", "country": "us", "os": "c"}
+
+	for _, page := range [][2]int{{-1, 1}, {0, 0}, {10, -1}, {10, 1}, {1 << 62, 4}, {4, 1 << 62}} {
+		campaigns, err := svc.GetCampaigns(context.Background(), params, "", page[0], page[1])
+		assert.NoError(t, err)
+		assert.Empty(t, campaigns)
+	}
 }
@@ -0,0 +1,382 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"delivery-service/dimensions"
+	"delivery-service/engine"
+	"delivery-service/storage"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	detailsCollection    = "campaigns_details"
+	parametersCollection = "rules_parameters"
+	placementsCollection = "placements"
+	parametersID         = "current"
+)
+
+var (
+	// Dir is the directory of the collection files, the file store is used when it is set
+	Dir          = ""
+	pollInterval = time.Second
+)
+
+var logger log.Logger
+
+func init() {
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger = log.With(logger, "ts", log.DefaultTimestamp, "package", "file")
+
+	// Set log level debug
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	Dir = os.Getenv("CAMPAIGNS_DIR")
+}
+
+type parameters struct {
+	ID         string              `json:"_id"`
+	Rules      []string            `json:"rules"`
+	Dimensions []storage.Dimension `json:"dimensions"`
+}
+
+// placementDocument is a document of the placements collection, identified by _id like in mongodb
+type placementDocument struct {
+	storage.Placement
+	ID string `json:"_id"`
+}
+
+type snapshot struct {
+	parameters []storage.Dimension
+	campaigns  []storage.Campaign
+	placements []storage.Placement
+	index      *engine.Index
+	// modified holds the modification time of every collection file read
+	modified map[string]time.Time
+}
+
+// CampaignStore is a storage.CampaignStore reading the collections of the mongodb layout
+// from a directory holding one <collection>.json, .yaml or .yml file per collection, each
+// a list of documents: campaigns_details, rules_parameters, placements and, for the
+// campaigns without a countries field, one file per country
+type CampaignStore struct {
+	dir string
+
+	mu       sync.RWMutex
+	snapshot *snapshot
+}
+
+// NewCampaignStore creates a CampaignStore reading the collection files of dir
+func NewCampaignStore(dir string) *CampaignStore {
+	return &CampaignStore{dir: dir}
+}
+
+// GetParameters returns the dimensions of the rules_parameters current document,
+// built from its flat rules list when it has no dimensions
+func (s *CampaignStore) GetParameters(ctx context.Context) ([]storage.Dimension, error) {
+	snap, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return snap.parameters, nil
+}
+
+// QueryCampaigns returns the active campaigns matching the targeting params. Being the
+// per request path it picks up file changes itself, without relying on Watch.
+func (s *CampaignStore) QueryCampaigns(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]storage.Campaign, error) {
+	if _, err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	snap, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return snap.index.Query(params, userID, nil, limit, offset), nil
+}
+
+// ListCampaigns returns every active campaign
+func (s *CampaignStore) ListCampaigns(ctx context.Context) ([]storage.Campaign, error) {
+	snap, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return snap.campaigns, nil
+}
+
+// ListPlacements returns the placements ordered by id
+func (s *CampaignStore) ListPlacements(ctx context.Context) ([]storage.Placement, error) {
+	snap, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return snap.placements, nil
+}
+
+// ActiveCampaign returns an active campaign
+func (s *CampaignStore) ActiveCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	snap, err := s.current()
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	for _, campaign := range snap.campaigns {
+		if campaign.ID == id {
+			return campaign, nil
+		}
+	}
+	return storage.Campaign{}, storage.ErrCampaignNotFound
+}
+
+// Watch reloads the files and notifies handler whenever one of them is added,
+// modified or removed, until ctx is cancelled
+func (s *CampaignStore) Watch(ctx context.Context, handler storage.ChangeHandler) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := s.refresh()
+		if err != nil || !reloaded {
+			continue
+		}
+
+		if err := handler.Reload(ctx); err != nil {
+			level.Error(logger).Log("method", "Watch", "msg", "reload failed", "err", err)
+		}
+	}
+}
+
+// refresh reloads the files when they changed since the last load
+func (s *CampaignStore) refresh() (bool, error) {
+	changed, err := s.changed()
+	if err != nil {
+		level.Error(logger).Log("method", "refresh", "msg", "error listing collection files", "err", err)
+		return false, err
+	}
+	if !changed {
+		return false, nil
+	}
+
+	snap, err := s.load()
+	if err != nil {
+		level.Error(logger).Log("method", "refresh", "msg", "error loading collection files, keeping previous campaigns", "err", err)
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.snapshot = snap
+	s.mu.Unlock()
+
+	level.Info(logger).Log("method", "refresh", "msg", "collection files reloaded", "campaigns", len(snap.campaigns))
+	return true, nil
+}
+
+// current returns the loaded snapshot, loading the files on first use
+func (s *CampaignStore) current() (*snapshot, error) {
+	s.mu.RLock()
+	snap := s.snapshot
+	s.mu.RUnlock()
+
+	if snap != nil {
+		return snap, nil
+	}
+
+	snap, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snapshot == nil {
+		s.snapshot = snap
+	}
+	return s.snapshot, nil
+}
+
+// changed reports whether the collection files differ from the loaded snapshot
+func (s *CampaignStore) changed() (bool, error) {
+	files, err := s.files()
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.snapshot == nil || len(files) != len(s.snapshot.modified) {
+		return true, nil
+	}
+
+	for path, modified := range files {
+		if previous, ok := s.snapshot.modified[path]; !ok || !previous.Equal(modified) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// files returns the modification time of every collection file of the directory
+func (s *CampaignStore) files() (map[string]time.Time, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]time.Time)
+	for _, entry := range entries {
+		if entry.IsDir() || collectionName(entry.Name()) == "" {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(s.dir, entry.Name())] = info.ModTime()
+	}
+	return files, nil
+}
+
+func (s *CampaignStore) load() (*snapshot, error) {
+	files, err := s.files()
+	if err != nil {
+		level.Error(logger).Log("method", "load", "msg", "error listing collection files", "dir", s.dir, "err", err)
+		return nil, err
+	}
+
+	snap := &snapshot{modified: files}
+	var details []storage.Campaign
+	countries := make(map[string][]string)
+
+	for path := range files {
+		switch collection := collectionName(filepath.Base(path)); collection {
+		case detailsCollection:
+			if err := readDocuments(path, &details); err != nil {
+				return nil, err
+			}
+
+		case parametersCollection:
+			var docs []parameters
+			if err := readDocuments(path, &docs); err != nil {
+				return nil, err
+			}
+			for _, doc := range docs {
+				if doc.ID == parametersID {
+					snap.parameters = doc.Dimensions
+					if len(snap.parameters) == 0 {
+						snap.parameters = storage.DimensionsFromNames(doc.Rules)
+					}
+				}
+			}
+
+		case placementsCollection:
+			var docs []placementDocument
+			if err := readDocuments(path, &docs); err != nil {
+				return nil, err
+			}
+			for _, doc := range docs {
+				doc.Placement.ID = doc.ID
+				snap.placements = append(snap.placements, doc.Placement)
+			}
+			sort.Slice(snap.placements, func(i, j int) bool { return snap.placements[i].ID < snap.placements[j].ID })
+
+		default:
+			if !dimensions.IsCountryCode(collection) {
+				level.Warn(logger).Log("method", "load", "msg", "skipping a file that is not a collection nor a country code", "file", path)
+				continue
+			}
+
+			var docs []struct {
+				ID string `json:"_id"`
+			}
+			if err := readDocuments(path, &docs); err != nil {
+				return nil, err
+			}
+			for _, doc := range docs {
+				countries[doc.ID] = append(countries[doc.ID], collection)
+			}
+		}
+	}
+
+	for _, campaign := range details {
+		if !campaign.IsActive {
+			continue
+		}
+		campaign.Countries = mergeCountries(campaign.Countries, countries[campaign.ID])
+		snap.campaigns = append(snap.campaigns, campaign)
+	}
+	snap.index = engine.NewIndex(snap.campaigns, dimensions.New(snap.parameters))
+
+	return snap, nil
+}
+
+// mergeCountries returns the sorted lower case countries of the countries field of a
+// campaign and of the country files listing it
+func mergeCountries(field, files []string) []string {
+	set := make(map[string]struct{}, len(field)+len(files))
+	for _, country := range append(append([]string{}, field...), files...) {
+		set[strings.ToLower(country)] = struct{}{}
+	}
+
+	var countries []string
+	for country := range set {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// collectionName returns the collection stored in a file name, empty for other files
+func collectionName(name string) string {
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return ""
+}
+
+// readDocuments decodes the list of documents of a json or yaml file into docs.
+// YAML documents are converted to JSON first so both formats share the json field tags.
+func readDocuments(path string, docs interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		level.Error(logger).Log("method", "readDocuments", "msg", "error reading file", "path", path, "err", err)
+		return err
+	}
+
+	if filepath.Ext(path) != ".json" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			level.Error(logger).Log("method", "readDocuments", "msg", "error decoding yaml", "path", path, "err", err)
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, docs); err != nil {
+		level.Error(logger).Log("method", "readDocuments", "msg", "error decoding json", "path", path, "err", err)
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
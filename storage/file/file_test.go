@@ -0,0 +1,158 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func newTestDir(t *testing.T) string {
+	dir := t.TempDir()
+	writeFile(t, dir, "rules_parameters.json", `[{"_id": "current", "rules": ["app", "country", "os"]}]`)
+	writeFile(t, dir, "campaigns_details.yaml", `
+- _id: c1
+  image: img1
+  cta: cta1
+  isActive: true
+  rules:
+    includeos: [android]
+- _id: c2
+  image: img2
+  cta: cta2
+  isActive: false
+`)
+	writeFile(t, dir, "us.yml", `[{_id: c1}, {_id: c2}]`)
+	writeFile(t, dir, "README.md", `not a collection`)
+	return dir
+}
+
+type reloadCounter struct {
+	reloads chan struct{}
+}
+
+func (r *reloadCounter) Reload(ctx context.Context) error {
+	r.reloads <- struct{}{}
+	return nil
+}
+
+func (r *reloadCounter) ApplyChange(change storage.Change) error {
+	return nil
+}
+
+// read parameters and campaigns from json and yaml files
+func TestCampaignStore1(t *testing.T) {
+	store := NewCampaignStore(newTestDir(t))
+
+	params, err := store.GetParameters(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, storage.DimensionsFromNames([]string{"app", "country", "os"}), params)
+
+	campaigns, err := store.ListCampaigns(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Campaign{
+		{ID: "c1", Image: "img1", Cta: "cta1", IsActive: true, Rules: map[string][]string{"includeos": {"android"}}, Countries: []string{"us"}},
+	}, campaigns)
+
+	campaigns, err = store.QueryCampaigns(context.Background(), map[string]string{"country": "us", "os": "ios"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, campaigns)
+}
+
+// file edits are picked up by queries and notified to watchers
+func TestCampaignStore2(t *testing.T) {
+	dir := newTestDir(t)
+	store := NewCampaignStore(dir)
+	pollInterval = 10 * time.Millisecond
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "in"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, campaigns)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := &reloadCounter{reloads: make(chan struct{}, 1)}
+	go store.Watch(ctx, handler)
+
+	writeFile(t, dir, "in.json", `[{"_id": "c1"}]`)
+
+	select {
+	case <-handler.reloads:
+	case <-time.After(time.Second):
+		t.Fatal("file change not notified")
+	}
+
+	campaigns, err = store.QueryCampaigns(context.Background(), map[string]string{"country": "in"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", campaigns[0].ID)
+}
+
+// invalid files are reported
+func TestCampaignStore3(t *testing.T) {
+	dir := newTestDir(t)
+	writeFile(t, dir, "campaigns_details.json", `{not json`)
+
+	_, err := NewCampaignStore(dir).ListCampaigns(context.Background())
+	assert.Error(t, err)
+}
+
+// countries come from the countries field and the country files
+func TestCampaignStore4(t *testing.T) {
+	dir := newTestDir(t)
+	writeFile(t, dir, "campaigns_details.yaml", `
+- _id: c1
+  image: img1
+  cta: cta1
+  isActive: true
+  countries: [DE, us]
+`)
+
+	campaigns, err := NewCampaignStore(dir).QueryCampaigns(context.Background(), map[string]string{"country": "de"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, []string{"de", "us"}, campaigns[0].Countries)
+}
+
+// placements come from the placements file, ordered by id
+func TestCampaignStore5(t *testing.T) {
+	dir := newTestDir(t)
+	writeFile(t, dir, "placements.yaml", `
+- _id: level_end
+  app: com.example.app
+  formats: [interstitial, video]
+  maxCampaigns: 1
+- _id: home_banner
+  app: com.example.app
+  formats: [banner]
+  size: 320x50
+`)
+
+	placements, err := NewCampaignStore(dir).ListPlacements(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Placement{
+		{ID: "home_banner", App: "com.example.app", Formats: []string{"banner"}, Size: "320x50"},
+		{ID: "level_end", App: "com.example.app", Formats: []string{"interstitial", "video"}, MaxCampaigns: 1},
+	}, placements)
+}
+
+// json and yaml files that are neither collections nor country codes are skipped
+func TestCampaignStore6(t *testing.T) {
+	dir := newTestDir(t)
+	writeFile(t, dir, "package.json", `{"name": "campaigns"}`)
+	writeFile(t, dir, "README.yaml", `[{_id: c1}]`)
+	writeFile(t, dir, "gb.json", `[{"_id": "c1"}]`)
+
+	campaigns, err := NewCampaignStore(dir).ListCampaigns(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, []string{"gb", "us"}, campaigns[0].Countries)
+}
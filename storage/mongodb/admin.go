@@ -0,0 +1,180 @@
+package mongodb
+
+import (
+	"context"
+
+	"delivery-service/expression"
+	"delivery-service/storage"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindCampaigns returns every campaign of campaigns_details with its countries
+func (s *CampaignStore) FindCampaigns(ctx context.Context) ([]storage.Campaign, error) {
+	var campaigns []storage.Campaign
+
+	coll := s.db.GetCollection(DetailsCollection)
+	cursor, err := coll.Aggregate(ctx, bson.A{
+		bson.M{
+			"$sort": bson.M{
+				"_id": 1,
+			},
+		},
+	})
+
+	if err != nil {
+		level.Error(logger).Log("method", "FindCampaigns", "msg", "mongodb aggregate failed", "err", err)
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &campaigns); err != nil {
+		level.Error(logger).Log("method", "FindCampaigns", "msg", "error decoding cursor", "err", err)
+		return nil, err
+	}
+
+	if s.layout != LayoutCollections {
+		return campaigns, nil
+	}
+
+	countries, err := s.loadCountries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range campaigns {
+		campaigns[i].Countries = sortedKeys(countries[campaigns[i].ID])
+	}
+	return campaigns, nil
+}
+
+// GetCampaign returns a campaign of campaigns_details with its countries
+func (s *CampaignStore) GetCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	campaign, err := s.findCampaign(ctx, id)
+	if err != nil {
+		level.Error(logger).Log("method", "GetCampaign", "msg", "mongodb findOne failed", "err", err)
+		return storage.Campaign{}, err
+	}
+	if campaign == nil {
+		return storage.Campaign{}, storage.ErrCampaignNotFound
+	}
+
+	if s.layout != LayoutCollections {
+		return *campaign, nil
+	}
+
+	countries, err := s.loadCountries(ctx)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+
+	campaign.Countries = sortedKeys(countries[id])
+	return *campaign, nil
+}
+
+// SaveCampaign replaces the campaigns_details document of the campaign, countries included.
+// In the collections layout it then adds the campaign to the collections of its countries
+// and removes it from the collections of other countries. Without transactions a failure
+// can leave the country collections partially updated, saving the campaign again brings
+// them back in line.
+func (s *CampaignStore) SaveCampaign(ctx context.Context, campaign storage.Campaign) error {
+	_, err := s.db.GetCollection(DetailsCollection).ReplaceOne(ctx, bson.M{"_id": campaign.ID}, newDetailsDocument(campaign), options.Replace().SetUpsert(true))
+	if err != nil {
+		level.Error(logger).Log("method", "SaveCampaign", "msg", "mongodb replaceOne failed", "id", campaign.ID, "err", err)
+		return err
+	}
+
+	if s.layout != LayoutCollections {
+		return nil
+	}
+
+	countries, err := s.loadCountries(ctx)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]struct{}, len(campaign.Countries))
+	for _, country := range campaign.Countries {
+		wanted[country] = struct{}{}
+		if _, ok := countries[campaign.ID][country]; ok {
+			continue
+		}
+
+		_, err := s.db.GetCollection(country).ReplaceOne(ctx, bson.M{"_id": campaign.ID}, bson.M{"_id": campaign.ID}, options.Replace().SetUpsert(true))
+		if err != nil {
+			level.Error(logger).Log("method", "SaveCampaign", "msg", "mongodb replaceOne failed", "id", campaign.ID, "country", country, "err", err)
+			return err
+		}
+	}
+
+	for country := range countries[campaign.ID] {
+		if _, ok := wanted[country]; ok {
+			continue
+		}
+		if err := s.removeFromCountry(ctx, campaign.ID, country); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteCampaign removes the campaign from campaigns_details, and before that from every
+// country collection in the collections layout
+func (s *CampaignStore) DeleteCampaign(ctx context.Context, id string) error {
+	if s.layout == LayoutCollections {
+		countries, err := s.loadCountries(ctx)
+		if err != nil {
+			return err
+		}
+
+		for country := range countries[id] {
+			if err := s.removeFromCountry(ctx, id, country); err != nil {
+				return err
+			}
+		}
+	}
+
+	result, err := s.db.GetCollection(DetailsCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		level.Error(logger).Log("method", "DeleteCampaign", "msg", "mongodb deleteOne failed", "id", id, "err", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return storage.ErrCampaignNotFound
+	}
+
+	return nil
+}
+
+func (s *CampaignStore) removeFromCountry(ctx context.Context, id, country string) error {
+	_, err := s.db.GetCollection(country).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		level.Error(logger).Log("method", "removeFromCountry", "msg", "mongodb deleteOne failed", "id", id, "country", country, "err", err)
+	}
+	return err
+}
+
+// detailsDocument is a campaigns_details document, the campaign with the clauses of its
+// expression the targeting aggregation matches on
+type detailsDocument struct {
+	storage.Campaign `bson:",inline"`
+	// ExpressionClauses over-approximates the expression on its equality comparisons only,
+	// so the aggregation prefilter may keep campaigns the expression then rejects. Values
+	// are kept as written, the prefilter skips the dimensions trimming theirs. It is
+	// left empty, and the prefilter skipped, when the normal form of the expression has
+	// more than 32 clauses (expression.maxClauses).
+	ExpressionClauses []map[string][]string `bson:"expressionClauses,omitempty"`
+}
+
+func newDetailsDocument(campaign storage.Campaign) detailsDocument {
+	doc := detailsDocument{Campaign: campaign}
+	if campaign.Expression == "" {
+		return doc
+	}
+	if expr, err := expression.Parse(campaign.Expression); err == nil {
+		doc.ExpressionClauses, _ = expr.Clauses()
+	}
+	return doc
+}
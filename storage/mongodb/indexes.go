@@ -0,0 +1,326 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"delivery-service/dimensions"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// IndexesCreate creates the missing indexes at startup
+	IndexesCreate = "create"
+	// IndexesVerify logs the missing indexes at startup, for databases whose indexes are
+	// managed by their administrators
+	IndexesVerify = "verify"
+	// IndexesOff leaves the indexes alone
+	IndexesOff = "off"
+
+	// ExplainLog logs the plan of the sample request at startup, and an error on a COLLSCAN
+	ExplainLog = "log"
+	// ExplainFail also fails the startup on a COLLSCAN
+	ExplainFail = "fail"
+	// ExplainOff does not explain the delivery pipeline
+	ExplainOff = "off"
+
+	// CountriesIndex is the index of campaigns_details serving the aggregation of the field layout
+	CountriesIndex = "countries_isActive__id"
+
+	stageCollScan = "COLLSCAN"
+)
+
+// ErrCollScan is returned by Check when the delivery pipeline of the sample request scans
+// a whole collection and MONGODB_EXPLAIN is fail
+var ErrCollScan = errors.New("delivery pipeline scans a whole collection")
+
+// sampleValues are the values of the required dimensions in the default sample request
+var sampleValues = map[string]string{"app": "com.example.app", "country": "us", "os": "android"}
+
+// Index is an index the delivery pipeline depends on
+type Index struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+}
+
+// Plan is the query plan of the delivery pipeline for a request
+type Plan struct {
+	Collection string
+	// Stages lists the stages of the winning plans from the root, like FETCH or IXSCAN
+	Stages []string
+}
+
+// CollScan reports whether the plan scans a whole collection
+func (p Plan) CollScan() bool {
+	for _, stage := range p.Stages {
+		if stage == stageCollScan {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexManager declares the indexes the delivery pipeline of a store depends on, creates
+// or verifies them and explains the pipeline
+type IndexManager struct {
+	store *CampaignStore
+}
+
+// NewIndexManager creates the IndexManager of the layout of store
+func NewIndexManager(store *CampaignStore) *IndexManager {
+	return &IndexManager{store: store}
+}
+
+// Required returns the indexes of campaigns_details: _id for the lookups, isActive for the
+// campaign list, the countries of the field layout and the include rules of the indexed
+// dimensions of registry. Country collections are only read by _id.
+func (m *IndexManager) Required(registry *dimensions.Registry) []Index {
+	indexes := []Index{
+		{Collection: DetailsCollection, Name: "_id_", Keys: bson.D{{Key: "_id", Value: 1}}},
+		{Collection: DetailsCollection, Name: "isActive", Keys: bson.D{{Key: "isActive", Value: 1}}},
+	}
+	if m.store.layout != LayoutCollections {
+		indexes = append(indexes, countriesIndex())
+	}
+
+	for _, name := range registry.Names() {
+		if dimension, _ := registry.Get(name); dimension.Indexed() {
+			field := "rules.include" + name
+			indexes = append(indexes, Index{Collection: DetailsCollection, Name: field, Keys: bson.D{{Key: field, Value: 1}}})
+		}
+	}
+	return indexes
+}
+
+func countriesIndex() Index {
+	return Index{
+		Collection: DetailsCollection,
+		Name:       CountriesIndex,
+		Keys:       bson.D{{Key: "countries", Value: 1}, {Key: "isActive", Value: 1}, {Key: "_id", Value: 1}},
+	}
+}
+
+// Missing returns the required indexes whose keys no index of their collection has
+func (m *IndexManager) Missing(ctx context.Context, registry *dimensions.Registry) ([]Index, error) {
+	specs := make(map[string][]*mongo.IndexSpecification)
+	var missing []Index
+	for _, index := range m.Required(registry) {
+		if _, ok := specs[index.Collection]; !ok {
+			list, err := m.store.db.GetCollection(index.Collection).ListIndexSpecs(ctx)
+			if err != nil {
+				level.Error(logger).Log("method", "Missing", "msg", "mongodb listIndexes failed", "collection", index.Collection, "err", err)
+				return nil, err
+			}
+			specs[index.Collection] = list
+		}
+
+		if !hasKeys(specs[index.Collection], index.Keys) {
+			missing = append(missing, index)
+		}
+	}
+	return missing, nil
+}
+
+// Ensure creates the missing required indexes and returns them
+func (m *IndexManager) Ensure(ctx context.Context, registry *dimensions.Registry) ([]Index, error) {
+	missing, err := m.Missing(ctx, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, index := range missing {
+		if err := createIndex(ctx, m.store.db, index); err != nil {
+			return missing[:i], err
+		}
+	}
+	return missing, nil
+}
+
+func createIndex(ctx context.Context, db IMongoDb, index Index) error {
+	_, err := db.GetCollection(index.Collection).CreateIndex(ctx, mongo.IndexModel{
+		Keys:    index.Keys,
+		Options: options.Index().SetName(index.Name),
+	})
+	if err != nil {
+		level.Error(logger).Log("method", "createIndex", "msg", "mongodb createIndex failed", "collection", index.Collection, "index", index.Name, "err", err)
+	}
+	return err
+}
+
+// Explain returns the query plan of the delivery pipeline for the normalized params,
+// on the collection of the layout of the store
+func (m *IndexManager) Explain(ctx context.Context, registry *dimensions.Registry, params map[string]string) (Plan, error) {
+	plan := Plan{Collection: DetailsCollection}
+	pipeline := getCountryCampaignsFilter(registry, params, time.Now())
+	if m.store.layout == LayoutCollections {
+		plan.Collection = params["country"]
+		pipeline = getCampaignsFilter(registry, params, time.Now())
+	}
+
+	result, err := m.store.db.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "aggregate", Value: plan.Collection},
+			{Key: "pipeline", Value: pipeline},
+			{Key: "cursor", Value: bson.D{}},
+		}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	})
+	if err != nil {
+		level.Error(logger).Log("method", "Explain", "msg", "mongodb explain failed", "collection", plan.Collection, "err", err)
+		return plan, err
+	}
+
+	plan.Stages = planStages(result, false, nil)
+	return plan, nil
+}
+
+// Check runs at startup: it creates or verifies the required indexes as selected by
+// MONGODB_INDEXES, then explains the delivery pipeline of the MONGODB_EXPLAIN_SAMPLE
+// request as selected by MONGODB_EXPLAIN. It returns ErrCollScan when the pipeline scans
+// a whole collection and MONGODB_EXPLAIN is fail.
+func (m *IndexManager) Check(ctx context.Context) error {
+	if indexMode == IndexesOff && explainMode == ExplainOff {
+		return nil
+	}
+
+	dims, err := m.store.GetParameters(ctx)
+	if err != nil {
+		return err
+	}
+	registry := dimensions.New(dims)
+
+	switch indexMode {
+	case IndexesCreate:
+		created, err := m.Ensure(ctx, registry)
+		for _, index := range created {
+			level.Info(logger).Log("method", "Check", "msg", "index created", "collection", index.Collection, "index", index.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case IndexesVerify:
+		missing, err := m.Missing(ctx, registry)
+		if err != nil {
+			return err
+		}
+		for _, index := range missing {
+			level.Error(logger).Log("method", "Check", "msg", "index missing, run with MONGODB_INDEXES=create", "collection", index.Collection, "index", index.Name)
+		}
+	}
+
+	if explainMode == ExplainOff {
+		return nil
+	}
+
+	params, err := sampleRequest(registry, explainSample)
+	if err != nil {
+		return err
+	}
+	plan, err := m.Explain(ctx, registry, params)
+	if err != nil {
+		return err
+	}
+
+	if !plan.CollScan() {
+		level.Info(logger).Log("method", "Check", "msg", "delivery pipeline plan", "collection", plan.Collection, "stages", strings.Join(plan.Stages, ","))
+		return nil
+	}
+	level.Error(logger).Log("method", "Check", "msg", "delivery pipeline scans a whole collection", "collection", plan.Collection, "stages", strings.Join(plan.Stages, ","), "failing", explainMode == ExplainFail)
+	if explainMode == ExplainFail {
+		return fmt.Errorf("%w: %s", ErrCollScan, plan.Collection)
+	}
+	return nil
+}
+
+// sampleRequest returns the normalized params of the sample query string, or a request
+// with a value for every required dimension when it is empty
+func sampleRequest(registry *dimensions.Registry, query string) (map[string]string, error) {
+	params := make(map[string]string)
+	if query == "" {
+		for _, name := range registry.Required() {
+			params[name] = "sample"
+			if value, ok := sampleValues[name]; ok {
+				params[name] = value
+			}
+		}
+		return params, nil
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MONGODB_EXPLAIN_SAMPLE: %w", err)
+	}
+	for name := range values {
+		value, err := registry.Lookup(name).Normalize(values.Get(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MONGODB_EXPLAIN_SAMPLE parameter %s: %w", name, err)
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// planStages appends to stages the stages of the winning plans found in doc, at any depth
+// so that plans nested in aggregation stages or shards are found
+func planStages(doc bson.Raw, inPlan bool, stages []string) []string {
+	elements, err := doc.Elements()
+	if err != nil {
+		return stages
+	}
+
+	for _, element := range elements {
+		key, value := element.Key(), element.Value()
+		switch value.Type {
+		case bsontype.String:
+			if inPlan && key == "stage" {
+				stages = append(stages, value.StringValue())
+			}
+		case bsontype.EmbeddedDocument:
+			stages = planStages(value.Document(), inPlan || key == "winningPlan", stages)
+		case bsontype.Array:
+			values, _ := value.Array().Values()
+			for _, item := range values {
+				if item.Type == bsontype.EmbeddedDocument {
+					stages = planStages(item.Document(), inPlan, stages)
+				}
+			}
+		}
+	}
+	return stages
+}
+
+// hasKeys reports whether one of the indexes has exactly keys, whatever its name
+func hasKeys(specs []*mongo.IndexSpecification, keys bson.D) bool {
+	for _, spec := range specs {
+		elements, err := spec.KeysDocument.Elements()
+		if err != nil || len(elements) != len(keys) {
+			continue
+		}
+
+		same := true
+		for i, element := range elements {
+			direction, ok := element.Value().AsInt64OK()
+			if !ok {
+				direction = int64(element.Value().Double())
+			}
+			if element.Key() != keys[i].Key || direction != int64(keys[i].Value.(int)) {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
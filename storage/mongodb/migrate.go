@@ -0,0 +1,126 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"delivery-service/dimensions"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Migration is the outcome of MigrateCountries
+type Migration struct {
+	// Campaigns is the number of campaigns_details documents whose countries were updated
+	Campaigns int
+	// Countries lists the country collections copied
+	Countries []string
+	// Skipped lists the collections listing campaigns that are not named after a country,
+	// left out of the countries field
+	Skipped []string
+	// Orphans lists the campaign ids of country collections without a campaigns_details document
+	Orphans []string
+}
+
+// MigrateCountries copies the country collections of the collections layout into the
+// countries field of the campaigns_details documents, on top of the countries they
+// already have, and creates the index of the field layout. The country collections are
+// left in place, so that the instances still running the collections layout keep
+// working, and running the migration again is harmless. Nothing is written on a dry run.
+func MigrateCountries(ctx context.Context, db IMongoDb, dryRun bool) (Migration, error) {
+	var migration Migration
+
+	listed, err := loadCountries(ctx, db)
+	if err != nil {
+		return migration, err
+	}
+
+	countries := make(map[string]map[string]struct{}, len(listed))
+	copied, skipped := make(map[string]struct{}), make(map[string]struct{})
+	for id, collections := range listed {
+		for collection := range collections {
+			if !dimensions.IsCountryCode(collection) {
+				skipped[collection] = struct{}{}
+				continue
+			}
+			copied[collection] = struct{}{}
+			if countries[id] == nil {
+				countries[id] = make(map[string]struct{})
+			}
+			countries[id][strings.ToLower(collection)] = struct{}{}
+		}
+	}
+	migration.Countries, migration.Skipped = sortedKeys(copied), sortedKeys(skipped)
+
+	// documents are read raw, so that replacing them keeps the fields this version does not know
+	var docs []bson.M
+	details := db.GetCollection(DetailsCollection)
+	cursor, err := details.Aggregate(ctx, bson.A{
+		bson.M{
+			"$sort": bson.M{
+				"_id": 1,
+			},
+		},
+	})
+
+	if err != nil {
+		level.Error(logger).Log("method", "MigrateCountries", "msg", "mongodb aggregate failed", "err", err)
+		return migration, err
+	}
+
+	if err = cursor.All(ctx, &docs); err != nil {
+		level.Error(logger).Log("method", "MigrateCountries", "msg", "error decoding cursor", "err", err)
+		return migration, err
+	}
+
+	found := make(map[string]struct{}, len(docs))
+	for _, doc := range docs {
+		id := fmt.Sprint(doc["_id"])
+		found[id] = struct{}{}
+
+		merged := make(map[string]struct{}, len(countries[id]))
+		var current []string
+		if values, ok := doc["countries"].(bson.A); ok {
+			for _, value := range values {
+				country := fmt.Sprint(value)
+				current = append(current, country)
+				merged[country] = struct{}{}
+			}
+		}
+		for country := range countries[id] {
+			merged[country] = struct{}{}
+		}
+
+		wanted := sortedKeys(merged)
+		if len(wanted) == len(current) {
+			continue
+		}
+
+		migration.Campaigns++
+		if dryRun {
+			continue
+		}
+
+		doc["countries"] = wanted
+		if _, err := details.ReplaceOne(ctx, bson.M{"_id": doc["_id"]}, doc); err != nil {
+			level.Error(logger).Log("method", "MigrateCountries", "msg", "mongodb replaceOne failed", "id", id, "err", err)
+			return migration, err
+		}
+	}
+
+	for id := range countries {
+		if _, ok := found[id]; !ok {
+			migration.Orphans = append(migration.Orphans, id)
+		}
+	}
+	sort.Strings(migration.Orphans)
+
+	if dryRun {
+		return migration, nil
+	}
+
+	return migration, createIndex(ctx, db, countriesIndex())
+}
@@ -3,15 +3,29 @@ package mongodb
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	mongo_conn_uri = "mongodb://localhost:27017/"
+	mongo_conn_uri      = "mongodb://localhost:27017/"
+	watcherPollInterval = 30 * time.Second
+
+	// Layout is where the countries of the campaigns are kept, LayoutField unless
+	// CAMPAIGN_LAYOUT selects the per country collections of LayoutCollections
+	Layout = LayoutField
+
+	// indexMode is what the index manager does with missing indexes, MONGODB_INDEXES
+	indexMode = IndexesCreate
+	// explainMode is what the index manager does with a COLLSCAN plan, MONGODB_EXPLAIN
+	explainMode = ExplainLog
+	// explainSample is the query string of the request explained, MONGODB_EXPLAIN_SAMPLE
+	explainSample = ""
 )
 
 type IMongo interface {
@@ -20,11 +34,18 @@ type IMongo interface {
 
 type IMongoDb interface {
 	GetCollection(coll_name string) IMongoCollection
+	Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+	ListCollectionNames(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) ([]string, error)
+	RunCommand(ctx context.Context, command interface{}) (bson.Raw, error)
 }
 
 type IMongoCollection interface {
 	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error)
 	Aggregate(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+	ReplaceOne(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	CreateIndex(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error)
+	ListIndexSpecs(ctx context.Context) ([]*mongo.IndexSpecification, error)
 }
 
 type Mongo struct {
@@ -53,6 +74,40 @@ func init() {
 	if conn_uri != "" {
 		mongo_conn_uri = conn_uri
 	}
+
+	if interval := os.Getenv("WATCHER_POLL_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			watcherPollInterval = d
+		} else {
+			level.Error(logger).Log("msg", "invalid WATCHER_POLL_INTERVAL, using default", "value", interval)
+		}
+	}
+
+	switch layout := os.Getenv("CAMPAIGN_LAYOUT"); layout {
+	case "":
+	case LayoutField, LayoutCollections:
+		Layout = layout
+	default:
+		level.Error(logger).Log("msg", "invalid CAMPAIGN_LAYOUT, using default", "value", layout, "default", Layout)
+	}
+
+	switch mode := os.Getenv("MONGODB_INDEXES"); mode {
+	case "":
+	case IndexesCreate, IndexesVerify, IndexesOff:
+		indexMode = mode
+	default:
+		level.Error(logger).Log("msg", "invalid MONGODB_INDEXES, using default", "value", mode, "default", indexMode)
+	}
+
+	switch mode := os.Getenv("MONGODB_EXPLAIN"); mode {
+	case "":
+	case ExplainLog, ExplainFail, ExplainOff:
+		explainMode = mode
+	default:
+		level.Error(logger).Log("msg", "invalid MONGODB_EXPLAIN, using default", "value", mode, "default", explainMode)
+	}
+	explainSample = os.Getenv("MONGODB_EXPLAIN_SAMPLE")
+
 	MongoDB = Mongo{}
 }
 
@@ -72,6 +127,33 @@ func (m *MongoDb) GetCollection(coll_name string) IMongoCollection {
 	return &MongoCollection{Collection: m.Db.Collection(coll_name)}
 }
 
+func (m *MongoDb) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	stream, err := m.Db.Watch(ctx, pipeline, opts...)
+	if err != nil {
+		level.Error(logger).Log("msg", "mongodb watch failed", "err", err)
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (m *MongoDb) ListCollectionNames(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) ([]string, error) {
+	names, err := m.Db.ListCollectionNames(ctx, filter, opts...)
+	if err != nil {
+		level.Error(logger).Log("msg", "mongodb listCollectionNames failed", "err", err)
+		return nil, err
+	}
+	return names, nil
+}
+
+func (m *MongoDb) RunCommand(ctx context.Context, command interface{}) (bson.Raw, error) {
+	result, err := m.Db.RunCommand(ctx, command).Raw()
+	if err != nil {
+		level.Error(logger).Log("msg", "mongodb runCommand failed", "err", err)
+		return nil, err
+	}
+	return result, nil
+}
+
 func (m *MongoCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
 	doc := m.Collection.FindOne(ctx, filter, opts...)
 	return doc, nil
@@ -85,3 +167,39 @@ func (m *MongoCollection) Aggregate(ctx context.Context, filter interface{}, opt
 	}
 	return cursor, nil
 }
+
+func (m *MongoCollection) ReplaceOne(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	result, err := m.Collection.ReplaceOne(ctx, filter, replacement, opts...)
+	if err != nil {
+		level.Error(logger).Log("msg", "mongodb replaceOne failed", "err", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (m *MongoCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	result, err := m.Collection.DeleteOne(ctx, filter, opts...)
+	if err != nil {
+		level.Error(logger).Log("msg", "mongodb deleteOne failed", "err", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (m *MongoCollection) CreateIndex(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error) {
+	name, err := m.Collection.Indexes().CreateOne(ctx, model, opts...)
+	if err != nil {
+		level.Error(logger).Log("msg", "mongodb createIndex failed", "err", err)
+		return "", err
+	}
+	return name, nil
+}
+
+func (m *MongoCollection) ListIndexSpecs(ctx context.Context) ([]*mongo.IndexSpecification, error) {
+	specs, err := m.Collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		level.Error(logger).Log("msg", "mongodb listIndexes failed", "err", err)
+		return nil, err
+	}
+	return specs, nil
+}
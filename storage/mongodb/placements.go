@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"context"
+
+	"delivery-service/placement"
+	"delivery-service/storage"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const PlacementsCollection = "placements"
+
+// ListPlacements returns the documents of the placements collection ordered by id
+func (s *CampaignStore) ListPlacements(ctx context.Context) ([]storage.Placement, error) {
+	var placements []storage.Placement
+
+	cursor, err := s.db.GetCollection(PlacementsCollection).Aggregate(ctx, bson.A{
+		bson.M{
+			"$sort": bson.M{
+				"_id": 1,
+			},
+		},
+	})
+
+	if err != nil {
+		level.Error(logger).Log("method", "ListPlacements", "msg", "mongodb aggregate failed", "err", err)
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &placements); err != nil {
+		level.Error(logger).Log("method", "ListPlacements", "msg", "error decoding cursor", "err", err)
+		return nil, err
+	}
+	return placements, nil
+}
+
+// PlacementCache returns the cache of the placements collection, expired on saves, deletes
+// and watched changes
+func (s *CampaignStore) PlacementCache() *placement.Cache {
+	return s.placements
+}
+
+// SavePlacement creates or replaces the placements document of placement
+func (s *CampaignStore) SavePlacement(ctx context.Context, placement storage.Placement) error {
+	_, err := s.db.GetCollection(PlacementsCollection).ReplaceOne(ctx, bson.M{"_id": placement.ID}, placement, options.Replace().SetUpsert(true))
+	if err != nil {
+		level.Error(logger).Log("method", "SavePlacement", "msg", "mongodb replaceOne failed", "placement", placement.ID, "err", err)
+		return err
+	}
+	s.placements.Expire()
+	return nil
+}
+
+// DeletePlacement removes the placements document of id
+func (s *CampaignStore) DeletePlacement(ctx context.Context, id string) error {
+	result, err := s.db.GetCollection(PlacementsCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		level.Error(logger).Log("method", "DeletePlacement", "msg", "mongodb deleteOne failed", "placement", id, "err", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return storage.ErrPlacementNotFound
+	}
+	s.placements.Expire()
+	return nil
+}
@@ -0,0 +1,96 @@
+package mongodb
+
+import (
+	"reflect"
+	"sync"
+
+	"delivery-service/dimensions"
+	"delivery-service/expression"
+	"delivery-service/segment"
+	"delivery-service/storage"
+)
+
+// programs caches the registry of the rules_parameters dimensions and the compiled
+// targeting expressions of the campaigns, so that requests compile the expression of
+// a campaign once per version of it instead of on every request
+type programs struct {
+	mu       sync.Mutex
+	dims     []storage.Dimension
+	registry *dimensions.Registry
+	// compiled holds, per campaign id, the expression compiled against registry
+	compiled map[string]compiledExpression
+}
+
+type compiledExpression struct {
+	source  string
+	program expression.Program
+	// segments is set when the expression references segments
+	segments bool
+}
+
+func newPrograms() *programs {
+	return &programs{compiled: make(map[string]compiledExpression)}
+}
+
+// registryOf returns the registry of dims, the cached one while the dimensions are
+// unchanged. Changed dimensions drop the compiled expressions.
+func (p *programs) registryOf(dims []storage.Dimension) *dimensions.Registry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.registry == nil || !reflect.DeepEqual(p.dims, dims) {
+		p.dims, p.registry = dims, dimensions.New(dims)
+		p.compiled = make(map[string]compiledExpression)
+	}
+	return p.registry
+}
+
+// program returns the compiled expression of campaign, compiling it when the campaign is
+// new or its expression changed. Campaigns without an expression always match and
+// expressions that do not parse never hold.
+func (p *programs) program(registry *dimensions.Registry, campaign storage.Campaign) expression.Program {
+	if campaign.Expression == "" {
+		return func(map[string]string, expression.Segments) bool { return true }
+	}
+	return p.lookup(registry, campaign).program
+}
+
+// targeted reports whether campaign may target segments, like segment.Targeted, without
+// parsing its expression again
+func (p *programs) targeted(registry *dimensions.Registry, campaign storage.Campaign) bool {
+	return campaign.Segments != nil || (campaign.Expression != "" && p.lookup(registry, campaign).segments)
+}
+
+func (p *programs) lookup(registry *dimensions.Registry, campaign storage.Campaign) compiledExpression {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c, ok := p.compiled[campaign.ID]; ok && c.source == campaign.Expression && registry == p.registry {
+		return c
+	}
+	c := compile(registry, campaign.Expression)
+	if registry == p.registry {
+		p.compiled[campaign.ID] = c
+	}
+	return c
+}
+
+// forget drops the compiled expression of a campaign, or of every campaign when id is empty
+func (p *programs) forget(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id == "" {
+		p.compiled = make(map[string]compiledExpression)
+		return
+	}
+	delete(p.compiled, id)
+}
+
+func compile(registry *dimensions.Registry, source string) compiledExpression {
+	expr, err := expression.Parse(source)
+	if err != nil {
+		return compiledExpression{source: source, program: func(map[string]string, expression.Segments) bool { return false }}
+	}
+	return compiledExpression{source: source, program: expr.Compile(registry), segments: segment.References(expr)}
+}
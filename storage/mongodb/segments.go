@@ -0,0 +1,204 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"delivery-service/storage"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	SegmentsCollection      = "segments"
+	SegmentChunksCollection = "segment_chunks"
+
+	// chunkSize is the number of members of a segment_chunks document, 8MB of hashes
+	// within the 16MB document limit
+	chunkSize = 1 << 20
+)
+
+// chunk is a segment_chunks document holding part of the members of a segment version
+type chunk struct {
+	ID      string `bson:"_id"`
+	Segment string `bson:"segment"`
+	Version int64  `bson:"version"`
+	Index   int    `bson:"index"`
+	// Hashes are the little endian member hashes
+	Hashes []byte `bson:"hashes"`
+}
+
+func chunkID(name string, version int64, index int) string {
+	return name + ":" + strconv.FormatInt(version, 10) + ":" + strconv.Itoa(index)
+}
+
+// Segments returns the segment memberships of the store, loaded on first use and
+// refreshed in the background
+func (s *CampaignStore) Segments(ctx context.Context) (storage.Segments, error) {
+	return s.segments, s.segments.Sync(ctx)
+}
+
+// ListSegments returns the documents of the segments collection ordered by name
+func (s *CampaignStore) ListSegments(ctx context.Context) ([]storage.Segment, error) {
+	var segments []storage.Segment
+
+	cursor, err := s.db.GetCollection(SegmentsCollection).Aggregate(ctx, bson.A{
+		bson.M{
+			"$sort": bson.M{
+				"_id": 1,
+			},
+		},
+	})
+
+	if err != nil {
+		level.Error(logger).Log("method", "ListSegments", "msg", "mongodb aggregate failed", "err", err)
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &segments); err != nil {
+		level.Error(logger).Log("method", "ListSegments", "msg", "error decoding cursor", "err", err)
+		return nil, err
+	}
+	return segments, nil
+}
+
+// LoadSegment returns the members of the version of a segment from its segment_chunks
+func (s *CampaignStore) LoadSegment(ctx context.Context, segment storage.Segment) ([]uint64, error) {
+	var chunks []chunk
+
+	cursor, err := s.db.GetCollection(SegmentChunksCollection).Aggregate(ctx, bson.A{
+		bson.M{
+			"$match": bson.M{
+				"segment": segment.Name,
+				"version": segment.Version,
+			},
+		},
+		bson.M{
+			"$sort": bson.M{
+				"index": 1,
+			},
+		},
+	})
+
+	if err != nil {
+		level.Error(logger).Log("method", "LoadSegment", "msg", "mongodb aggregate failed", "segment", segment.Name, "err", err)
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &chunks); err != nil {
+		level.Error(logger).Log("method", "LoadSegment", "msg", "error decoding cursor", "segment", segment.Name, "err", err)
+		return nil, err
+	}
+
+	// a segment replaced meanwhile has its chunks of this version removed
+	if len(chunks) != segment.Chunks {
+		return nil, fmt.Errorf("segment %s version %d has %d chunks, expected %d", segment.Name, segment.Version, len(chunks), segment.Chunks)
+	}
+
+	members := make([]uint64, 0, segment.Size)
+	for _, c := range chunks {
+		for i := 0; i+8 <= len(c.Hashes); i += 8 {
+			members = append(members, binary.LittleEndian.Uint64(c.Hashes[i:]))
+		}
+	}
+	return members, nil
+}
+
+// SaveSegment writes the members of a new version of the segment to segment_chunks,
+// then points the segments document to that version and removes the chunks of the
+// previous one. Readers keep loading the previous version until the switch.
+func (s *CampaignStore) SaveSegment(ctx context.Context, segment storage.Segment, members []uint64) error {
+	previous, err := s.findSegment(ctx, segment.Name)
+	if err != nil {
+		return err
+	}
+
+	segment.Version = time.Now().UnixNano()
+	segment.Size = len(members)
+	// an empty segment has an empty chunk
+	segment.Chunks = max(1, (len(members)+chunkSize-1)/chunkSize)
+
+	chunks := s.db.GetCollection(SegmentChunksCollection)
+	for index := 0; index < segment.Chunks; index++ {
+		part := members[index*chunkSize : min((index+1)*chunkSize, len(members))]
+		hashes := make([]byte, 8*len(part))
+		for i, member := range part {
+			binary.LittleEndian.PutUint64(hashes[8*i:], member)
+		}
+
+		id := chunkID(segment.Name, segment.Version, index)
+		doc := chunk{ID: id, Segment: segment.Name, Version: segment.Version, Index: index, Hashes: hashes}
+		if _, err := chunks.ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true)); err != nil {
+			level.Error(logger).Log("method", "SaveSegment", "msg", "mongodb replaceOne failed", "segment", segment.Name, "chunk", index, "err", err)
+			return err
+		}
+	}
+
+	_, err = s.db.GetCollection(SegmentsCollection).ReplaceOne(ctx, bson.M{"_id": segment.Name}, segment, options.Replace().SetUpsert(true))
+	if err != nil {
+		level.Error(logger).Log("method", "SaveSegment", "msg", "mongodb replaceOne failed", "segment", segment.Name, "err", err)
+		return err
+	}
+	s.segments.Expire()
+
+	if previous != nil {
+		s.removeChunks(ctx, *previous)
+	}
+	return nil
+}
+
+// DeleteSegment removes the segments document and then the chunks of the segment
+func (s *CampaignStore) DeleteSegment(ctx context.Context, name string) error {
+	segment, err := s.findSegment(ctx, name)
+	if err != nil {
+		return err
+	}
+	if segment == nil {
+		return storage.ErrSegmentNotFound
+	}
+
+	if _, err := s.db.GetCollection(SegmentsCollection).DeleteOne(ctx, bson.M{"_id": name}); err != nil {
+		level.Error(logger).Log("method", "DeleteSegment", "msg", "mongodb deleteOne failed", "segment", name, "err", err)
+		return err
+	}
+	s.segments.Expire()
+
+	s.removeChunks(ctx, *segment)
+	return nil
+}
+
+// findSegment returns the segments document of name, nil when there is none
+func (s *CampaignStore) findSegment(ctx context.Context, name string) (*storage.Segment, error) {
+	var segment storage.Segment
+
+	result, err := s.db.GetCollection(SegmentsCollection).FindOne(ctx, bson.M{"_id": name})
+	if err == nil {
+		err = result.Decode(&segment)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		level.Error(logger).Log("method", "findSegment", "msg", "mongodb findOne failed", "segment", name, "err", err)
+		return nil, err
+	}
+	return &segment, nil
+}
+
+// removeChunks deletes the chunks of a segment version. Chunks left over by a failure
+// are not read anymore and only take space.
+func (s *CampaignStore) removeChunks(ctx context.Context, segment storage.Segment) {
+	chunks := s.db.GetCollection(SegmentChunksCollection)
+	for index := 0; index < segment.Chunks; index++ {
+		if _, err := chunks.DeleteOne(ctx, bson.M{"_id": chunkID(segment.Name, segment.Version, index)}); err != nil {
+			level.Error(logger).Log("method", "removeChunks", "msg", "mongodb deleteOne failed", "segment", segment.Name, "chunk", index, "err", err)
+		}
+	}
+}
@@ -0,0 +1,666 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"delivery-service/dimensions"
+	"delivery-service/placement"
+	"delivery-service/ranking"
+	"delivery-service/schedule"
+	"delivery-service/segment"
+	"delivery-service/storage"
+	"delivery-service/utils"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DetailsCollection    = "campaigns_details"
+	ParametersCollection = "rules_parameters"
+	ParametersID         = "current"
+
+	// LayoutField keeps the countries of a campaign in the indexed countries field of its
+	// campaigns_details document
+	LayoutField = "field"
+	// LayoutCollections keeps the countries of a campaign as collections named after the
+	// countries listing its id. Saves also write the countries field, so that the field
+	// layout can be switched to at any time.
+	LayoutCollections = "collections"
+)
+
+type parameters struct {
+	Rules      []string            `bson:"rules"`
+	Dimensions []storage.Dimension `bson:"dimensions"`
+}
+
+// dimensions returns the dimensions of the document, built from the flat rules list
+// of documents without dimensions
+func (p parameters) dimensions() []storage.Dimension {
+	if len(p.Dimensions) > 0 {
+		return p.Dimensions
+	}
+	return storage.DimensionsFromNames(p.Rules)
+}
+
+// CampaignStore is the storage.CampaignStore reading campaigns_details and rules_parameters.
+// The countries of the campaigns are kept as selected by the layout: in campaigns_details,
+// or in one collection per country listing the ids of the campaigns delivered there.
+type CampaignStore struct {
+	db           IMongoDb
+	pollInterval time.Duration
+	layout       string
+
+	mu sync.Mutex
+	// countries holds, per campaign id, the country collections listing the campaign,
+	// in the collections layout only
+	countries map[string]map[string]struct{}
+
+	collectionsMu sync.Mutex
+	// collections maps the lower-cased names of the country collections to their names,
+	// listed at most once per pollInterval, in the collections layout only
+	collections       map[string]string
+	collectionsLoaded time.Time
+
+	// segments holds the members of the segments collection
+	segments *segment.Cache
+	// programs holds the compiled targeting expressions of the campaigns
+	programs *programs
+	// placements holds the documents of the placements collection
+	placements *placement.Cache
+}
+
+// NewCampaignStore creates a CampaignStore over db in the CAMPAIGN_LAYOUT layout. Watch
+// falls back to reloading every WATCHER_POLL_INTERVAL when change streams are not available.
+func NewCampaignStore(db IMongoDb) *CampaignStore {
+	s := &CampaignStore{
+		db:           db,
+		pollInterval: watcherPollInterval,
+		layout:       Layout,
+		countries:    make(map[string]map[string]struct{}),
+		programs:     newPrograms(),
+	}
+	s.segments = segment.NewCache(s)
+	s.placements = placement.NewCache(s)
+	return s
+}
+
+// GetParameters returns the dimensions of the rules_parameters current document
+func (s *CampaignStore) GetParameters(ctx context.Context) ([]storage.Dimension, error) {
+	var params parameters
+
+	coll := s.db.GetCollection(ParametersCollection)
+	result, err := coll.FindOne(ctx, bson.M{"_id": ParametersID})
+
+	if err != nil {
+		level.Error(logger).Log("method", "GetParameters", "msg", "mongodb findOne failed", "err", err)
+		return nil, err
+	}
+
+	if err = result.Decode(&params); err != nil {
+		level.Error(logger).Log("method", "GetParameters", "msg", "error decoding doc", "err", err)
+		return nil, err
+	}
+
+	return params.dimensions(), nil
+}
+
+// QueryCampaigns runs the targeting aggregation on the campaigns of the requested country,
+// as found in campaigns_details or in the collection of the country depending on the layout.
+// Rules of dimensions mongodb cannot compare (versions, ranges, CIDR blocks) and dayparts
+// are evaluated on the aggregation results, which are then paginated here.
+func (s *CampaignStore) QueryCampaigns(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]storage.Campaign, error) {
+	var campaigns []storage.Campaign
+
+	dims, err := s.GetParameters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	registry := s.programs.registryOf(dims)
+
+	coll := s.db.GetCollection(DetailsCollection)
+	now := time.Now()
+	filter := getCountryCampaignsFilter(registry, params, now)
+	if s.layout == LayoutCollections {
+		coll = s.db.GetCollection(s.countryCollection(ctx, params["country"]))
+		filter = getCampaignsFilter(registry, params, now)
+	}
+	cursor, err := coll.Aggregate(ctx, filter)
+
+	if err != nil {
+		level.Error(logger).Log("method", "QueryCampaigns", "msg", "mongodb aggregate failed", "err", err)
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &campaigns); err != nil {
+		level.Error(logger).Log("method", "QueryCampaigns", "msg", "error decoding cursor", "err", err)
+		return nil, err
+	}
+
+	var segments storage.Segments
+	for _, campaign := range campaigns {
+		if s.programs.targeted(registry, campaign) {
+			if segments, err = s.Segments(ctx); err != nil {
+				level.Error(logger).Log("method", "QueryCampaigns", "msg", "loading segments failed", "err", err)
+			}
+			break
+		}
+	}
+
+	return s.filterCampaigns(registry, segments, campaigns, params, userID, now, limit, offset), nil
+}
+
+// filterCampaigns returns the page at offset of the campaigns whose rules accept params,
+// whose segment targeting and expression hold and whose schedule is live at now, ranked
+// for userID
+func (s *CampaignStore) filterCampaigns(registry *dimensions.Registry, segments storage.Segments, campaigns []storage.Campaign, params map[string]string, userID string, now time.Time, limit, offset int) []storage.Campaign {
+	request := segment.RequestParams(params, userID)
+
+	var accepted []storage.Campaign
+	for _, campaign := range campaigns {
+		if registry.Accepts(campaign.Rules, params) && schedule.Live(campaign.Schedule, now) &&
+			segment.Match(campaign.Segments, segments, request) && s.programs.program(registry, campaign)(request, segments) {
+			accepted = append(accepted, campaign)
+		}
+	}
+	ranking.Rank(accepted, userID)
+
+	if limit <= 0 || offset < 0 || offset > len(accepted)/limit || limit*offset >= len(accepted) {
+		return nil
+	}
+	return accepted[limit*offset : min(limit*offset+limit, len(accepted))]
+}
+
+// ListCampaigns returns the active campaigns of campaigns_details with their countries
+func (s *CampaignStore) ListCampaigns(ctx context.Context) ([]storage.Campaign, error) {
+	var campaigns []storage.Campaign
+
+	coll := s.db.GetCollection(DetailsCollection)
+	cursor, err := coll.Aggregate(ctx, bson.A{
+		bson.M{
+			"$match": bson.M{
+				"isActive": true,
+			},
+		},
+	})
+
+	if err != nil {
+		level.Error(logger).Log("method", "ListCampaigns", "msg", "mongodb aggregate failed", "err", err)
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &campaigns); err != nil {
+		level.Error(logger).Log("method", "ListCampaigns", "msg", "error decoding cursor", "err", err)
+		return nil, err
+	}
+
+	if s.layout != LayoutCollections {
+		return campaigns, nil
+	}
+
+	countries, err := s.loadCountries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.countries = countries
+	for i := range campaigns {
+		campaigns[i].Countries = s.countriesOf(campaigns[i].ID)
+	}
+	return campaigns, nil
+}
+
+// Watch sends the changes of the campaign collections to handler until ctx is cancelled
+func (s *CampaignStore) Watch(ctx context.Context, handler storage.ChangeHandler) {
+	NewWatcher(s.db, &storeChangeHandler{store: s, handler: handler}, s.pollInterval).Run(ctx)
+}
+
+// countryCollection returns the name of the collection of country, compared without case
+// so that legacy collections named in upper case, like US, are found for normalized
+// countries. Unknown countries are returned as is.
+func (s *CampaignStore) countryCollection(ctx context.Context, country string) string {
+	s.collectionsMu.Lock()
+	defer s.collectionsMu.Unlock()
+
+	key := strings.ToLower(country)
+	if name, ok := s.collections[key]; ok {
+		return name
+	}
+	if time.Since(s.collectionsLoaded) < s.pollInterval {
+		return country
+	}
+
+	names, err := listCountryCollections(ctx, s.db)
+	if err != nil {
+		return country
+	}
+	s.collections, s.collectionsLoaded = make(map[string]string, len(names)), time.Now()
+	for _, name := range names {
+		// the lower-case collection the admin api writes wins over a legacy one
+		if _, ok := s.collections[strings.ToLower(name)]; !ok || name == strings.ToLower(name) {
+			s.collections[strings.ToLower(name)] = name
+		}
+	}
+	if name, ok := s.collections[key]; ok {
+		return name
+	}
+	return country
+}
+
+// listCountryCollections returns the names of the collections of db other than the known ones
+func listCountryCollections(ctx context.Context, db IMongoDb) ([]string, error) {
+	names, err := db.ListCollectionNames(ctx, bson.M{
+		"name": bson.M{
+			"$nin": bson.A{DetailsCollection, ParametersCollection, SegmentsCollection, SegmentChunksCollection, PlacementsCollection},
+		},
+	})
+
+	if err != nil {
+		level.Error(logger).Log("method", "listCountryCollections", "msg", "mongodb listCollectionNames failed", "err", err)
+		return nil, err
+	}
+	return names, nil
+}
+
+// loadCountries reads every country collection into a campaign id to countries map
+func (s *CampaignStore) loadCountries(ctx context.Context) (map[string]map[string]struct{}, error) {
+	return loadCountries(ctx, s.db)
+}
+
+// loadCountries reads every country collection of db into a campaign id to countries map
+func loadCountries(ctx context.Context, db IMongoDb) (map[string]map[string]struct{}, error) {
+	names, err := listCountryCollections(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	countries := make(map[string]map[string]struct{})
+	for _, country := range names {
+		var docs []struct {
+			ID string `bson:"_id"`
+		}
+
+		cursor, err := db.GetCollection(country).Aggregate(ctx, bson.A{
+			bson.M{
+				"$project": bson.M{
+					"_id": 1,
+				},
+			},
+		})
+
+		if err != nil {
+			level.Error(logger).Log("method", "loadCountries", "msg", "mongodb aggregate failed", "country", country, "err", err)
+			return nil, err
+		}
+
+		if err = cursor.All(ctx, &docs); err != nil {
+			level.Error(logger).Log("method", "loadCountries", "msg", "error decoding cursor", "country", country, "err", err)
+			return nil, err
+		}
+
+		for _, doc := range docs {
+			if countries[doc.ID] == nil {
+				countries[doc.ID] = make(map[string]struct{})
+			}
+			countries[doc.ID][country] = struct{}{}
+		}
+	}
+
+	return countries, nil
+}
+
+// countriesOf returns the sorted countries of a campaign, the caller holds the lock
+func (s *CampaignStore) countriesOf(id string) []string {
+	return sortedKeys(s.countries[id])
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ActiveCampaign returns an active campaign of campaigns_details, with its countries in
+// the field layout only
+func (s *CampaignStore) ActiveCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	campaign, err := s.findCampaign(ctx, id)
+	if err != nil {
+		level.Error(logger).Log("method", "ActiveCampaign", "msg", "mongodb findOne failed", "err", err)
+		return storage.Campaign{}, err
+	}
+	if campaign == nil || !campaign.IsActive {
+		return storage.Campaign{}, storage.ErrCampaignNotFound
+	}
+	return *campaign, nil
+}
+
+// findCampaign reads a single campaign of campaigns_details, nil when it does not exist
+func (s *CampaignStore) findCampaign(ctx context.Context, id string) (*storage.Campaign, error) {
+	var campaign storage.Campaign
+
+	result, err := s.db.GetCollection(DetailsCollection).FindOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = result.Decode(&campaign); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &campaign, nil
+}
+
+// storeChangeHandler turns the raw document changes of the campaign collections into storage changes
+type storeChangeHandler struct {
+	store   *CampaignStore
+	handler storage.ChangeHandler
+}
+
+// WatchFilter matches the changes of the collections ApplyChange processes, and of the
+// country collections, named after the ISO country codes, in the collections layout.
+// Database drops are matched for their reload.
+func (h *storeChangeHandler) WatchFilter() bson.M {
+	filters := bson.A{
+		bson.M{"ns.coll": bson.M{"$in": bson.A{DetailsCollection, ParametersCollection, SegmentsCollection, PlacementsCollection}}},
+		bson.M{"operationType": "dropDatabase"},
+	}
+	if h.store.layout == LayoutCollections {
+		filters = append(filters, bson.M{"ns.coll": primitive.Regex{Pattern: "^[A-Za-z]{2}$"}})
+	}
+	return bson.M{"$or": filters}
+}
+
+func (h *storeChangeHandler) Reload(ctx context.Context) error {
+	h.store.programs.forget("")
+	return h.handler.Reload(ctx)
+}
+
+func (h *storeChangeHandler) ApplyChange(change Change) error {
+	id := fmt.Sprint(change.ID)
+
+	switch change.Collection {
+	case DetailsCollection:
+		if change.Operation == OperationDelete {
+			h.store.programs.forget(id)
+			return h.handler.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationDelete, CampaignID: id})
+		}
+
+		var campaign storage.Campaign
+		if err := bson.Unmarshal(change.Document, &campaign); err != nil {
+			return err
+		}
+		return h.upsert(campaign)
+
+	case SegmentsCollection:
+		h.store.segments.Expire()
+		return nil
+
+	case SegmentChunksCollection:
+		return nil
+
+	case PlacementsCollection:
+		h.store.placements.Expire()
+		return nil
+
+	case ParametersCollection:
+		if id != ParametersID {
+			return nil
+		}
+		if change.Operation == OperationDelete {
+			return h.handler.ApplyChange(storage.Change{Kind: storage.ChangeParameters, Operation: storage.OperationDelete})
+		}
+
+		var params parameters
+		if err := bson.Unmarshal(change.Document, &params); err != nil {
+			return err
+		}
+		return h.handler.ApplyChange(storage.Change{Kind: storage.ChangeParameters, Operation: storage.OperationUpsert, Parameters: params.dimensions()})
+
+	default:
+		if h.store.layout != LayoutCollections {
+			return nil
+		}
+
+		country := change.Collection
+		h.store.mu.Lock()
+		if change.Operation == OperationDelete {
+			delete(h.store.countries[id], country)
+		} else {
+			if h.store.countries[id] == nil {
+				h.store.countries[id] = make(map[string]struct{})
+			}
+			h.store.countries[id][country] = struct{}{}
+		}
+		h.store.mu.Unlock()
+
+		campaign, err := h.store.findCampaign(context.Background(), id)
+		if err != nil {
+			return err
+		}
+		if campaign == nil {
+			return nil
+		}
+		return h.upsert(*campaign)
+	}
+}
+
+func (h *storeChangeHandler) upsert(campaign storage.Campaign) error {
+	if h.store.layout == LayoutCollections {
+		h.store.mu.Lock()
+		campaign.Countries = h.store.countriesOf(campaign.ID)
+		h.store.mu.Unlock()
+	}
+
+	return h.handler.ApplyChange(storage.Change{Kind: storage.ChangeCampaign, Operation: storage.OperationUpsert, Campaign: &campaign, CampaignID: campaign.ID})
+}
+
+// rulesFilter matches the include/exclude rules of param found under prefix against paramValue
+func rulesFilter(prefix, param string, paramValue interface{}) bson.M {
+	includeParam := prefix + "include" + param
+	excludeParam := prefix + "exclude" + param
+
+	return bson.M{
+		"$and": bson.A{
+			bson.M{
+				"$or": bson.A{
+					bson.M{
+						includeParam: nil,
+					},
+					bson.M{
+						includeParam: bson.M{
+							"$in": bson.A{paramValue},
+						},
+					},
+				},
+			},
+			bson.M{
+				"$or": bson.A{
+					bson.M{
+						excludeParam: nil,
+					},
+					bson.M{
+						excludeParam: bson.M{
+							"$not": bson.M{
+								"$in": bson.A{paramValue},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// getCountryCampaignsFilter builds the targeting aggregation of the request parameters at
+// now on campaigns_details, in the field layout. Like getCampaignsFilter it leaves the rules
+// of dimensions mongodb cannot compare and the dayparts to filterCampaigns.
+func getCountryCampaignsFilter(registry *dimensions.Registry, parameters map[string]string, now time.Time) bson.A {
+
+	var pipeline bson.A
+
+	pipeline = append(pipeline, bson.M{
+		"$match": bson.M{
+			"isActive":  true,
+			"countries": parameters["country"],
+		},
+	})
+
+	pipeline = append(pipeline, bson.M{
+		"$sort": bson.M{
+			"_id": 1,
+		},
+	})
+
+	return append(pipeline, targetingFilter(registry, "", parameters, now)...)
+}
+
+// getCampaignsFilter builds the targeting aggregation of the request parameters at now on
+// a country collection, in the collections layout. It leaves the rules of dimensions
+// mongodb cannot compare and the dayparts of the schedules to filterCampaigns, so it
+// returns every matching campaign with all of its campaigns_details fields.
+func getCampaignsFilter(registry *dimensions.Registry, parameters map[string]string, now time.Time) bson.A {
+
+	var pipeline bson.A
+
+	pipeline = append(pipeline, bson.M{
+		"$sort": bson.M{
+			"_id": 1,
+		},
+	})
+
+	pipeline = append(pipeline, bson.M{
+		"$lookup": bson.M{
+			"from":         DetailsCollection,
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "result",
+		},
+	})
+
+	pipeline = append(pipeline, bson.M{
+		"$match": bson.M{
+			"result.isActive": true,
+		},
+	})
+
+	pipeline = append(pipeline, bson.M{
+		"$unwind": bson.M{
+			"path":                       "$result",
+			"preserveNullAndEmptyArrays": false,
+		},
+	})
+
+	pipeline = append(pipeline, targetingFilter(registry, "result.", parameters, now)...)
+
+	// the campaigns_details document replaces the country document whole, so that every
+	// field of the campaigns is returned
+	pipeline = append(pipeline, bson.M{
+		"$replaceRoot": bson.M{
+			"newRoot": "$result",
+		},
+	})
+
+	return pipeline
+}
+
+// targetingFilter returns the stages matching the flight dates and the rules of the
+// campaigns_details documents found under prefix against the request parameters
+func targetingFilter(registry *dimensions.Registry, prefix string, parameters map[string]string, now time.Time) bson.A {
+
+	var pipeline bson.A
+
+	pipeline = append(pipeline, bson.M{
+		"$match": bson.M{
+			"$and": bson.A{
+				bson.M{
+					"$or": bson.A{
+						bson.M{
+							prefix + "schedule.startAt": nil,
+						},
+						bson.M{
+							prefix + "schedule.startAt": bson.M{
+								"$lte": now,
+							},
+						},
+					},
+				},
+				bson.M{
+					"$or": bson.A{
+						bson.M{
+							prefix + "schedule.endAt": nil,
+						},
+						bson.M{
+							prefix + "schedule.endAt": bson.M{
+								"$gt": now,
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	// clauseFilters match the expression clauses, on the same dimensions as the rules
+	var clauseFilters bson.A
+	for _, param := range utils.SortedKeys(parameters) {
+		dimension := registry.Lookup(param)
+		if !dimension.Indexed() {
+			continue
+		}
+
+		var paramValue interface{} = parameters[param]
+		if dimension.CaseInsensitive() {
+			paramValue = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(parameters[param]) + "$", Options: "i"}
+		}
+
+		pipeline = append(pipeline, bson.M{
+			"$match": rulesFilter(prefix+"rules.", param, paramValue),
+		})
+		// clause values are stored as written in the expression, the dimensions whose
+		// values are normalized beyond case are left to filterCampaigns
+		if dimension.Verbatim() {
+			clauseFilters = append(clauseFilters, rulesFilter("", param, paramValue))
+		}
+	}
+
+	// campaigns with an expression need one of its clauses to hold, the expression
+	// itself is evaluated by filterCampaigns
+	if len(clauseFilters) > 0 {
+		pipeline = append(pipeline, bson.M{
+			"$match": bson.M{
+				"$or": bson.A{
+					bson.M{
+						prefix + "expressionClauses": nil,
+					},
+					bson.M{
+						prefix + "expressionClauses": bson.M{
+							"$elemMatch": bson.M{
+								"$and": clauseFilters,
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return pipeline
+}
@@ -0,0 +1,758 @@
+package mongodb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"delivery-service/dimensions"
+	"delivery-service/mocks"
+	"delivery-service/placement"
+	"delivery-service/segment"
+	"delivery-service/storage"
+	"delivery-service/storage/mongodb"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var iMongoCollection mongodb.IMongoCollection
+
+// newStore returns a store of the collections layout over collections
+func newStore(collections map[string]mongodb.IMongoCollection) *mongodb.CampaignStore {
+	return newLayoutStore(mongodb.LayoutCollections, collections)
+}
+
+func newLayoutStore(layout string, collections map[string]mongodb.IMongoCollection) *mongodb.CampaignStore {
+	defer func(previous string) { mongodb.Layout = previous }(mongodb.Layout)
+	mongodb.Layout = layout
+
+	return mongodb.NewCampaignStore(newDb(collections))
+}
+
+func newDb(collections map[string]mongodb.IMongoCollection) mongodb.IMongoDb {
+	return mocks.MongoDbMock{
+		GetCollectionMock: func(coll_name string) mongodb.IMongoCollection {
+			if coll, ok := collections[coll_name]; ok {
+				return coll
+			}
+			return iMongoCollection
+		},
+		ListCollectionNamesMock: func(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) ([]string, error) {
+			excluded := make(map[string]bool)
+			for _, name := range filter.(bson.M)["name"].(bson.M)["$nin"].(bson.A) {
+				excluded[name.(string)] = true
+			}
+
+			var names []string
+			for name := range collections {
+				if !excluded[name] {
+					names = append(names, name)
+				}
+			}
+			return names, nil
+		},
+	}
+}
+
+// parametersOf returns a rules_parameters collection holding the given current document
+func parametersOf(doc bson.M) mongodb.IMongoCollection {
+	return mocks.MongoCollectionMock{
+		FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
+			return mongo.NewSingleResultFromDocument(doc, nil, nil), nil
+		},
+	}
+}
+
+func cursorOf(docs ...interface{}) func(context.Context, interface{}, ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	return func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+		return mongo.NewCursorFromDocuments(docs, nil, nil)
+	}
+}
+
+// lookupOf returns the aggregation of a country collection listing the campaigns_details
+// documents details: the last stage of the pipeline shapes the joined result documents
+func lookupOf(details ...bson.M) func(context.Context, interface{}, ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	return func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+		pipeline := filter.(bson.A)
+		last := pipeline[len(pipeline)-1].(bson.M)
+
+		var docs []interface{}
+		for _, result := range details {
+			switch {
+			case last["$replaceRoot"] != nil:
+				docs = append(docs, result)
+			case last["$project"] != nil:
+				doc := bson.M{"_id": result["_id"]}
+				for field := range last["$project"].(bson.M) {
+					if value, ok := result[field]; ok {
+						doc[field] = value
+					}
+				}
+				docs = append(docs, doc)
+			}
+		}
+		return mongo.NewCursorFromDocuments(docs, nil, nil)
+	}
+}
+
+// load rule parameters - success
+func TestGetParameters1(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: mocks.MongoCollectionMock{
+			FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
+				assert.Equal(t, bson.M{"_id": "current"}, filter)
+				data := bson.M{
+					"rules": bson.A{"app", "country", "os"},
+				}
+				return mongo.NewSingleResultFromDocument(data, nil, nil), nil
+			},
+		},
+	})
+
+	params, err := store.GetParameters(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, storage.DimensionsFromNames([]string{"app", "country", "os"}), params)
+}
+
+// load rule parameters - failed because mongo return some error
+func TestGetParameters2(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: mocks.MongoCollectionMock{
+			FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
+				return nil, errors.New("some error")
+			},
+		},
+	})
+
+	_, err := store.GetParameters(context.Background())
+	assert.Error(t, err)
+}
+
+// query campaigns - success, aggregation runs on the country collection
+func TestQueryCampaigns1(t *testing.T) {
+	var pipeline bson.A
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"b": mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				pipeline = filter.(bson.A)
+				return cursorOf(bson.M{"_id": "cid", "image": "image", "cta": "cta"})(ctx, filter, opts...)
+			},
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "b"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Campaign{{ID: "cid", Image: "image", Cta: "cta"}}, campaigns)
+	assert.Equal(t, bson.M{"$sort": bson.M{"_id": 1}}, pipeline[0])
+}
+
+// query campaigns - failed because mongo return some error
+func TestQueryCampaigns2(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"b": mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				return nil, errors.New("some error")
+			},
+		},
+	})
+
+	_, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "b"}, "", 10, 0)
+	assert.Error(t, err)
+}
+
+// query campaigns - success, typed dimensions are matched after the aggregation
+func TestQueryCampaigns3(t *testing.T) {
+	var pipeline bson.A
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"dimensions": bson.A{
+			bson.M{"name": "country", "type": "geo", "required": true},
+			bson.M{"name": "os_version", "type": "semver"},
+		}}),
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				pipeline = filter.(bson.A)
+				return cursorOf(
+					bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "rules": bson.M{"includeos_version": bson.A{"14.2"}}},
+					bson.M{"_id": "c2", "image": "img2", "cta": "cta2", "rules": bson.M{"includeos_version": bson.A{"15"}}},
+				)(ctx, filter, opts...)
+			},
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us", "os_version": "14.2.0"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, "c1", campaigns[0].ID)
+	assert.Equal(t, bson.M{"$replaceRoot": bson.M{"newRoot": "$result"}}, pipeline[len(pipeline)-1])
+}
+
+// query campaigns - success, campaigns outside their schedule are left out
+func TestQueryCampaigns4(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: cursorOf(
+				bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "schedule": bson.M{"startAt": past}},
+				bson.M{"_id": "c2", "image": "img2", "cta": "cta2", "schedule": bson.M{"endAt": past}},
+				bson.M{"_id": "c3", "image": "img3", "cta": "cta3", "schedule": bson.M{"dayparts": bson.A{bson.M{"days": bson.A{}, "start": "00:00", "end": "00:01"}, bson.M{"start": "00:01", "end": "00:00"}}}},
+			),
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 2)
+	assert.Equal(t, "c1", campaigns[0].ID)
+	assert.Equal(t, "c3", campaigns[1].ID)
+}
+
+// query campaigns - the campaigns returned by the pipeline are evaluated on their expression
+func TestQueryCampaigns5(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: cursorOf(
+				bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "expression": `os == "ios" and app != "com.a.b"`},
+				bson.M{"_id": "c2", "image": "img2", "cta": "cta2", "expression": `os == "android"`},
+				bson.M{"_id": "c3", "image": "img3", "cta": "cta3"},
+			),
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us", "os": "ios"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 2)
+	assert.ElementsMatch(t, []string{"c1", "c3"}, []string{campaigns[0].ID, campaigns[1].ID})
+}
+
+// query campaigns - expressions are compiled once per campaign version, a changed expression
+// is compiled again
+func TestQueryCampaigns7(t *testing.T) {
+	expression := `os == "ios"`
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				return cursorOf(bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "expression": expression})(ctx, filter, opts...)
+			},
+		},
+	})
+	params := map[string]string{"country": "us", "os": "ios"}
+
+	for i := 0; i < 2; i++ {
+		campaigns, err := store.QueryCampaigns(context.Background(), params, "", 10, 0)
+		assert.NoError(t, err)
+		assert.Len(t, campaigns, 1)
+	}
+
+	expression = `os == "android"`
+	campaigns, err := store.QueryCampaigns(context.Background(), params, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, campaigns)
+}
+
+// query campaigns - collections layout returns the placement targeting, formats and size
+// of the campaigns, so that excluded placements are not served
+func TestQueryCampaigns8(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: lookupOf(bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "isActive": true,
+				"placements": bson.M{"exclude": bson.A{"home_banner"}}, "formats": bson.A{"banner"}, "size": "320x50"}),
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, &storage.PlacementTargeting{Exclude: []string{"home_banner"}}, campaigns[0].Placements)
+	assert.Equal(t, []string{"banner"}, campaigns[0].Formats)
+	assert.Equal(t, "320x50", campaigns[0].Size)
+	assert.False(t, placement.Fits(campaigns[0], "home_banner", nil))
+	assert.True(t, placement.Fits(campaigns[0], "level_end", nil))
+}
+
+// query campaigns - collections layout returns the typed creative of the campaigns
+func TestQueryCampaigns9(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: lookupOf(bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "isActive": true, "creative": bson.M{
+				"images": bson.A{bson.M{"url": "https://img/c1-320.png", "width": 320, "height": 50}},
+				"texts":  bson.M{"pt": bson.M{"title": "Música", "cta": "Ouvir"}},
+			}}),
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, &storage.Creative{
+		Images: []storage.Image{{URL: "https://img/c1-320.png", Width: 320, Height: 50}},
+		Texts:  map[string]storage.Text{"pt": {Title: "Música", Cta: "Ouvir"}},
+	}, campaigns[0].Creative)
+}
+
+// query campaigns - collections layout returns the localized images and ctas of the campaigns
+// and their variants
+func TestQueryCampaigns10(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: lookupOf(bson.M{"_id": "c1", "image": "img1", "cta": "Download", "isActive": true,
+				"localized": bson.M{"pt": bson.M{"cta": "Baixar"}, "fr": bson.M{"image": "img1-fr", "cta": "Télécharger"}},
+				"variants":  bson.A{bson.M{"id": "b", "percent": 100, "cta": "Play", "localized": bson.M{"pt": bson.M{"cta": "Jogar"}}}},
+			}),
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, map[string]storage.Localization{"pt": {Cta: "Baixar"}, "fr": {Image: "img1-fr", Cta: "Télécharger"}}, campaigns[0].Localized)
+	assert.Len(t, campaigns[0].Variants, 1)
+	assert.Equal(t, map[string]storage.Localization{"pt": {Cta: "Jogar"}}, campaigns[0].Variants[0].Localized)
+}
+
+// query campaigns - the clauses of trimmed dimensions are left out of the prefilter, padded
+// and mixed case expression values still match
+func TestQueryCampaigns11(t *testing.T) {
+	var pipeline bson.A
+	store := newLayoutStore(mongodb.LayoutField, map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"dimensions": bson.A{
+			bson.M{"name": "country", "type": "geo", "required": true},
+			bson.M{"name": "os", "type": "string", "normalizer": "lower"},
+			bson.M{"name": "channel", "type": "string", "normalizer": "trim"},
+		}}),
+		mongodb.DetailsCollection: mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				pipeline = filter.(bson.A)
+				return cursorOf(bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "isActive": true, "countries": bson.A{"us"},
+					"expression": `channel == " web " and os == "IOS"`, "expressionClauses": bson.A{bson.M{"includechannel": bson.A{" web "}, "includeos": bson.A{"IOS"}}}})(ctx, filter, opts...)
+			},
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us", "os": "ios", "channel": "web"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+
+	clauses := pipeline[len(pipeline)-1].(bson.M)["$match"].(bson.M)["$or"].(bson.A)[1].(bson.M)["expressionClauses"].(bson.M)["$elemMatch"].(bson.M)["$and"].(bson.A)
+	assert.NotContains(t, fmt.Sprint(clauses), "includechannel")
+	assert.Contains(t, fmt.Sprint(clauses), "includeos")
+}
+
+// query campaigns - success, the country collection is found without case
+func TestQueryCampaigns12(t *testing.T) {
+	collectionOf := func(id string) mongodb.IMongoCollection {
+		return mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				return cursorOf(bson.M{"_id": id, "image": "image", "cta": "cta"})(ctx, filter, opts...)
+			},
+		}
+	}
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"US":                         collectionOf("legacy"),
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, "legacy", campaigns[0].ID)
+
+	// The lower-case collection of the admin api wins over a legacy one
+	store = newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		"US":                         collectionOf("legacy"),
+		"us":                         collectionOf("admin"),
+	})
+
+	campaigns, err = store.QueryCampaigns(context.Background(), map[string]string{"country": "us"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, "admin", campaigns[0].ID)
+}
+
+// segments - saved in chunks, loaded back and matched on the user id of the requests
+func TestSegments1(t *testing.T) {
+	var saved, chunks []interface{}
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		mongodb.SegmentsCollection: mocks.MongoCollectionMock{
+			FindOneMock: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (*mongo.SingleResult, error) {
+				return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil), nil
+			},
+			ReplaceOneMock: func(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+				saved = append(saved, replacement)
+				return &mongo.UpdateResult{UpsertedCount: 1}, nil
+			},
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				return mongo.NewCursorFromDocuments(saved, nil, nil)
+			},
+		},
+		mongodb.SegmentChunksCollection: mocks.MongoCollectionMock{
+			ReplaceOneMock: func(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+				chunks = append(chunks, replacement)
+				return &mongo.UpdateResult{UpsertedCount: 1}, nil
+			},
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				return mongo.NewCursorFromDocuments(chunks, nil, nil)
+			},
+		},
+		"us": mocks.MongoCollectionMock{
+			AggregateMock: cursorOf(
+				bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "segments": bson.M{"include": bson.A{"whales"}}},
+				bson.M{"_id": "c2", "image": "img2", "cta": "cta2", "expression": `user_id not in segment("whales")`},
+			),
+		},
+	})
+
+	err := store.SaveSegment(context.Background(), storage.Segment{Name: "whales", Dimension: "user_id"}, []uint64{segment.Hash("u1"), segment.Hash("u3")})
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 1)
+
+	segments, err := store.ListSegments(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, segments[0].Size)
+	assert.Equal(t, 1, segments[0].Chunks)
+
+	members, err := store.LoadSegment(context.Background(), segments[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{segment.Hash("u1"), segment.Hash("u3")}, members)
+
+	params := map[string]string{"country": "us", "os": "ios"}
+	campaigns, err := store.QueryCampaigns(context.Background(), params, "u1", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, "c1", campaigns[0].ID)
+
+	campaigns, err = store.QueryCampaigns(context.Background(), params, "u2", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, "c2", campaigns[0].ID)
+}
+
+// list campaigns - success, countries come from the country collections
+func TestListCampaigns1(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.DetailsCollection: mocks.MongoCollectionMock{
+			AggregateMock: cursorOf(
+				bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "isActive": true, "rules": bson.M{"includeos": bson.A{"ios"}}},
+				bson.M{"_id": "c2", "image": "img2", "cta": "cta2", "isActive": true},
+			),
+		},
+		"us": mocks.MongoCollectionMock{AggregateMock: cursorOf(bson.M{"_id": "c1"}, bson.M{"_id": "c2"})},
+		"in": mocks.MongoCollectionMock{AggregateMock: cursorOf(bson.M{"_id": "c1"})},
+	})
+
+	campaigns, err := store.ListCampaigns(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Campaign{
+		{ID: "c1", Image: "img1", Cta: "cta1", IsActive: true, Rules: map[string][]string{"includeos": {"ios"}}, Countries: []string{"in", "us"}},
+		{ID: "c2", Image: "img2", Cta: "cta2", IsActive: true, Countries: []string{"us"}},
+	}, campaigns)
+}
+
+// list campaigns - the placements collection is not a country collection
+func TestListCampaigns3(t *testing.T) {
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.DetailsCollection: mocks.MongoCollectionMock{
+			AggregateMock: cursorOf(bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "isActive": true}),
+		},
+		mongodb.PlacementsCollection: mocks.MongoCollectionMock{AggregateMock: cursorOf(bson.M{"_id": "c1", "app": "com.a.b"})},
+		"us":                         mocks.MongoCollectionMock{AggregateMock: cursorOf(bson.M{"_id": "c1"})},
+	})
+
+	campaigns, err := store.ListCampaigns(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, campaigns, 1)
+	assert.Equal(t, []string{"us"}, campaigns[0].Countries)
+}
+
+// placements - saves and deletes expire the placement cache
+func TestPlacements1(t *testing.T) {
+	lists := 0
+	store := newStore(map[string]mongodb.IMongoCollection{
+		mongodb.PlacementsCollection: mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				lists++
+				return cursorOf(bson.M{"_id": "home_banner", "app": "com.a.b"})(ctx, filter, opts...)
+			},
+			ReplaceOneMock: func(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+				return &mongo.UpdateResult{UpsertedCount: 1}, nil
+			},
+			DeleteOneMock: func(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+				return &mongo.DeleteResult{DeletedCount: 1}, nil
+			},
+		},
+	})
+	cache := store.PlacementCache()
+
+	for i := 0; i < 2; i++ {
+		_, ok, err := cache.Get(context.Background(), "home_banner")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 1, lists)
+
+	assert.NoError(t, store.SavePlacement(context.Background(), storage.Placement{ID: "home_banner", App: "com.a.b"}))
+	cache.Get(context.Background(), "home_banner")
+	assert.Equal(t, 2, lists)
+
+	assert.NoError(t, store.DeletePlacement(context.Background(), "home_banner"))
+	cache.Get(context.Background(), "home_banner")
+	assert.Equal(t, 3, lists)
+}
+
+// query campaigns - success, field layout aggregation runs on campaigns_details
+func TestQueryCampaigns6(t *testing.T) {
+	var pipeline bson.A
+	store := newLayoutStore(mongodb.LayoutField, map[string]mongodb.IMongoCollection{
+		mongodb.ParametersCollection: parametersOf(bson.M{"rules": bson.A{"app", "country", "os"}}),
+		mongodb.DetailsCollection: mocks.MongoCollectionMock{
+			AggregateMock: func(ctx context.Context, filter interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+				pipeline = filter.(bson.A)
+				return cursorOf(
+					bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "isActive": true, "countries": bson.A{"in", "us"}, "rules": bson.M{"includeos": bson.A{"ios"}}},
+				)(ctx, filter, opts...)
+			},
+		},
+	})
+
+	campaigns, err := store.QueryCampaigns(context.Background(), map[string]string{"country": "us", "os": "ios"}, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Campaign{
+		{ID: "c1", Image: "img1", Cta: "cta1", IsActive: true, Countries: []string{"in", "us"}, Rules: map[string][]string{"includeos": {"ios"}}},
+	}, campaigns)
+	assert.Equal(t, bson.M{"$match": bson.M{"isActive": true, "countries": "us"}}, pipeline[0])
+	assert.Equal(t, bson.M{"$sort": bson.M{"_id": 1}}, pipeline[1])
+}
+
+// list and save campaigns - field layout keeps the countries in campaigns_details only
+func TestListCampaigns2(t *testing.T) {
+	var saved interface{}
+	store := newLayoutStore(mongodb.LayoutField, map[string]mongodb.IMongoCollection{
+		mongodb.DetailsCollection: mocks.MongoCollectionMock{
+			AggregateMock: cursorOf(
+				bson.M{"_id": "c1", "image": "img1", "cta": "cta1", "isActive": true, "countries": bson.A{"us"}},
+			),
+			ReplaceOneMock: func(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+				saved = replacement
+				return &mongo.UpdateResult{ModifiedCount: 1}, nil
+			},
+		},
+	})
+
+	campaigns, err := store.ListCampaigns(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Campaign{{ID: "c1", Image: "img1", Cta: "cta1", IsActive: true, Countries: []string{"us"}}}, campaigns)
+
+	// a country collection would panic on the nil default collection
+	campaigns[0].Countries = []string{"de", "us"}
+	assert.NoError(t, store.SaveCampaign(context.Background(), campaigns[0]))
+
+	data, err := bson.Marshal(saved)
+	assert.NoError(t, err)
+	var doc bson.M
+	assert.NoError(t, bson.Unmarshal(data, &doc))
+	assert.Equal(t, bson.A{"de", "us"}, doc["countries"])
+}
+
+// migrate countries - country collections are copied into the countries field
+func TestMigrateCountries1(t *testing.T) {
+	replaced := make(map[string]bson.M)
+	var index mongo.IndexModel
+	db := newDb(map[string]mongodb.IMongoCollection{
+		mongodb.DetailsCollection: mocks.MongoCollectionMock{
+			AggregateMock: cursorOf(
+				bson.M{"_id": "c1", "image": "img1", "custom": "kept"},
+				bson.M{"_id": "c2", "image": "img2", "countries": bson.A{"us"}},
+				bson.M{"_id": "c3", "image": "img3", "countries": bson.A{"de"}},
+			),
+			ReplaceOneMock: func(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+				doc := replacement.(bson.M)
+				replaced[doc["_id"].(string)] = doc
+				return &mongo.UpdateResult{ModifiedCount: 1}, nil
+			},
+			CreateIndexMock: func(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error) {
+				index = model
+				return mongodb.CountriesIndex, nil
+			},
+		},
+		"us":     mocks.MongoCollectionMock{AggregateMock: cursorOf(bson.M{"_id": "c1"}, bson.M{"_id": "c2"})},
+		"IN":     mocks.MongoCollectionMock{AggregateMock: cursorOf(bson.M{"_id": "c1"}, bson.M{"_id": "gone"})},
+		"backup": mocks.MongoCollectionMock{AggregateMock: cursorOf(bson.M{"_id": "c3"})},
+	})
+
+	migration, err := mongodb.MigrateCountries(context.Background(), db, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, migration.Campaigns)
+	assert.Empty(t, replaced)
+
+	migration, err = mongodb.MigrateCountries(context.Background(), db, false)
+	assert.NoError(t, err)
+	assert.Equal(t, mongodb.Migration{Campaigns: 1, Countries: []string{"IN", "us"}, Skipped: []string{"backup"}, Orphans: []string{"gone"}}, migration)
+	assert.Len(t, replaced, 1)
+	assert.Equal(t, []string{"in", "us"}, replaced["c1"]["countries"])
+	assert.Equal(t, "kept", replaced["c1"]["custom"])
+	assert.Equal(t, bson.D{{Key: "countries", Value: 1}, {Key: "isActive", Value: 1}, {Key: "_id", Value: 1}}, index.Keys)
+}
+
+// index manager - missing indexes are found by keys and created
+func TestIndexManager1(t *testing.T) {
+	var created []mongo.IndexModel
+	store := newLayoutStore(mongodb.LayoutField, map[string]mongodb.IMongoCollection{
+		mongodb.DetailsCollection: mocks.MongoCollectionMock{
+			ListIndexSpecsMock: func(ctx context.Context) ([]*mongo.IndexSpecification, error) {
+				keys := func(doc bson.D) bson.Raw {
+					raw, _ := bson.Marshal(doc)
+					return raw
+				}
+				return []*mongo.IndexSpecification{
+					{Name: "_id_", KeysDocument: keys(bson.D{{Key: "_id", Value: int32(1)}})},
+					{Name: "active", KeysDocument: keys(bson.D{{Key: "isActive", Value: 1.0}})},
+					{Name: "countries", KeysDocument: keys(bson.D{{Key: "countries", Value: 1}})},
+				}, nil
+			},
+			CreateIndexMock: func(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error) {
+				created = append(created, model)
+				return *model.Options.Name, nil
+			},
+		},
+	})
+	registry := dimensions.New(storage.DimensionsFromNames([]string{"app", "country", "os", "os_version"}))
+	manager := mongodb.NewIndexManager(store)
+
+	var names []string
+	for _, index := range manager.Required(registry) {
+		names = append(names, index.Name)
+	}
+	assert.Equal(t, []string{"_id_", "isActive", mongodb.CountriesIndex, "rules.includeapp", "rules.includecountry", "rules.includeos"}, names)
+
+	missing, err := manager.Ensure(context.Background(), registry)
+	assert.NoError(t, err)
+	assert.Len(t, missing, 4)
+	assert.Equal(t, mongodb.CountriesIndex, missing[0].Name)
+	assert.Len(t, created, 4)
+	assert.Equal(t, bson.D{{Key: "rules.includeos", Value: 1}}, created[3].Keys)
+}
+
+// index manager - collection scans are found in the winning plans of the explained pipeline
+func TestIndexManager2(t *testing.T) {
+	var explained bson.D
+	plan := bson.M{"stages": bson.A{
+		bson.M{"$cursor": bson.M{"queryPlanner": bson.M{
+			"winningPlan":   bson.D{{Key: "stage", Value: "FETCH"}, {Key: "inputStage", Value: bson.M{"stage": "IXSCAN", "indexName": mongodb.CountriesIndex}}},
+			"rejectedPlans": bson.A{bson.M{"stage": "COLLSCAN"}},
+		}}},
+		bson.M{"$sort": bson.M{"sortKey": bson.M{"_id": 1}}},
+	}}
+	db := newDb(map[string]mongodb.IMongoCollection{})
+	mock := db.(mocks.MongoDbMock)
+	mock.RunCommandMock = func(ctx context.Context, command interface{}) (bson.Raw, error) {
+		explained = command.(bson.D)
+		return bson.Marshal(plan)
+	}
+	manager := mongodb.NewIndexManager(mongodb.NewCampaignStore(mock))
+	registry := dimensions.New(storage.DimensionsFromNames([]string{"app", "country", "os"}))
+
+	result, err := manager.Explain(context.Background(), registry, map[string]string{"country": "us", "os": "ios"})
+	assert.NoError(t, err)
+	assert.Equal(t, mongodb.Plan{Collection: mongodb.DetailsCollection, Stages: []string{"FETCH", "IXSCAN"}}, result)
+	assert.False(t, result.CollScan())
+	assert.Equal(t, "explain", explained[0].Key)
+
+	plan = bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{"queryPlan": bson.M{"stage": "COLLSCAN"}}}}
+	result, err = manager.Explain(context.Background(), registry, map[string]string{"country": "us"})
+	assert.NoError(t, err)
+	assert.True(t, result.CollScan())
+}
+
+// reloadCounter is a mongodb.ChangeHandler counting its reloads
+type reloadCounter struct {
+	mu      sync.Mutex
+	reloads int
+}
+
+func (r *reloadCounter) Reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reloads++
+	return nil
+}
+
+func (r *reloadCounter) ApplyChange(change mongodb.Change) error {
+	return nil
+}
+
+func (r *reloadCounter) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloads
+}
+
+// watch - change streams only carry the changes of the campaign collections, and of the country collections in the collections layout
+func TestWatch1(t *testing.T) {
+	for layout, countries := range map[string]bool{mongodb.LayoutField: false, mongodb.LayoutCollections: true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var pipeline bson.A
+		db := newDb(map[string]mongodb.IMongoCollection{})
+		mock := db.(mocks.MongoDbMock)
+		mock.WatchMock = func(ctx context.Context, p interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+			pipeline = p.(bson.A)
+			cancel()
+			return nil, errors.New("no replica set")
+		}
+
+		defer func(previous string) { mongodb.Layout = previous }(mongodb.Layout)
+		mongodb.Layout = layout
+		mongodb.NewCampaignStore(mock).Watch(ctx, nil)
+
+		assert.Len(t, pipeline, 1)
+		filters := pipeline[0].(bson.M)["$match"].(bson.M)["$or"].(bson.A)
+		assert.Contains(t, filters, bson.M{"ns.coll": bson.M{"$in": bson.A{mongodb.DetailsCollection, mongodb.ParametersCollection, mongodb.SegmentsCollection, mongodb.PlacementsCollection}}})
+		assert.Equal(t, countries, len(filters) == 3, layout)
+	}
+}
+
+// watcher - polls once change streams keep failing and tries them again after a doubling number of polls
+func TestWatcher1(t *testing.T) {
+	var mu sync.Mutex
+	var watches []int
+	handler := &reloadCounter{}
+	db := newDb(map[string]mongodb.IMongoCollection{})
+	mock := db.(mocks.MongoDbMock)
+	mock.WatchMock = func(ctx context.Context, p interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		watches = append(watches, handler.count())
+		return nil, errors.New("no replica set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mongodb.NewWatcher(mock, handler, 5*time.Millisecond).Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(watches) >= 5
+	}, 10*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// no reload before the third failure, reloads by polling before each retry
+	assert.Equal(t, []int{0, 0, 0}, watches[:3])
+	assert.Greater(t, watches[3], watches[2])
+	assert.Greater(t, watches[4]-watches[3], watches[3]-watches[2])
+}
@@ -0,0 +1,220 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"delivery-service/metrics"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OperationInsert  = "insert"
+	OperationUpdate  = "update"
+	OperationReplace = "replace"
+	OperationDelete  = "delete"
+
+	watchModeStream = "stream"
+	watchModePoll   = "poll"
+
+	// retryPolls is the number of poll intervals before change streams are tried again
+	retryPolls = 10
+	// maxRetryInterval caps the doubling time between two change stream retries
+	maxRetryInterval = time.Hour
+)
+
+// Change is a single document change in a watched database
+type Change struct {
+	Collection string
+	Operation  string
+	ID         interface{}
+	// Document is the full document after the change, nil for deletes
+	Document bson.Raw
+}
+
+// ChangeHandler receives the changes observed by a Watcher
+type ChangeHandler interface {
+	// Reload replaces the whole cached state with the current database content
+	Reload(ctx context.Context) error
+	// ApplyChange applies a single document change to the cached state
+	ApplyChange(change Change) error
+}
+
+// CollectionFilter is implemented by the ChangeHandlers processing the changes of some
+// collections only, the changes of the others are left out of the change streams
+type CollectionFilter interface {
+	// WatchFilter returns the $match filter of the change events the handler processes
+	WatchFilter() bson.M
+}
+
+// Watcher keeps a ChangeHandler in sync with a database using change streams, falling
+// back to periodic reloads when change streams are not available and trying them again
+// after a doubling number of poll intervals
+type Watcher struct {
+	db           IMongoDb
+	handler      ChangeHandler
+	pollInterval time.Duration
+	// retries is the number of consecutive change stream failures before polling
+	retries int
+}
+
+type changeEvent struct {
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	Ns            struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID interface{} `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+// NewWatcher creates a Watcher applying the changes of db to handler
+func NewWatcher(db IMongoDb, handler ChangeHandler, pollInterval time.Duration) *Watcher {
+	return &Watcher{
+		db:           db,
+		handler:      handler,
+		pollInterval: pollInterval,
+		retries:      3,
+	}
+}
+
+// Run watches the database until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	var resumeToken bson.Raw
+	failures := 0
+	retryAfter := retryPolls * w.pollInterval
+
+	for ctx.Err() == nil {
+		token, err := w.stream(ctx, resumeToken)
+		if token != nil {
+			resumeToken = token
+			failures = 0
+			retryAfter = retryPolls * w.pollInterval
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// the stream was invalidated, start over from a full reload
+			resumeToken = nil
+			continue
+		}
+
+		failures++
+		level.Error(logger).Log("method", "Watcher.Run", "msg", "change stream failed", "failures", failures, "err", err)
+		if failures >= w.retries {
+			level.Info(logger).Log("method", "Watcher.Run", "msg", "change streams unavailable, polling", "interval", w.pollInterval, "retryAfter", retryAfter)
+			w.poll(ctx, retryAfter)
+
+			// a single failure of the next attempt goes back to polling, for longer
+			failures = w.retries - 1
+			retryAfter = min(2*retryAfter, maxRetryInterval)
+			resumeToken = nil
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// stream applies change stream events resuming after resumeToken, if any,
+// and returns the token of the last applied event
+func (w *Watcher) stream(ctx context.Context, resumeToken bson.Raw) (bson.Raw, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+
+	pipeline := bson.A{}
+	if filter, ok := w.handler.(CollectionFilter); ok {
+		pipeline = append(pipeline, bson.M{"$match": filter.WatchFilter()})
+	}
+
+	stream, err := w.db.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close(context.Background())
+
+	// changes made before the stream was opened are picked up by a full reload
+	if resumeToken == nil {
+		if err := w.handler.Reload(ctx); err != nil {
+			return nil, err
+		}
+		metrics.WatcherChangesApplied.With("mode", watchModeStream, "operation", "reload").Add(1)
+	}
+
+	var applied bson.Raw
+	for stream.Next(ctx) {
+		var event changeEvent
+		if err := stream.Decode(&event); err != nil {
+			level.Error(logger).Log("method", "Watcher.stream", "msg", "error decoding change event", "err", err)
+			continue
+		}
+
+		if err := w.apply(ctx, event); err != nil {
+			level.Error(logger).Log("method", "Watcher.stream", "msg", "error applying change", "coll", event.Ns.Coll, "err", err)
+		}
+
+		applied = stream.ResumeToken()
+		metrics.WatcherLastEvent.Set(float64(event.ClusterTime.T))
+		metrics.WatcherLag.Set(time.Since(time.Unix(int64(event.ClusterTime.T), 0)).Seconds())
+	}
+
+	return applied, stream.Err()
+}
+
+func (w *Watcher) apply(ctx context.Context, event changeEvent) error {
+	metrics.WatcherChangesApplied.With("mode", watchModeStream, "operation", event.OperationType).Add(1)
+
+	switch event.OperationType {
+	case OperationInsert, OperationUpdate, OperationReplace:
+		// the document was deleted again before the update lookup ran
+		if event.FullDocument == nil {
+			return w.handler.ApplyChange(Change{Collection: event.Ns.Coll, Operation: OperationDelete, ID: event.DocumentKey.ID})
+		}
+		return w.handler.ApplyChange(Change{Collection: event.Ns.Coll, Operation: event.OperationType, ID: event.DocumentKey.ID, Document: event.FullDocument})
+	case OperationDelete:
+		return w.handler.ApplyChange(Change{Collection: event.Ns.Coll, Operation: OperationDelete, ID: event.DocumentKey.ID})
+	default:
+		// drop, rename and invalidate events leave no way to patch the cache
+		return w.handler.Reload(ctx)
+	}
+}
+
+// poll reloads the handler every poll interval for d or until ctx is cancelled
+func (w *Watcher) poll(ctx context.Context, d time.Duration) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(d)
+	defer timeout.Stop()
+
+	lastReload := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			return
+		case <-ticker.C:
+		}
+
+		if err := w.handler.Reload(ctx); err != nil {
+			level.Error(logger).Log("method", "Watcher.poll", "msg", "reload failed", "err", err)
+			continue
+		}
+
+		metrics.WatcherChangesApplied.With("mode", watchModePoll, "operation", "reload").Add(1)
+		metrics.WatcherLag.Set(time.Since(lastReload).Seconds())
+		lastReload = time.Now()
+	}
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	ChangeCampaign   = "campaign"
+	ChangeParameters = "parameters"
+
+	OperationUpsert = "upsert"
+	OperationDelete = "delete"
+
+	// TypeString dimensions match values exactly
+	TypeString = "string"
+	// TypeEnum dimensions match values case-insensitively, optionally among a fixed set
+	TypeEnum = "enum"
+	// TypeVersion dimensions compare semantic versions
+	TypeVersion = "semver"
+	// TypeInt dimensions match integers against values or min-max ranges
+	TypeInt = "int"
+	// TypeCIDR dimensions match IP addresses against CIDR blocks
+	TypeCIDR = "cidr"
+	// TypeGeo dimensions match ISO 3166-1 alpha-2 country codes case-insensitively
+	TypeGeo = "geo"
+	// TypeRegion dimensions match ISO 3166-2 subdivision codes case-insensitively
+	TypeRegion = "region"
+	// TypeCity dimensions match city names regardless of case and spacing
+	TypeCity = "city"
+	// TypePoint dimensions match lat,long positions against lat,long,radius areas
+	TypePoint = "point"
+	// TypeLanguage dimensions match BCP 47 language tags against tags and their prefixes,
+	// pt matching pt-BR, case-insensitively
+	TypeLanguage = "language"
+)
+
+// Dimension is a request parameter campaigns can be targeted on, as registered in rules_parameters
+type Dimension struct {
+	Name string `json:"name" bson:"name"`
+	// Type selects how request values are compared to rule values, the built-in
+	// defaults of the dimension name apply when it is empty
+	Type     string `json:"type,omitempty" bson:"type,omitempty"`
+	Required bool   `json:"required,omitempty" bson:"required,omitempty"`
+	// Normalizer is applied to request and rule values before comparing: lower, upper or trim
+	Normalizer string `json:"normalizer,omitempty" bson:"normalizer,omitempty"`
+	// Values lists the accepted rule values of enum dimensions, any value when empty
+	Values []string `json:"values,omitempty" bson:"values,omitempty"`
+	// Pattern is a regular expression rule values must match
+	Pattern string `json:"pattern,omitempty" bson:"pattern,omitempty"`
+}
+
+// DimensionsFromNames returns the dimensions of a flat rules_parameters.rules list,
+// which get the built-in defaults of their names
+func DimensionsFromNames(names []string) []Dimension {
+	dimensions := make([]Dimension, 0, len(names))
+	for _, name := range names {
+		dimensions = append(dimensions, Dimension{Name: name})
+	}
+	return dimensions
+}
+
+// Campaign is a campaign with its targeting rules as kept by a CampaignStore
+type Campaign struct {
+	ID       string              `json:"_id" bson:"_id"`
+	Image    string              `json:"image" bson:"image"`
+	Cta      string              `json:"cta" bson:"cta"`
+	IsActive bool                `json:"isActive" bson:"isActive"`
+	Rules    map[string][]string `json:"rules,omitempty" bson:"rules,omitempty"`
+	// Expression is an optional boolean targeting expression the requests must also satisfy
+	Expression string `json:"expression,omitempty" bson:"expression,omitempty"`
+	// Priority is the ranking tier of the campaign, higher tiers come first
+	Priority int `json:"priority,omitempty" bson:"priority,omitempty"`
+	// Weight is the share of the campaign within its tier, 1 when not set
+	Weight float64 `json:"weight,omitempty" bson:"weight,omitempty"`
+	// Schedule limits delivery of an active campaign to its flight dates and dayparts
+	Schedule *Schedule `json:"schedule,omitempty" bson:"schedule,omitempty"`
+	// Variants are the creative variants of an experiment on the campaign, users are split
+	// between them and get the campaign Image and Cta when there is none
+	Variants []Variant `json:"variants,omitempty" bson:"variants,omitempty"`
+	// FrequencyCap limits the impressions of the campaign per user, no limit when nil
+	FrequencyCap *FrequencyCap `json:"frequencyCap,omitempty" bson:"frequencyCap,omitempty"`
+	// Budget limits the impressions of the campaign per day and over its lifetime, no limit when nil
+	Budget *Budget `json:"budget,omitempty" bson:"budget,omitempty"`
+	// Segments includes or excludes the members of audience segments
+	Segments *SegmentTargeting `json:"segments,omitempty" bson:"segments,omitempty"`
+	// Countries lists the lower case codes of the countries the campaign is delivered in
+	Countries []string `json:"countries,omitempty" bson:"countries,omitempty"`
+	// Placements includes or excludes placements by id
+	Placements *PlacementTargeting `json:"placements,omitempty" bson:"placements,omitempty"`
+	// Formats lists the creative formats of the campaign, it is only delivered to the
+	// placements showing one of them, to any placement when empty
+	Formats []string `json:"formats,omitempty" bson:"formats,omitempty"`
+	// Size is the WIDTHxHEIGHT size of the creative, it is only delivered to the placements
+	// of that size or without one, to any placement when empty
+	Size string `json:"size,omitempty" bson:"size,omitempty"`
+	// Creative holds the typed assets of the campaign, on top of its Image and Cta
+	Creative *Creative `json:"creative,omitempty" bson:"creative,omitempty"`
+	// Localized overrides the Image and Cta by BCP 47 language tag, like pt or pt-BR
+	Localized map[string]Localization `json:"localized,omitempty" bson:"localized,omitempty"`
+}
+
+// Localization overrides the image and the cta of a campaign or a variant in one language,
+// empty fields keep theirs
+type Localization struct {
+	Image string `json:"image,omitempty" bson:"image,omitempty"`
+	Cta   string `json:"cta,omitempty" bson:"cta,omitempty"`
+}
+
+// Creative is the typed creative of a campaign, its image and texts are picked for the
+// screen and the language of each request
+type Creative struct {
+	// Images are the creative image at several resolutions
+	Images []Image `json:"images,omitempty" bson:"images,omitempty"`
+	Video  *Video  `json:"video,omitempty" bson:"video,omitempty"`
+	// HTML is the url of an html or playable creative
+	HTML string `json:"html,omitempty" bson:"html,omitempty"`
+	// Texts are the localized texts of the creative by BCP 47 language tag, like en or pt-BR
+	Texts    map[string]Text `json:"texts,omitempty" bson:"texts,omitempty"`
+	Tracking *Tracking       `json:"tracking,omitempty" bson:"tracking,omitempty"`
+}
+
+// Image is an image asset, its size in pixels
+type Image struct {
+	URL    string `json:"url" bson:"url"`
+	Width  int    `json:"width" bson:"width"`
+	Height int    `json:"height" bson:"height"`
+}
+
+// Video is a video asset, its size in pixels
+type Video struct {
+	URL      string `json:"url" bson:"url"`
+	MimeType string `json:"mimeType" bson:"mimeType"`
+	// Duration is the length of the video in seconds
+	Duration float64 `json:"duration" bson:"duration"`
+	Width    int     `json:"width,omitempty" bson:"width,omitempty"`
+	Height   int     `json:"height,omitempty" bson:"height,omitempty"`
+}
+
+// Text is the copy of a creative in one language, an empty Cta keeps the campaign one
+type Text struct {
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	Cta         string `json:"cta,omitempty" bson:"cta,omitempty"`
+}
+
+// Tracking lists the urls the app calls when the creative is shown and clicked
+type Tracking struct {
+	Impressions []string `json:"impressions,omitempty" bson:"impressions,omitempty"`
+	Clicks      []string `json:"clicks,omitempty" bson:"clicks,omitempty"`
+}
+
+// Variant is a creative variant of a campaign receiving Percent percent of the users
+type Variant struct {
+	ID      string  `json:"id" bson:"id"`
+	Image   string  `json:"image" bson:"image"`
+	Cta     string  `json:"cta" bson:"cta"`
+	Percent float64 `json:"percent" bson:"percent"`
+	// Localized overrides the Image and Cta by language tag, like the campaign ones
+	Localized map[string]Localization `json:"localized,omitempty" bson:"localized,omitempty"`
+}
+
+// FrequencyCap is the maximum number of impressions of a campaign per user within a sliding window
+type FrequencyCap struct {
+	Impressions int `json:"impressions" bson:"impressions"`
+	// Window is a duration like 24h or 30m
+	Window string `json:"window" bson:"window"`
+}
+
+// Budget holds the impression and spend limits of a campaign, zero limits are not set.
+// Spend limits are converted to impressions with the CPM.
+type Budget struct {
+	DailyImpressions    int     `json:"dailyImpressions,omitempty" bson:"dailyImpressions,omitempty"`
+	LifetimeImpressions int     `json:"lifetimeImpressions,omitempty" bson:"lifetimeImpressions,omitempty"`
+	DailySpend          float64 `json:"dailySpend,omitempty" bson:"dailySpend,omitempty"`
+	LifetimeSpend       float64 `json:"lifetimeSpend,omitempty" bson:"lifetimeSpend,omitempty"`
+	// CPM is the cost of a thousand impressions
+	CPM float64 `json:"cpm,omitempty" bson:"cpm,omitempty"`
+	// Pacing is asap (default) to deliver as fast as possible, or even to spread the
+	// daily impressions over the day
+	Pacing string `json:"pacing,omitempty" bson:"pacing,omitempty"`
+}
+
+// SegmentTargeting lists the audience segments of a campaign by name. Requests must be
+// in one of the Include segments, when there are any, and in none of the Exclude segments.
+type SegmentTargeting struct {
+	Include []string `json:"include,omitempty" bson:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty" bson:"exclude,omitempty"`
+}
+
+// PlacementTargeting lists the placements of a campaign by id. Requests must be for one of
+// the Include placements, when there are any, and for none of the Exclude placements.
+type PlacementTargeting struct {
+	Include []string `json:"include,omitempty" bson:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty" bson:"exclude,omitempty"`
+}
+
+// Placement is a slot of an app campaigns are shown in, like an interstitial or a banner
+type Placement struct {
+	ID string `json:"id" bson:"_id"`
+	// App is the app id of the placement, requests for other apps cannot use it
+	App string `json:"app" bson:"app"`
+	// Formats lists the creative formats the placement shows, any format when empty
+	Formats []string `json:"formats,omitempty" bson:"formats,omitempty"`
+	// Size is the WIDTHxHEIGHT size of the slot, any size when empty
+	Size string `json:"size,omitempty" bson:"size,omitempty"`
+	// MaxCampaigns caps the campaigns returned for the placement, no cap when 0
+	MaxCampaigns int `json:"maxCampaigns,omitempty" bson:"maxCampaigns,omitempty"`
+}
+
+// Segment is a named list of values of a request dimension, like device ids or app
+// bundles, too large to be listed in the rules of campaigns
+type Segment struct {
+	Name string `json:"name" bson:"_id"`
+	// Dimension is the request parameter the members are values of, user_id for the user
+	// or device id of the request
+	Dimension string `json:"dimension" bson:"dimension"`
+	// Size is the number of distinct members
+	Size      int       `json:"size" bson:"size"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+	// Version changes whenever the members are replaced
+	Version int64 `json:"-" bson:"version"`
+	// Chunks is the number of chunks the members are stored in
+	Chunks int `json:"-" bson:"chunks"`
+}
+
+// Schedule is the delivery schedule of a campaign
+type Schedule struct {
+	// StartAt and EndAt are the flight dates, the campaign is delivered from StartAt until EndAt
+	StartAt *time.Time `json:"startAt,omitempty" bson:"startAt,omitempty"`
+	EndAt   *time.Time `json:"endAt,omitempty" bson:"endAt,omitempty"`
+	// Timezone is the IANA timezone of the dayparts, the service default when empty
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	// Dayparts are the weekly windows of delivery, any time when empty
+	Dayparts []Daypart `json:"dayparts,omitempty" bson:"dayparts,omitempty"`
+}
+
+// Daypart is a weekly delivery window from Start to End (HH:MM) on the given days
+// (mon to sun, every day when empty). A window ending before it starts ends the next day.
+type Daypart struct {
+	Days  []string `json:"days,omitempty" bson:"days,omitempty"`
+	Start string   `json:"start" bson:"start"`
+	End   string   `json:"end" bson:"end"`
+}
+
+// CampaignStore is a backend holding campaigns and the rule parameters accepted in requests
+type CampaignStore interface {
+	// GetParameters returns the dimensions accepted in requests
+	GetParameters(ctx context.Context) ([]Dimension, error)
+	// QueryCampaigns returns the active campaigns matching the targeting params, ranked for userID
+	QueryCampaigns(ctx context.Context, params map[string]string, userID string, limit, offset int) ([]Campaign, error)
+	// ListCampaigns returns every active campaign
+	ListCampaigns(ctx context.Context) ([]Campaign, error)
+	// ActiveCampaign returns an active campaign without its countries, ErrCampaignNotFound
+	// when it does not exist or is not active
+	ActiveCampaign(ctx context.Context, id string) (Campaign, error)
+}
+
+// ErrCampaignNotFound is returned for unknown campaign ids
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+// CampaignAdmin is implemented by stores supporting campaign management
+type CampaignAdmin interface {
+	CampaignStore
+	// FindCampaigns returns every campaign, active or not, ordered by id
+	FindCampaigns(ctx context.Context) ([]Campaign, error)
+	// GetCampaign returns a campaign, active or not
+	GetCampaign(ctx context.Context, id string) (Campaign, error)
+	// SaveCampaign creates or replaces a campaign along with the countries it is delivered in
+	SaveCampaign(ctx context.Context, campaign Campaign) error
+	// DeleteCampaign removes a campaign from every country and then the campaign itself
+	DeleteCampaign(ctx context.Context, id string) error
+}
+
+// ErrSegmentNotFound is returned for unknown segment names
+var ErrSegmentNotFound = errors.New("segment not found")
+
+// SegmentStore is implemented by stores keeping audience segments. Members are kept as
+// the sorted 64-bit hashes of their normalized values.
+type SegmentStore interface {
+	// ListSegments returns every segment, without members, ordered by name
+	ListSegments(ctx context.Context) ([]Segment, error)
+	// LoadSegment returns the hashed members of the version of a segment
+	LoadSegment(ctx context.Context, segment Segment) ([]uint64, error)
+	// SaveSegment creates or replaces a segment with its hashed members
+	SaveSegment(ctx context.Context, segment Segment, members []uint64) error
+	// DeleteSegment removes a segment and its members
+	DeleteSegment(ctx context.Context, name string) error
+}
+
+// ErrPlacementNotFound is returned for unknown placement ids
+var ErrPlacementNotFound = errors.New("placement not found")
+
+// PlacementSource is implemented by stores keeping placements
+type PlacementSource interface {
+	// ListPlacements returns every placement ordered by id
+	ListPlacements(ctx context.Context) ([]Placement, error)
+}
+
+// PlacementStore is implemented by stores supporting placement management
+type PlacementStore interface {
+	PlacementSource
+	// SavePlacement creates or replaces a placement
+	SavePlacement(ctx context.Context, placement Placement) error
+	// DeletePlacement removes a placement, ErrPlacementNotFound when it does not exist
+	DeletePlacement(ctx context.Context, id string) error
+}
+
+// Segments resolves the memberships of audience segments
+type Segments interface {
+	// Contains reports whether the normalized value is a member of the segment name
+	Contains(name, value string) bool
+	// Dimension returns the dimension of the segment name, false when it is unknown
+	Dimension(name string) (string, bool)
+}
+
+// SegmentSource is implemented by stores resolving the segments of their campaigns
+type SegmentSource interface {
+	// Segments returns the segment memberships, loaded on first use
+	Segments(ctx context.Context) (Segments, error)
+}
+
+// Change is a change of a campaign or of the rule parameters
+type Change struct {
+	Kind      string
+	Operation string
+	// Campaign is the campaign after the change, set for campaign upserts
+	Campaign *Campaign
+	// CampaignID is the id of the changed campaign
+	CampaignID string
+	// Parameters are the dimensions after the change, set for parameter upserts
+	Parameters []Dimension
+}
+
+// ChangeHandler receives the changes of a watched CampaignStore
+type ChangeHandler interface {
+	// Reload replaces the whole cached state with the current store content
+	Reload(ctx context.Context) error
+	// ApplyChange applies a single change to the cached state
+	ApplyChange(change Change) error
+}
+
+// Watcher is implemented by stores able to notify their changes
+type Watcher interface {
+	// Watch sends the store changes to handler until ctx is cancelled
+	Watch(ctx context.Context, handler ChangeHandler)
+}
@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"context"
+	local_error "delivery-service/errors"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"delivery-service/endpoints"
+	"delivery-service/metrics"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	adminCampaignsUrl  = "/v1/admin/campaigns"
+	adminCampaignUrl   = adminCampaignsUrl + "/{id}"
+	adminValidateUrl   = "/v1/admin/validate"
+	adminSegmentsUrl   = "/v1/admin/segments"
+	adminSegmentUrl    = adminSegmentsUrl + "/{name}"
+	adminPlacementsUrl = "/v1/admin/placements"
+	adminPlacementUrl  = adminPlacementsUrl + "/{id}"
+
+	// maxSegmentUpload bounds the body of a segment upload, about 25 million device ids
+	maxSegmentUpload = 1 << 30
+)
+
+// DecodeNoRequest decodes admin requests without parameters
+func DecodeNoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+	return nil, nil
+}
+
+// DecodeCampaignIDRequest decodes admin requests addressing a campaign by the id path segment
+func DecodeCampaignIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+	return endpoints.CampaignIDRequest{ID: r.PathValue("id")}, nil
+}
+
+// DecodeCampaignRequest decodes a campaign JSON body, the id path segment wins over the body id
+func DecodeCampaignRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+
+	var request endpoints.CampaignRequest
+	if err := decodeJSONBody(r, &request.Campaign); err != nil {
+		return nil, err
+	}
+
+	if id := r.PathValue("id"); id != "" {
+		request.Campaign.ID = id
+	}
+	return request, nil
+}
+
+// DecodeRulesRequest decodes the JSON include/exclude rules of the addressed campaign
+func DecodeRulesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+
+	request := endpoints.RulesRequest{ID: r.PathValue("id")}
+	if err := decodeJSONBody(r, &request.Rules); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// DecodeSegmentRequest decodes admin requests addressing a segment by the name path segment
+func DecodeSegmentRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+	return endpoints.SegmentRequest{Name: r.PathValue("name")}, nil
+}
+
+// DecodeUploadSegmentRequest decodes a segment upload, the members are read from the
+// body by the service, one per line
+func DecodeUploadSegmentRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+
+	dimension := r.URL.Query().Get("dimension")
+	if dimension == "" {
+		return nil, &local_error.ErrMissingParams{Param: "dimension", Method: r.Method}
+	}
+	return endpoints.UploadSegmentRequest{
+		Name:      r.PathValue("name"),
+		Dimension: dimension,
+		Members:   http.MaxBytesReader(nil, r.Body, maxSegmentUpload),
+	}, nil
+}
+
+// DecodePlacementRequest decodes admin requests addressing a placement by the id path segment
+func DecodePlacementRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+	return endpoints.PlacementRequest{ID: r.PathValue("id")}, nil
+}
+
+// DecodeSavePlacementRequest decodes a placement JSON body, the id path segment wins over the body id
+func DecodeSavePlacementRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+
+	var request endpoints.SavePlacementRequest
+	if err := decodeJSONBody(r, &request.Placement); err != nil {
+		return nil, err
+	}
+	request.Placement.ID = r.PathValue("id")
+	return request, nil
+}
+
+// EncodeAdminResponse encodes admin responses as JSON, with 201 for created resources
+// and 204 for responses without content
+func EncodeAdminResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	statusCode := http.StatusOK
+	switch resp := response.(type) {
+	case endpoints.CreatedResponse:
+		statusCode = http.StatusCreated
+		response = resp.Response
+	case endpoints.EmptyResponse:
+		statusCode = http.StatusNoContent
+		response = nil
+	}
+
+	method, _ := ctx.Value(httptransport.ContextKeyRequestMethod).(string)
+	level.Info(logger).Log("api", "RESPONSE", "httpMethod", method, "httpStatusCode", statusCode)
+	metrics.HttpRequestCount.With("method", method, "code", strconv.Itoa(statusCode)).Add(1)
+
+	if response == nil {
+		w.WriteHeader(statusCode)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	return json.NewEncoder(w).Encode(response)
+}
+
+// EncodeAdminErrorResponse encodes admin errors, unexpected errors become 500 responses
+func EncodeAdminErrorResponse(ctx context.Context, err error, w http.ResponseWriter) {
+	method, _ := ctx.Value(httptransport.ContextKeyRequestMethod).(string)
+
+	statusCode := http.StatusInternalServerError
+	message := "internal error"
+	if localError, ok := err.(local_error.Error); ok {
+		statusCode = localError.GetCode()
+		message = localError.Error()
+	}
+
+	level.Info(logger).Log("api", "RESPONSE", "httpMethod", method, "httpStatusCode", statusCode, "err", err)
+	metrics.HttpRequestCount.With("method", method, "code", strconv.Itoa(statusCode)).Add(1)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// NewAdminHTTPHandler creates the HTTP handler of the campaign management API
+func NewAdminHTTPHandler(eps endpoints.AdminEndpoints) http.Handler {
+	options := []httptransport.ServerOption{
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+		httptransport.ServerErrorEncoder(EncodeAdminErrorResponse),
+	}
+	server := func(ep endpoint.Endpoint, dec httptransport.DecodeRequestFunc) http.Handler {
+		return httptransport.NewServer(ep, dec, EncodeAdminResponse, options...)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET "+adminCampaignsUrl, server(eps.ListCampaigns, DecodeNoRequest))
+	mux.Handle("POST "+adminCampaignsUrl, server(eps.CreateCampaign, DecodeCampaignRequest))
+	mux.Handle("GET "+adminCampaignUrl, server(eps.GetCampaign, DecodeCampaignIDRequest))
+	mux.Handle("PUT "+adminCampaignUrl, server(eps.UpdateCampaign, DecodeCampaignRequest))
+	mux.Handle("DELETE "+adminCampaignUrl, server(eps.DeleteCampaign, DecodeCampaignIDRequest))
+	mux.Handle("PUT "+adminCampaignUrl+"/rules", server(eps.UpdateRules, DecodeRulesRequest))
+	mux.Handle("POST "+adminCampaignUrl+"/activate", server(eps.ActivateCampaign, DecodeCampaignIDRequest))
+	mux.Handle("POST "+adminCampaignUrl+"/deactivate", server(eps.DeactivateCampaign, DecodeCampaignIDRequest))
+	mux.Handle("GET "+adminValidateUrl, server(eps.Validate, DecodeNoRequest))
+	mux.Handle("GET "+adminSegmentsUrl, server(eps.ListSegments, DecodeNoRequest))
+	mux.Handle("PUT "+adminSegmentUrl, server(eps.UploadSegment, DecodeUploadSegmentRequest))
+	mux.Handle("DELETE "+adminSegmentUrl, server(eps.DeleteSegment, DecodeSegmentRequest))
+	mux.Handle("GET "+adminPlacementsUrl, server(eps.ListPlacements, DecodeNoRequest))
+	mux.Handle("PUT "+adminPlacementUrl, server(eps.SavePlacement, DecodeSavePlacementRequest))
+	mux.Handle("DELETE "+adminPlacementUrl, server(eps.DeletePlacement, DecodePlacementRequest))
+	return mux
+}
+
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		level.Error(logger).Log("api", "REQUEST", "method", "decodeJSONBody", "err", err)
+		return &local_error.ErrInvalidPayload{Reason: err.Error(), Method: r.Method}
+	}
+	return nil
+}
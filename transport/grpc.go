@@ -0,0 +1,174 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"delivery-service/endpoints"
+	local_error "delivery-service/errors"
+	"delivery-service/geo"
+	"delivery-service/locale"
+	"delivery-service/pb"
+	"delivery-service/service"
+
+	"github.com/go-kit/kit/endpoint"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"github.com/go-kit/log/level"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements pb.DeliveryServer with the endpoints of the HTTP API
+type grpcServer struct {
+	pb.UnimplementedDeliveryServer
+	getCampaigns grpctransport.Handler
+}
+
+// NewGRPCServer creates the gRPC server of the delivery API on the GetCampaigns endpoint,
+// countries missing from requests are inferred from the client ip with resolver unless
+// it is nil
+func NewGRPCServer(ep endpoint.Endpoint, resolver geo.Resolver) pb.DeliveryServer {
+	return &grpcServer{
+		getCampaigns: grpctransport.NewServer(
+			ep,
+			DecodeGRPCGetCampaignsRequest,
+			EncodeGRPCGetCampaignsResponse,
+			grpctransport.ServerBefore(LocateGRPC(resolver), AcceptLanguageGRPC),
+		),
+	}
+}
+
+// GetCampaigns implements pb.DeliveryServer
+func (s *grpcServer) GetCampaigns(ctx context.Context, req *pb.GetCampaignsRequest) (*pb.GetCampaignsResponse, error) {
+	_, response, err := s.getCampaigns.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, GRPCError(err)
+	}
+	return response.(*pb.GetCampaignsResponse), nil
+}
+
+// DecodeGRPCGetCampaignsRequest decodes a gRPC request into our request struct, the limit
+// must be positive and the page not negative like the parameters of the HTTP API
+func DecodeGRPCGetCampaignsRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetCampaignsRequest)
+	level.Info(logger).Log("api", "REQUEST", "method", "DecodeGRPCGetCampaignsRequest")
+
+	if req.GetLimit() <= 0 {
+		return nil, &local_error.ErrInvalidParams{Param: "limit", Reason: "limit must be a positive integer"}
+	}
+	if req.GetPage() < 0 {
+		return nil, &local_error.ErrInvalidParams{Param: "page", Reason: "page must be a non-negative integer"}
+	}
+
+	params := req.GetParams()
+	if params == nil {
+		params = make(map[string]string)
+	}
+	return endpoints.GetCampaignsRequest{
+		Params: params,
+		UserID: req.GetUserId(),
+		Limit:  int(req.GetLimit()),
+		Page:   int(req.GetPage()),
+		Cursor: req.GetCursor(),
+	}, nil
+}
+
+// EncodeGRPCGetCampaignsResponse encodes the response of the GetCampaigns endpoint
+func EncodeGRPCGetCampaignsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(endpoints.GetCampaignsResponse)
+
+	campaigns := make([]*pb.Campaign, 0, len(resp.Campaigns))
+	for _, campaign := range resp.Campaigns {
+		campaigns = append(campaigns, &pb.Campaign{Cid: campaign.Cid, Img: campaign.Img, Cta: campaign.Cta, Vid: campaign.Vid, Creative: grpcCreative(campaign.Creative)})
+	}
+
+	reply := &pb.GetCampaignsResponse{Campaigns: campaigns, NextCursor: resp.NextCursor}
+	if resp.Country != nil {
+		reply.Country = &pb.Country{Code: resp.Country.Code, Source: resp.Country.Source}
+	}
+	return reply, nil
+}
+
+// AcceptLanguageGRPC adds the languages of the accept-language metadata to the request
+// context, like AcceptLanguage
+func AcceptLanguageGRPC(ctx context.Context, md metadata.MD) context.Context {
+	values := md.Get("accept-language")
+	if len(values) == 0 {
+		return ctx
+	}
+	languages := locale.ParseAcceptLanguage(strings.Join(values, ","))
+	if len(languages) == 0 {
+		return ctx
+	}
+	return locale.NewContext(ctx, languages)
+}
+
+// grpcCreative returns the message of a picked creative, nil without one
+func grpcCreative(c *service.Creative) *pb.Creative {
+	if c == nil {
+		return nil
+	}
+
+	message := &pb.Creative{Html: c.HTML, Title: c.Title, Description: c.Description, Lang: c.Lang}
+	if image := c.Image; image != nil {
+		message.Image = &pb.Image{Url: image.URL, Width: int32(image.Width), Height: int32(image.Height)}
+	}
+	if video := c.Video; video != nil {
+		message.Video = &pb.Video{Url: video.URL, MimeType: video.MimeType, Duration: video.Duration, Width: int32(video.Width), Height: int32(video.Height)}
+	}
+	if tracking := c.Tracking; tracking != nil {
+		message.Tracking = &pb.Tracking{Impressions: tracking.Impressions, Clicks: tracking.Clicks}
+	}
+	return message
+}
+
+// GRPCError returns the gRPC status of err: the errors of the errors package get the
+// code matching their HTTP status and unexpected errors become internal errors
+func GRPCError(err error) error {
+	var localError local_error.Error
+	if !errors.As(err, &localError) {
+		level.Error(logger).Log("api", "RESPONSE", "method", "GRPCError", "code", codes.Internal, "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	code := codes.Unknown
+	switch localError.GetCode() {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusMethodNotAllowed:
+		code = codes.Unimplemented
+	}
+	level.Info(logger).Log("api", "RESPONSE", "method", "GRPCError", "code", code, "err", err)
+	return status.Error(code, localError.Error())
+}
+
+// LocateGRPC returns a request func adding to the context the location resolver finds
+// for the client ip, from the peer address and the x-forwarded-for metadata like Locate
+func LocateGRPC(resolver geo.Resolver) grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if resolver == nil {
+			return ctx
+		}
+
+		var remote string
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			remote = p.Addr.String()
+		}
+
+		addr, ok := geo.ParseClientIP(md.Get("x-forwarded-for"), remote, geo.TrustedProxies)
+		if !ok {
+			return ctx
+		}
+		return geo.WithLookup(ctx, func() (geo.Location, bool) { return resolver.Lookup(addr) })
+	}
+}
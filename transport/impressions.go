@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"context"
+	local_error "delivery-service/errors"
+	"net/http"
+
+	"delivery-service/endpoints"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/log/level"
+)
+
+const impressionsUrl = "/v1/impressions"
+
+// DecodeImpressionRequest decodes the JSON impression of a campaign
+func DecodeImpressionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	level.Info(logger).Log("api", "REQUEST", "url", r.URL.String(), "httpMethod", r.Method)
+
+	var request endpoints.ImpressionRequest
+	if err := decodeJSONBody(r, &request); err != nil {
+		return nil, err
+	}
+	if request.CampaignID == "" {
+		return nil, &local_error.ErrMissingParams{Param: "campaignId", Method: r.Method}
+	}
+	return request, nil
+}
+
+// NewImpressionsHTTPHandler creates the HTTP handler of the impression recording API
+func NewImpressionsHTTPHandler(ep endpoint.Endpoint) http.Handler {
+	recordImpressionHandler := httptransport.NewServer(
+		ep,
+		DecodeImpressionRequest,
+		EncodeAdminResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+		httptransport.ServerErrorEncoder(EncodeAdminErrorResponse),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("POST "+impressionsUrl, recordImpressionHandler)
+	return mux
+}
@@ -9,6 +9,8 @@ import (
 	"strconv"
 
 	"delivery-service/endpoints"
+	"delivery-service/geo"
+	"delivery-service/locale"
 	"delivery-service/metrics"
 
 	"github.com/go-kit/kit/endpoint"
@@ -20,6 +22,7 @@ import (
 
 const (
 	getCampaignsUrl = "/v1/delivery"
+	batchUrl        = "/v1/delivery/batch"
 	metricsUrl      = "/metrics"
 )
 
@@ -34,7 +37,8 @@ func init() {
 
 }
 
-// DecodeGetCampaignsRequest decodes the incoming HTTP request into our request struct
+// DecodeGetCampaignsRequest decodes the incoming HTTP request into our request struct.
+// Targeting parameters are checked by the service against the registered dimensions.
 func DecodeGetCampaignsRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	switch r.Method {
 	case "GET":
@@ -51,39 +55,36 @@ func DecodeGetCampaignsRequest(_ context.Context, r *http.Request) (interface{},
 
 	for key, value := range params {
 		if key == "limit" {
-			if limit, err := strconv.Atoi(value[0]); err == nil {
-				request.Limit = limit
+			limit, err := strconv.Atoi(value[0])
+			if err != nil || limit <= 0 {
+				level.Error(logger).Log("api", "REQUEST", "method", "DecodeGetCampaignsRequest", "err", "limit must be a positive integer")
+				return nil, &local_error.ErrInvalidParams{Param: "limit", Reason: "limit must be a positive integer", Method: r.Method}
 			}
+			request.Limit = limit
 		} else if key == "page" {
-			if page, err := strconv.Atoi(value[0]); err == nil {
-				request.Page = page
+			page, err := strconv.Atoi(value[0])
+			if err != nil || page < 0 {
+				level.Error(logger).Log("api", "REQUEST", "method", "DecodeGetCampaignsRequest", "err", "page must be a non-negative integer")
+				return nil, &local_error.ErrInvalidParams{Param: "page", Reason: "page must be a non-negative integer", Method: r.Method}
+			}
+			request.Page = page
+		} else if key == "cursor" {
+			request.Cursor = value[0]
+		} else if key == "user_id" || key == "device_id" {
+			if request.UserID == "" || key == "user_id" {
+				request.UserID = value[0]
 			}
 		} else {
 			request.Params[key] = value[0]
 		}
 	}
 
-	if _, ok := request.Params["app"]; !ok {
-		level.Error(logger).Log("api", "REQUEST", "method", "DecodeGetCampaignsRequest", "err", "Missing required app parameter")
-		return nil, &local_error.ErrMissingParams{Param: "app", Method: r.Method}
-	}
-
-	if _, ok := request.Params["country"]; !ok {
-		level.Error(logger).Log("api", "REQUEST", "method", "DecodeGetCampaignsRequest", "err", "Missing required country parameter")
-		return nil, &local_error.ErrMissingParams{Param: "country", Method: r.Method}
-	}
-
-	if _, ok := request.Params["os"]; !ok {
-		level.Error(logger).Log("api", "REQUEST", "method", "DecodeGetCampaignsRequest", "err", "Missing required os parameter")
-		return nil, &local_error.ErrMissingParams{Param: "os", Method: r.Method}
-	}
-
 	if limit := r.URL.Query().Get("limit"); limit == "" {
 		level.Error(logger).Log("api", "REQUEST", "method", "DecodeGetCampaignsRequest", "err", "Missing required limit parameter")
 		return nil, &local_error.ErrMissingParams{Param: "limit", Method: r.Method}
 	}
 
-	if page := r.URL.Query().Get("page"); page == "" {
+	if page := r.URL.Query().Get("page"); page == "" && request.Cursor == "" {
 		level.Error(logger).Log("api", "REQUEST", "method", "DecodeGetCampaignsRequest", "err", "Missing required page parameter")
 		return nil, &local_error.ErrMissingParams{Param: "page", Method: r.Method}
 	}
@@ -91,6 +92,27 @@ func DecodeGetCampaignsRequest(_ context.Context, r *http.Request) (interface{},
 	return request, nil
 }
 
+// DecodeBatchRequest decodes the JSON body of a batch request, targeting parameters
+// are checked by the service like those of DecodeGetCampaignsRequest
+func DecodeBatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "POST":
+		level.Info(logger).Log("api", "REQUEST", "method", "DecodeBatchRequest", "url", r.URL.String(), "httpMethod", r.Method)
+	default:
+		level.Info(logger).Log("api", "REQUEST", "method", "DecodeBatchRequest", "url", r.URL.String(), "httpMethod", r.Method, "err", "Method Not Allowed")
+		return nil, &local_error.ErrMethodNotAllowed{Method: r.Method}
+	}
+
+	var request endpoints.BatchRequest
+	if err := decodeJSONBody(r, &request); err != nil {
+		return nil, err
+	}
+	if request.Context == nil {
+		request.Context = make(map[string]string)
+	}
+	return request, nil
+}
+
 // EncodeResponse encodes the outgoing response as JSON
 func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	statusCode := http.StatusOK
@@ -102,18 +124,69 @@ func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface
 
 // EncodeErrorResponse encodes the error response and sets the appropriate HTTP status code
 func EncodeErrorResponse(_ context.Context, err error, w http.ResponseWriter) {
-	paramError := err.(local_error.Error)
+	paramError, ok := err.(local_error.Error)
+	if !ok {
+		level.Error(logger).Log("api", "RESPONSE", "method", "GetCampaignsRequest", "httpStatusCode", http.StatusInternalServerError, "err", err)
+		metrics.HttpRequestCount.With("method", "GET", "code", strconv.Itoa(http.StatusInternalServerError)).Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "internal error"})
+		return
+	}
 	metrics.HttpRequestCount.With("method", paramError.GetMethod(), "code", strconv.Itoa(paramError.GetCode())).Add(1)
 	w.WriteHeader(paramError.GetCode())
 	json.NewEncoder(w).Encode(map[string]string{"error": paramError.Error()})
 }
 
-// NewHTTPHandler creates an HTTP handler
-func NewHTTPHandler(ep endpoint.Endpoint) http.Handler {
+// Locate returns a request func adding to the context the location resolver finds for
+// the client ip, which stands for the location parameters missing from the request. The
+// lookup only runs when the location is used, requests with a country skip it.
+func Locate(resolver geo.Resolver) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if resolver == nil {
+			return ctx
+		}
+		addr, ok := geo.ClientIP(r)
+		if !ok {
+			return ctx
+		}
+		return geo.WithLookup(ctx, func() (geo.Location, bool) { return resolver.Lookup(addr) })
+	}
+}
+
+// AcceptLanguage adds the languages of the Accept-Language header to the request context,
+// for the requests without a lang parameter
+func AcceptLanguage(ctx context.Context, r *http.Request) context.Context {
+	languages := locale.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if len(languages) == 0 {
+		return ctx
+	}
+	return locale.NewContext(ctx, languages)
+}
+
+// NewBatchHTTPHandler creates the HTTP handler of the batch delivery API, countries are
+// inferred with resolver like in NewHTTPHandler
+func NewBatchHTTPHandler(ep endpoint.Endpoint, resolver geo.Resolver) http.Handler {
+	batchHandler := httptransport.NewServer(
+		ep,
+		DecodeBatchRequest,
+		EncodeAdminResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext, Locate(resolver), AcceptLanguage),
+		httptransport.ServerErrorEncoder(EncodeAdminErrorResponse),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle(batchUrl, batchHandler)
+	return mux
+}
+
+// NewHTTPHandler creates an HTTP handler, countries missing from requests are inferred
+// from the client ip with resolver unless it is nil
+func NewHTTPHandler(ep endpoint.Endpoint, resolver geo.Resolver) http.Handler {
 	getCampaignsHandler := httptransport.NewServer(
 		ep,
 		DecodeGetCampaignsRequest,
 		EncodeResponse,
+		httptransport.ServerBefore(Locate(resolver), AcceptLanguage),
 		httptransport.ServerErrorEncoder(EncodeErrorResponse),
 	)
 
@@ -1,5 +1,10 @@
 package utils
 
+import (
+	"sort"
+	"strings"
+)
+
 func Contains(slice []string, str string) bool {
 	for _, v := range slice {
 		if v == str {
@@ -8,3 +13,22 @@ func Contains(slice []string, str string) bool {
 	}
 	return false
 }
+
+// ContainsFold reports whether slice holds str, compared without case
+func ContainsFold(slice []string, str string) bool {
+	for _, v := range slice {
+		if strings.EqualFold(v, str) {
+			return true
+		}
+	}
+	return false
+}
+
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
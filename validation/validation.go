@@ -0,0 +1,125 @@
+package validation
+
+import (
+	"sort"
+	"strings"
+
+	"delivery-service/dimensions"
+	"delivery-service/expression"
+	"delivery-service/storage"
+)
+
+// Issue is a problem found in the rules of a campaign
+type Issue struct {
+	CampaignID string `json:"campaignId"`
+	Rule       string `json:"rule"`
+	Value      string `json:"value,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// Validator checks campaign rules against the dimensions registered in rules_parameters
+// and the value type of each dimension
+type Validator struct {
+	registry *dimensions.Registry
+}
+
+// New creates a Validator for the dimensions of registry
+func New(registry *dimensions.Registry) *Validator {
+	return &Validator{
+		registry: registry,
+	}
+}
+
+// Validate returns the issues of every campaign, in the order of campaigns
+func (v *Validator) Validate(campaigns []storage.Campaign) []Issue {
+	var issues []Issue
+	for _, campaign := range campaigns {
+		issues = append(issues, v.ValidateCampaign(campaign)...)
+	}
+	return issues
+}
+
+// ValidateCampaign returns the issues of a campaign, nil when its rules are valid
+func (v *Validator) ValidateCampaign(campaign storage.Campaign) []Issue {
+	var issues []Issue
+
+	for _, country := range campaign.Countries {
+		if !dimensions.IsCountryCode(country) {
+			issues = append(issues, Issue{CampaignID: campaign.ID, Rule: "countries", Value: country, Reason: "not an ISO 3166-1 alpha-2 country code"})
+		}
+	}
+
+	keys := make([]string, 0, len(campaign.Rules))
+	for key := range campaign.Rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name, include, ok := dimensions.RuleKey(key)
+		if !ok {
+			issues = append(issues, Issue{CampaignID: campaign.ID, Rule: key, Reason: "rule must be include<param> or exclude<param>"})
+			continue
+		}
+
+		dimension, ok := v.registry.Get(name)
+		if !ok {
+			issues = append(issues, Issue{CampaignID: campaign.ID, Rule: key, Reason: v.unknownDimension(name)})
+			continue
+		}
+
+		for _, value := range campaign.Rules[key] {
+			reason := "empty value"
+			if value != "" {
+				reason = dimension.Check(value)
+			}
+			if reason == "" && include && dimension.Type == storage.TypeRegion {
+				reason = outsideCountries(campaign, value)
+			}
+			if reason != "" {
+				issues = append(issues, Issue{CampaignID: campaign.ID, Rule: key, Value: value, Reason: reason})
+			}
+		}
+	}
+
+	if campaign.Expression != "" {
+		if reason := v.checkExpression(campaign.Expression); reason != "" {
+			issues = append(issues, Issue{CampaignID: campaign.ID, Rule: "expression", Value: campaign.Expression, Reason: reason})
+		}
+	}
+
+	return issues
+}
+
+// outsideCountries returns why a region of an include rule cannot be delivered, the
+// campaign being delivered only in its countries, empty when it can
+func outsideCountries(campaign storage.Campaign, region string) string {
+	country, _ := dimensions.RegionCountry(region)
+	for _, c := range campaign.Countries {
+		if strings.EqualFold(c, country) {
+			return ""
+		}
+	}
+	return "region of " + country + ", which is not in the campaign countries"
+}
+
+// checkExpression returns why a targeting expression does not parse or type check, empty when it does
+func (v *Validator) checkExpression(source string) string {
+	expr, err := expression.Parse(source)
+	if err == nil {
+		err = expr.Check(v.registry)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func (v *Validator) unknownDimension(dimension string) string {
+	for _, param := range v.registry.Names() {
+		if strings.EqualFold(param, dimension) {
+			return "unknown dimension " + dimension + ", did you mean " + param + "?"
+		}
+	}
+	return "unknown dimension " + dimension + ", not in rules_parameters"
+}
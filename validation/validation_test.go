@@ -0,0 +1,98 @@
+package validation
+
+import (
+	"testing"
+
+	"delivery-service/dimensions"
+	"delivery-service/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var registry = dimensions.New(storage.DimensionsFromNames([]string{"app", "country", "os"}))
+
+// valid rules - no issues
+func TestValidateCampaign1(t *testing.T) {
+	campaign := storage.Campaign{
+		ID:        "spotify",
+		Countries: []string{"us", "IN"},
+		Rules: map[string][]string{
+			"includeos":      {"android", "iOS"},
+			"excludeapp":     {"com.gametion.ludokinggame", "id284882215", "284882215"},
+			"includecountry": {"de"},
+		},
+	}
+	assert.Empty(t, New(registry).ValidateCampaign(campaign))
+}
+
+// rule keys without a registered dimension - hint on case mismatch
+func TestValidateCampaign2(t *testing.T) {
+	campaign := storage.Campaign{
+		ID: "spotify",
+		Rules: map[string][]string{
+			"includeOS":     {"android"},
+			"excludedevice": {"tv"},
+			"os":            {"android"},
+		},
+	}
+	issues := New(registry).ValidateCampaign(campaign)
+	assert.Equal(t, []Issue{
+		{CampaignID: "spotify", Rule: "excludedevice", Reason: "unknown dimension device, not in rules_parameters"},
+		{CampaignID: "spotify", Rule: "includeOS", Reason: "unknown dimension OS, did you mean os?"},
+		{CampaignID: "spotify", Rule: "os", Reason: "rule must be include<param> or exclude<param>"},
+	}, issues)
+}
+
+// invalid values of the well known dimensions
+func TestValidateCampaign3(t *testing.T) {
+	campaign := storage.Campaign{
+		ID:        "spotify",
+		Countries: []string{"usa"},
+		Rules: map[string][]string{
+			"includeapp":     {"ludo king"},
+			"includecountry": {"xx"},
+			"excludeos":      {"symbian", ""},
+		},
+	}
+	issues := New(registry).ValidateCampaign(campaign)
+	assert.Len(t, issues, 5)
+	assert.Equal(t, "countries", issues[0].Rule)
+	assert.Equal(t, "usa", issues[0].Value)
+	assert.Equal(t, "symbian", issues[1].Value)
+	assert.Equal(t, "empty value", issues[2].Reason)
+	assert.Equal(t, "ludo king", issues[3].Value)
+	assert.Equal(t, "xx", issues[4].Value)
+}
+
+// expressions that do not parse or type check
+func TestValidateCampaign4(t *testing.T) {
+	validator := New(registry)
+	assert.Empty(t, validator.ValidateCampaign(storage.Campaign{ID: "spotify", Expression: `os == "ios" or country in ["de"]`}))
+
+	issues := validator.ValidateCampaign(storage.Campaign{ID: "spotify", Expression: `os == "ios" or device == "tv"`})
+	assert.Equal(t, []Issue{
+		{CampaignID: "spotify", Rule: "expression", Value: `os == "ios" or device == "tv"`, Reason: "at 16: unknown dimension device"},
+	}, issues)
+
+	issues = validator.ValidateCampaign(storage.Campaign{ID: "spotify", Expression: `os == `})
+	assert.Equal(t, "at 7: expected a string or a number, found end of expression", issues[0].Reason)
+}
+
+// regions of include rules must be in the campaign countries
+func TestValidateCampaign5(t *testing.T) {
+	validator := New(dimensions.New(storage.DimensionsFromNames([]string{"country", "region", "city"})))
+	campaign := storage.Campaign{
+		ID:        "spotify",
+		Countries: []string{"us"},
+		Rules: map[string][]string{
+			"includeregion": {"US-CA", "GB-ENG", "california"},
+			"excluderegion": {"gb-sct"},
+			"includecity":   {"San  Francisco"},
+		},
+	}
+	assert.Equal(t, []Issue{
+		{CampaignID: "spotify", Rule: "includecity", Value: "San  Francisco", Reason: "extra spaces, expected San Francisco"},
+		{CampaignID: "spotify", Rule: "includeregion", Value: "GB-ENG", Reason: "region of gb, which is not in the campaign countries"},
+		{CampaignID: "spotify", Rule: "includeregion", Value: "california", Reason: "not an ISO 3166-2 region code, like us-ca"},
+	}, validator.ValidateCampaign(campaign))
+}